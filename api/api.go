@@ -2,22 +2,40 @@ package api
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
 
 	"github.com/thiagozs/go-shorturl/config"
 	"github.com/thiagozs/go-shorturl/handler"
 	"github.com/thiagozs/go-shorturl/middleware"
+	"github.com/thiagozs/go-shorturl/pkg/auth"
 )
 
+// readHeaderTimeout bounds how long a client may take to send its request
+// headers, so slow clients cannot hold connections open
+const readHeaderTimeout = 10 * time.Second
+
 type API struct {
 	params *APIParams
 	server *http.Server
-	http   *http.ServeMux
+	// metricsServer serves /metrics on its own listener when configured
+	metricsServer *http.Server
+	// redirectServer sends plain HTTP requests to HTTPS when configured
+	redirectServer *http.Server
+	// mux routes the requests, replaced as a whole on reload so in-flight
+	// requests finish with the handlers they started with
+	mux    atomic.Pointer[http.ServeMux]
 	logger *slog.Logger
 	md     *middleware.Middleware
 	hd     *handler.Handler
+	// errs carries listener failures after Start
+	errs chan error
 }
 
 func NewApi(opts ...Options) (*API, error) {
@@ -28,66 +46,271 @@ func NewApi(opts ...Options) (*API, error) {
 
 	return &API{
 		params: params,
-		http:   http.NewServeMux(),
 		logger: params.Logger(),
 		md:     params.Middleware(),
 		hd:     params.Handlers(),
+		errs:   make(chan error, 3),
 	}, nil
 }
 
 func (a *API) RegisterServer() error {
 	a.server = &http.Server{
-		Addr:    fmt.Sprintf("%s:%s", a.params.Host(), a.params.Port()),
-		Handler: a.http,
+		Addr:              fmt.Sprintf("%s:%s", a.params.Host(), a.params.Port()),
+		Handler:           a.Handler(),
+		TLSConfig:         a.params.TLS(),
+		ReadHeaderTimeout: readHeaderTimeout,
+	}
+
+	if addr := a.params.RedirectAddr(); addr != "" {
+		if a.params.TLS() == nil {
+			return fmt.Errorf("redirect to HTTPS needs TLS")
+		}
+		a.redirectServer = &http.Server{
+			Addr:              addr,
+			Handler:           redirectHTTPS(a.params.Port()),
+			ReadHeaderTimeout: readHeaderTimeout,
+		}
+	}
+
+	if m := a.params.Metrics(); m != nil && a.params.MetricsAddr() != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", m.Handler())
+		a.metricsServer = &http.Server{Addr: a.params.MetricsAddr(), Handler: mux, ReadHeaderTimeout: readHeaderTimeout}
 	}
 	return nil
 }
 
 func (a *API) RegisterEndPoints() error {
-	// Define the middleware functions to use auth
-	midAuth := []middleware.MiddlewaresFunc{
-		a.md.CORS,
-		a.md.Logging,
-		a.md.TokenAuth,
+	// Define the middleware functions to use auth, each route names the
+	// scope its callers need. The first middleware runs first.
+	midAuth := func(scope string) []middleware.MiddlewaresFunc {
+		return []middleware.MiddlewaresFunc{
+			a.md.ClientIP,
+			a.md.CORS(middleware.GroupAPI),
+			a.md.Logging,
+			a.md.Authenticate,
+			a.md.RateLimit(middleware.GroupAPI),
+			a.md.RequireScope(scope),
+		}
 	}
 
 	// Define the middleware functions to use common
 	midcommon := []middleware.MiddlewaresFunc{
-		a.md.CORS,
+		a.md.ClientIP,
+		a.md.Logging,
+	}
+
+	// Define the middleware functions for the public redirects
+	midRedirect := []middleware.MiddlewaresFunc{
+		a.md.ClientIP,
+		a.md.CORS(middleware.GroupRedirect),
 		a.md.Logging,
+		a.md.RateLimit(middleware.GroupRedirect),
 	}
 
 	endpoints := map[string]http.HandlerFunc{
-		"/shorten": a.md.SugarMFunc(midAuth, a.hd.ShortenHandler),
-		"/update":  a.md.SugarMFunc(midAuth, a.hd.UpdateHandler),
-		"/flush":   a.md.SugarMFunc(midAuth, a.hd.FlushHandler),
-		"/backup":  a.md.SugarMFunc(midAuth, a.hd.BackupHandler),
-		"/import":  a.md.SugarMFunc(midAuth, a.hd.ImportHandler),
-		"/stats":   a.md.SugarMFunc(midAuth, a.hd.StatsHandler),
-		"/":        a.md.SugarMFunc(midcommon, a.hd.RedirectHandler),
-		"/health":  a.md.SugarMFunc(midcommon, a.hd.HealthHandler),
+		"/shorten":      a.md.SugarMFunc(midAuth(auth.ScopeLinksWrite), a.hd.ShortenHandler),
+		"/update":       a.md.SugarMFunc(midAuth(auth.ScopeLinksWrite), a.hd.UpdateHandler),
+		"/stats":        a.md.SugarMFunc(midAuth(auth.ScopeStatsRead), a.hd.StatsHandler),
+		"/stats/query":  a.md.SugarMFunc(midAuth(auth.ScopeStatsRead), a.hd.AnalyticsHandler),
+		"/export":       a.md.SugarMFunc(midAuth(auth.ScopeStatsRead), a.hd.ExportHandler),
+		"/flush":        a.md.SugarMFunc(midAuth(auth.ScopeAdmin), a.hd.FlushHandler),
+		"/backup":       a.md.SugarMFunc(midAuth(auth.ScopeAdmin), a.hd.BackupHandler),
+		"/import":       a.md.SugarMFunc(midAuth(auth.ScopeAdmin), a.hd.ImportHandler),
+		"/keys":         a.md.SugarMFunc(midAuth(auth.ScopeAdmin), a.hd.KeysHandler),
+		"/domains":      a.md.SugarMFunc(midAuth(auth.ScopeAdmin), a.hd.DomainsHandler),
+		"/admin/reload": a.md.SugarMFunc(midAuth(auth.ScopeAdmin), a.hd.ReloadHandler),
+		"/":             a.md.SugarMFunc(midRedirect, a.hd.RedirectHandler),
+		"/qr/":          a.md.SugarMFunc(midRedirect, a.hd.QRHandler),
+		"/health":       a.md.SugarMFunc(midcommon, a.hd.HealthHandler),
+	}
+
+	// Probes are for the orchestrator, which knows the pod rather than the
+	// public URL, so they stay at the root whatever the base URL
+	probes := map[string]http.HandlerFunc{
+		"/livez":  a.md.SugarMFunc(midcommon, a.hd.LivezHandler),
+		"/readyz": a.md.SugarMFunc(midcommon, a.hd.ReadyzHandler),
+	}
+
+	if m := a.params.Metrics(); m != nil && a.params.MetricsAddr() == "" {
+		endpoints["/metrics"] = a.md.SugarMFunc(midAuth(auth.ScopeMetricsRead), m.Handler().ServeHTTP)
 	}
 
+	// Every route is traced, counted and timed under its own path, and
+	// mounted under the path prefix of the base URL
+	prefix := a.hd.BasePath()
+	mux := http.NewServeMux()
 	for path, handler := range endpoints {
-		a.http.HandleFunc(path, handler)
+		mux.HandleFunc(prefix+path, a.md.Tracing(path)(a.md.Metrics(path)(handler)))
 	}
+	for path, handler := range probes {
+		mux.HandleFunc(path, a.md.Tracing(path)(a.md.Metrics(path)(handler)))
+	}
+	a.mux.Store(mux)
 
 	return nil
 }
 
-func (a *API) Start() {
-	go func(*API) {
-		a.logger.Info("Server started")
-		if err := a.server.ListenAndServe(); err != nil &&
-			err != http.ErrServerClosed {
-			a.logger.Error("listen and serve", "error", err)
+// Swap routes the following requests to new handlers and middlewares, e.g.
+// after a configuration reload. Requests already running are not affected.
+func (a *API) Swap(hd *handler.Handler, md *middleware.Middleware) error {
+	a.params.SetHandlers(hd)
+	a.params.SetMiddleware(md)
+	a.hd = hd
+	a.md = md
+	return a.RegisterEndPoints()
+}
+
+// SetConfig replaces the configuration kept by the API
+func (a *API) SetConfig(cfg *config.Config) {
+	a.params.SetConfig(cfg)
+}
+
+// Handler returns the router with every registered endpoint, so the API can
+// be served by something other than Start (e.g. an httptest server)
+func (a *API) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux := a.mux.Load()
+		if mux == nil {
+			http.NotFound(w, r)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// Start binds the listeners and serves them in the background. A port that
+// cannot be bound is returned right away, failures while serving are
+// reported on Err.
+func (a *API) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", a.server.Addr)
+	if err != nil {
+		return err
+	}
+
+	var metricsLn net.Listener
+	if a.metricsServer != nil {
+		metricsLn, err = net.Listen("tcp", a.metricsServer.Addr)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("metrics: %w", err)
+		}
+	}
+
+	var redirectLn net.Listener
+	if a.redirectServer != nil {
+		redirectLn, err = net.Listen("tcp", a.redirectServer.Addr)
+		if err != nil {
+			ln.Close()
+			if metricsLn != nil {
+				metricsLn.Close()
+			}
+			return fmt.Errorf("redirect: %w", err)
+		}
+	}
+
+	go func() {
+		tls := a.server.TLSConfig != nil
+		a.logger.Info("Server started", slog.String("addr", ln.Addr().String()), slog.Bool("tls", tls))
+
+		// The certificates come from TLSConfig, not from files
+		serve := a.server.Serve
+		if tls {
+			serve = func(ln net.Listener) error { return a.server.ServeTLS(ln, "", "") }
+		}
+		if err := serve(ln); err != nil && err != http.ErrServerClosed {
+			a.errs <- err
 		}
 		a.logger.Info("Server stopped")
-	}(a)
+	}()
+
+	if redirectLn != nil {
+		go func() {
+			a.logger.Info("HTTPS redirect server started", slog.String("addr", redirectLn.Addr().String()))
+			if err := a.redirectServer.Serve(redirectLn); err != nil && err != http.ErrServerClosed {
+				a.errs <- fmt.Errorf("redirect: %w", err)
+			}
+		}()
+	}
+
+	if metricsLn != nil {
+		go func() {
+			a.logger.Info("Metrics server started", slog.String("addr", metricsLn.Addr().String()))
+			if err := a.metricsServer.Serve(metricsLn); err != nil && err != http.ErrServerClosed {
+				a.errs <- fmt.Errorf("metrics: %w", err)
+			}
+		}()
+	}
+
+	return nil
+}
+
+// Err reports the listeners failing after Start
+func (a *API) Err() <-chan error {
+	return a.errs
 }
 
-func (a *API) Shutdown() error {
-	return a.server.Shutdown(context.Background())
+// Shutdown fails the readiness probe, waits the drain delay so load
+// balancers notice, then stops accepting requests and waits for in-flight
+// ones until ctx is done. Connections still open by then are closed.
+func (a *API) Shutdown(ctx context.Context) error {
+	if checker := a.params.Health(); checker != nil {
+		checker.Drain()
+	}
+
+	if delay := a.params.DrainDelay(); delay > 0 {
+		a.logger.Info("Draining before shutdown", slog.Duration("delay", delay))
+		t := time.NewTimer(delay)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+		}
+	}
+
+	var errs []error
+	if a.redirectServer != nil {
+		if err := a.redirectServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("redirect: %w", err))
+			a.redirectServer.Close()
+		}
+	}
+
+	if a.metricsServer != nil {
+		if err := a.metricsServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("metrics: %w", err))
+			a.metricsServer.Close()
+		}
+	}
+
+	if err := a.server.Shutdown(ctx); err != nil {
+		a.logger.Warn("Drain timed out, closing remaining connections")
+		errs = append(errs, err)
+		a.server.Close()
+	}
+
+	return errors.Join(errs...)
+}
+
+// redirectHTTPS redirects every request to the same host and path over
+// HTTPS on port, which is left out of the URL when it is 443
+func redirectHTTPS(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if host == "" {
+			http.Error(w, "Host header required", http.StatusBadRequest)
+			return
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawPath: r.URL.RawPath, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusPermanentRedirect)
+	})
 }
 
 func (a *API) SetConfigByFlags(cfg *config.Config) {
@@ -1,12 +1,16 @@
 package api
 
 import (
+	"crypto/tls"
 	"log/slog"
+	"time"
 
 	"github.com/thiagozs/go-shorturl/config"
 	"github.com/thiagozs/go-shorturl/handler"
 	"github.com/thiagozs/go-shorturl/infra/database"
 	"github.com/thiagozs/go-shorturl/middleware"
+	"github.com/thiagozs/go-shorturl/pkg/health"
+	"github.com/thiagozs/go-shorturl/pkg/metrics"
 )
 
 type Options func(*APIParams) error
@@ -21,6 +25,15 @@ type APIParams struct {
 	port       string
 	host       string
 	https      bool
+
+	metrics     *metrics.Metrics
+	metricsAddr string
+
+	health     *health.Checker
+	drainDelay time.Duration
+
+	tls          *tls.Config
+	redirectAddr string
 }
 
 func newApiParams(opts ...Options) (*APIParams, error) {
@@ -96,6 +109,52 @@ func WithConfig(config *config.Config) Options {
 	}
 }
 
+// WithMetrics exposes m at /metrics. With an address the endpoint gets its
+// own listener without authentication, otherwise it is served next to the
+// API and needs the metrics:read scope.
+func WithMetrics(m *metrics.Metrics, addr string) Options {
+	return func(p *APIParams) error {
+		p.metrics = m
+		p.metricsAddr = addr
+		return nil
+	}
+}
+
+// WithHealth sets the checker that is drained on shutdown, failing the
+// readiness probe while in-flight requests finish
+func WithHealth(checker *health.Checker) Options {
+	return func(p *APIParams) error {
+		p.health = checker
+		return nil
+	}
+}
+
+// WithDrainDelay keeps serving for delay after the readiness probe starts
+// failing on shutdown, giving load balancers time to stop routing here
+func WithDrainDelay(delay time.Duration) Options {
+	return func(p *APIParams) error {
+		p.drainDelay = delay
+		return nil
+	}
+}
+
+// WithTLS serves HTTPS with cfg instead of plain HTTP
+func WithTLS(cfg *tls.Config) Options {
+	return func(p *APIParams) error {
+		p.tls = cfg
+		return nil
+	}
+}
+
+// WithRedirectAddr listens for plain HTTP on addr and redirects every
+// request to HTTPS. It needs WithTLS.
+func WithRedirectAddr(addr string) Options {
+	return func(p *APIParams) error {
+		p.redirectAddr = addr
+		return nil
+	}
+}
+
 // getters -----
 
 func (p *APIParams) DB() *database.Database {
@@ -134,6 +193,30 @@ func (p *APIParams) Config() *config.Config {
 	return p.config
 }
 
+func (p *APIParams) Metrics() *metrics.Metrics {
+	return p.metrics
+}
+
+func (p *APIParams) MetricsAddr() string {
+	return p.metricsAddr
+}
+
+func (p *APIParams) Health() *health.Checker {
+	return p.health
+}
+
+func (p *APIParams) DrainDelay() time.Duration {
+	return p.drainDelay
+}
+
+func (p *APIParams) TLS() *tls.Config {
+	return p.tls
+}
+
+func (p *APIParams) RedirectAddr() string {
+	return p.redirectAddr
+}
+
 // setters -----
 
 func (p *APIParams) SetDB(db *database.Database) {
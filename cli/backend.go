@@ -0,0 +1,411 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/config"
+	"github.com/thiagozs/go-shorturl/infra/database"
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+	"github.com/thiagozs/go-shorturl/initialize"
+	"github.com/thiagozs/go-shorturl/pkg/analytics"
+	"github.com/thiagozs/go-shorturl/pkg/auth"
+	"github.com/thiagozs/go-shorturl/pkg/baseurl"
+	"github.com/thiagozs/go-shorturl/pkg/client"
+	"github.com/thiagozs/go-shorturl/pkg/rules"
+	"github.com/thiagozs/go-shorturl/pkg/utils"
+	"github.com/thiagozs/go-shorturl/pkg/validator"
+)
+
+// backend is what the admin commands operate on, either a running server or
+// the configured store
+type backend interface {
+	// Shorten, Stats and Update work on the links of domain, the primary
+	// domain when empty
+	Shorten(ctx context.Context, domain, originalURL string, tags []string) (string, error)
+	Stats(ctx context.Context, domain, code string) (*client.URLStats, error)
+	Update(ctx context.Context, domain, code, newURL string) error
+	Backup(ctx context.Context) (map[string]string, error)
+	Import(ctx context.Context, urls map[string]string) error
+	// Restore replaces every link with urls, leaving the store untouched
+	// when any URL is rejected
+	Restore(ctx context.Context, urls map[string]string) error
+	Flush(ctx context.Context) (map[string]string, error)
+	CreateAPIKey(ctx context.Context, name string, scopes []string, ttl time.Duration) (*client.APIKey, string, error)
+	Export(ctx context.Context, query client.ExportQuery, w io.Writer) error
+	// Close releases the store opened by -offline
+	Close() error
+}
+
+func (f *adminFlags) backend() (backend, error) {
+	if f.offline {
+		return newStoreBackend(f)
+	}
+
+	// -timeout bounds the whole command, so long exports are not cut short
+	// by a per-request timeout
+	c, err := client.NewClient(
+		client.WithBaseURL(f.server),
+		client.WithToken(f.token),
+		client.WithHTTPClient(&http.Client{}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteBackend{client: c}, nil
+}
+
+// remoteBackend maps API errors to the CLI exit codes
+type remoteBackend struct {
+	client *client.Client
+}
+
+func (b *remoteBackend) Shorten(ctx context.Context, domain, originalURL string, tags []string) (string, error) {
+	short, err := b.client.Shorten(ctx, originalURL, client.ShortenOptions{Tags: tags, Domain: domain})
+	return short, remoteErr(err)
+}
+
+func (b *remoteBackend) Stats(ctx context.Context, domain, code string) (*client.URLStats, error) {
+	stats, err := b.client.Stats(ctx, domain, code)
+	return stats, remoteErr(err)
+}
+
+func (b *remoteBackend) Update(ctx context.Context, domain, code, newURL string) error {
+	return remoteErr(b.client.Update(ctx, domain, code, newURL))
+}
+
+func (b *remoteBackend) Backup(ctx context.Context) (map[string]string, error) {
+	urls, err := b.client.Backup(ctx)
+	return urls, remoteErr(err)
+}
+
+func (b *remoteBackend) Import(ctx context.Context, urls map[string]string) error {
+	return remoteErr(b.client.Import(ctx, urls))
+}
+
+func (b *remoteBackend) Restore(ctx context.Context, urls map[string]string) error {
+	return remoteErr(b.client.Restore(ctx, urls))
+}
+
+func (b *remoteBackend) Flush(ctx context.Context) (map[string]string, error) {
+	urls, err := b.client.Flush(ctx)
+	return urls, remoteErr(err)
+}
+
+func (b *remoteBackend) Export(ctx context.Context, query client.ExportQuery, w io.Writer) error {
+	return remoteErr(b.client.Export(ctx, query, w))
+}
+
+func (b *remoteBackend) CreateAPIKey(ctx context.Context, name string, scopes []string, ttl time.Duration) (*client.APIKey, string, error) {
+	key, token, err := b.client.CreateAPIKey(ctx, name, scopes, ttl)
+	return key, token, remoteErr(err)
+}
+
+func (b *remoteBackend) Close() error {
+	return nil
+}
+
+func remoteErr(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, client.ErrNotFound):
+		return fmt.Errorf("%w: %v", errNotFound, err)
+	case errors.Is(err, client.ErrUnauthorized), errors.Is(err, client.ErrForbidden):
+		return fmt.Errorf("%w: %v", errForbidden, err)
+	default:
+		return err
+	}
+}
+
+// storeBackend works on the store described by the environment, for use
+// while the server is stopped
+type storeBackend struct {
+	cfg       *config.Config
+	db        *database.Database
+	validator *validator.Validator
+	rules     *rules.Engine
+	baseURL   *baseurl.Builder
+}
+
+func newStoreBackend(f *adminFlags) (_ *storeBackend, err error) {
+	cfg, db, err := f.openStore()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			db.Close()
+		}
+	}()
+
+	if db.Kind == database.Memory {
+		return nil, usageErrorf("-offline needs a persistent store, set DATABASE=sqlite or -database=sqlite")
+	}
+
+	if err := db.CheckSchema(); err != nil {
+		return nil, err
+	}
+
+	v, err := initialize.NewValidator(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	engine, err := initialize.NewRulesEngine(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		return nil, err
+	}
+
+	builder, err := initialize.NewBaseURL(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &storeBackend{cfg: cfg, db: db, validator: v, rules: engine, baseURL: builder}, nil
+}
+
+// openStore loads the configuration from the config file and the
+// environment, applies the storage flags and opens the store
+func (f *adminFlags) openStore() (*config.Config, *database.Database, error) {
+	cfg, err := config.Load(f.config)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if f.database != "" {
+		cfg.SetDatabase(f.database)
+	}
+	if f.dbPath != "" {
+		cfg.SetDatabasePath(f.dbPath)
+	}
+
+	kind, err := database.ParseKind(cfg.GetDatabase())
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	db, err := database.NewDatabase(kind, cfg.GetDatabasePath(), logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cfg, db, nil
+}
+
+// checkDestination applies the URL policy, the rules and the registered
+// domains, the same checks the server makes
+func (b *storeBackend) checkDestination(ctx context.Context, rawURL string) error {
+	if _, err := b.validator.Validate(ctx, rawURL); err != nil {
+		return err
+	}
+
+	if b.rules != nil {
+		if verdict := b.rules.CheckString(rawURL); verdict.Blocked {
+			return fmt.Errorf("blocked url: %s", verdict.Reason)
+		}
+	}
+
+	if u, err := url.Parse(rawURL); err == nil {
+		if name, err := utils.ParseDomain(u.Host); err == nil {
+			if _, found := b.db.GetDomain(name); found {
+				return fmt.Errorf("points back at the short link domain %s", name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// namespace returns the namespace the links of the named domain are keyed
+// under, like the server does: the primary domain, also used when name is
+// empty, has the empty one and other domains must be registered
+func (b *storeBackend) namespace(name string) (string, error) {
+	if name == "" || name == strings.ToLower(b.cfg.GetDomain()) {
+		return "", nil
+	}
+
+	if _, found := b.db.GetDomain(name); !found {
+		return "", fmt.Errorf("%w: unknown domain %q", errUsage, name)
+	}
+	return name, nil
+}
+
+func (b *storeBackend) Shorten(ctx context.Context, domain, originalURL string, tags []string) (string, error) {
+	namespace, err := b.namespace(domain)
+	if err != nil {
+		return "", err
+	}
+
+	if err := b.checkDestination(ctx, originalURL); err != nil {
+		return "", fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	shortURL, err := utils.GenerateShortURL()
+	if err != nil {
+		return "", err
+	}
+
+	link := model.Link{
+		ShortURL:    model.LinkKey(namespace, shortURL),
+		OriginalURL: originalURL,
+		CreatedAt:   time.Now().UTC(),
+		Tags:        tags,
+	}
+	if err := b.db.SaveLink(link); err != nil {
+		return "", err
+	}
+
+	return b.baseURL.Build(nil, namespace, shortURL), nil
+}
+
+func (b *storeBackend) Update(ctx context.Context, domain, code, newURL string) error {
+	namespace, err := b.namespace(domain)
+	if err != nil {
+		return err
+	}
+
+	key := model.LinkKey(namespace, code)
+	if _, found := b.db.Get(key); !found {
+		return errNotFound
+	}
+
+	if err := b.checkDestination(ctx, newURL); err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	return b.db.UpdateURL(key, newURL)
+}
+
+func (b *storeBackend) Export(_ context.Context, query client.ExportQuery, w io.Writer) error {
+	exporter, err := analytics.NewExporter(w, query.Format)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	namespace, err := b.namespace(query.Domain)
+	if err != nil {
+		return err
+	}
+
+	filter := model.ClickFilter{
+		Tag:         query.Tag,
+		From:        query.From,
+		To:          query.To,
+		IncludeBots: query.IncludeBots,
+	}
+	if query.ShortURL != "" {
+		filter.ShortURL = model.LinkKey(namespace, query.ShortURL)
+	}
+	if err := b.db.ScanClicks(filter, exporter.Write); err != nil {
+		return err
+	}
+
+	return exporter.Flush()
+}
+
+func (b *storeBackend) Stats(_ context.Context, domain, code string) (*client.URLStats, error) {
+	namespace, err := b.namespace(domain)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, found := b.db.GetStats(model.LinkKey(namespace, code))
+	if !found {
+		return nil, errNotFound
+	}
+
+	stats := &client.URLStats{}
+	if err := json.Unmarshal([]byte(raw), stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+func (b *storeBackend) Backup(context.Context) (map[string]string, error) {
+	raw, err := b.db.Backup()
+	if err != nil {
+		return nil, err
+	}
+
+	urls := map[string]string{}
+	if err := json.Unmarshal(raw, &urls); err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
+
+func (b *storeBackend) Import(ctx context.Context, urls map[string]string) error {
+	data, err := b.checkBackup(ctx, urls)
+	if err != nil {
+		return err
+	}
+	return b.db.Import(data)
+}
+
+func (b *storeBackend) Restore(ctx context.Context, urls map[string]string) error {
+	data, err := b.checkBackup(ctx, urls)
+	if err != nil {
+		return err
+	}
+	_, err = b.db.Restore(data)
+	return err
+}
+
+// checkBackup checks every URL of a backup, all or nothing like the server,
+// and encodes it for the store
+func (b *storeBackend) checkBackup(ctx context.Context, urls map[string]string) ([]byte, error) {
+	var rejected []string
+	for shortURL, originalURL := range urls {
+		if err := b.checkDestination(ctx, originalURL); err != nil {
+			rejected = append(rejected, fmt.Sprintf("%s: %v", shortURL, err))
+		}
+	}
+	if len(rejected) > 0 {
+		slices.Sort(rejected)
+		return nil, fmt.Errorf("%w: %d URL(s) rejected\n%s", errUsage, len(rejected), strings.Join(rejected, "\n"))
+	}
+
+	return json.Marshal(urls)
+}
+
+func (b *storeBackend) Flush(context.Context) (map[string]string, error) {
+	return b.db.Flush()
+}
+
+func (b *storeBackend) Close() error {
+	return b.db.Close()
+}
+
+func (b *storeBackend) CreateAPIKey(_ context.Context, name string, scopes []string, ttl time.Duration) (*client.APIKey, string, error) {
+	key, plaintext, err := auth.NewAPIKey(name, scopes, ttl)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := b.db.SaveAPIKey(key); err != nil {
+		return nil, "", err
+	}
+
+	return &client.APIKey{
+		ID:        key.ID,
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    key.Scopes,
+		CreatedAt: key.CreatedAt,
+		ExpiresAt: key.ExpiresAt,
+	}, plaintext, nil
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// Exit codes returned by Run, stable so scripts can rely on them
+const (
+	ExitOK        = 0
+	ExitError     = 1
+	ExitUsage     = 2
+	ExitNotFound  = 3
+	ExitForbidden = 4
+)
+
+var (
+	errUsage     = errors.New("usage error")
+	errNotFound  = errors.New("short URL not found")
+	errForbidden = errors.New("forbidden")
+)
+
+type command struct {
+	name    string
+	summary string
+	run     func(env *Env, args []string) error
+}
+
+// Env carries the streams a command reads from and writes to
+type Env struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+func commands() []command {
+	return []command{
+		{"serve", "start the HTTP server (default when no command is given)", runServe},
+		{"shorten", "shorten a URL", runShorten},
+		{"stats", "show statistics for a short code", runStats},
+		{"update", "point a short code at a new URL", runUpdate},
+		{"export", "stream raw click events as CSV or NDJSON", runExport},
+		{"backup", "write every link as JSON to stdout or a file", runBackup},
+		{"restore", "replace every link with the contents of a backup", runRestore},
+		{"import", "merge links from a backup into the store", runImport},
+		{"flush", "remove every link", runFlush},
+		{"migrate", "apply pending storage schema migrations", runMigrate},
+		{"gen-token", "create an API key (or a random secret with -raw)", runGenToken},
+	}
+}
+
+// Run dispatches args (without the program name) to a subcommand and returns
+// the process exit code. Flags without a command start the server so
+// existing invocations such as `url-shortener -port=8080` keep working.
+func Run(args []string, env *Env) int {
+	if env == nil {
+		env = &Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}
+	}
+
+	name := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		name, args = args[0], args[1:]
+	}
+
+	if name == "help" {
+		usage(env.Stdout)
+		return ExitOK
+	}
+
+	for _, cmd := range commands() {
+		if cmd.name != name {
+			continue
+		}
+
+		err := cmd.run(env, args)
+		if err != nil && !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintf(env.Stderr, "%s: %v\n", name, err)
+		}
+		return exitCode(err)
+	}
+
+	fmt.Fprintf(env.Stderr, "unknown command %q\n\n", name)
+	usage(env.Stderr)
+	return ExitUsage
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: url-shortener <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run `url-shortener <command> -h` for the flags of a command.")
+	fmt.Fprintf(w, "Exit codes: %d ok, %d error, %d usage, %d not found, %d forbidden\n",
+		ExitOK, ExitError, ExitUsage, ExitNotFound, ExitForbidden)
+}
+
+func exitCode(err error) int {
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return ExitOK
+	case errors.Is(err, errUsage):
+		return ExitUsage
+	case errors.Is(err, errNotFound):
+		return ExitNotFound
+	case errors.Is(err, errForbidden):
+		return ExitForbidden
+	default:
+		return ExitError
+	}
+}
+
+// usageErrorf reports a problem with the command line
+func usageErrorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errUsage, fmt.Sprintf(format, args...))
+}
+
+// adminFlags are shared by every command that manages links
+type adminFlags struct {
+	server   string
+	token    string
+	offline  bool
+	output   string
+	timeout  time.Duration
+	database string
+	dbPath   string
+	config   string
+}
+
+func newFlagSet(env *Env, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	return fs
+}
+
+func registerAdminFlags(fs *flag.FlagSet) *adminFlags {
+	f := &adminFlags{}
+	fs.StringVar(&f.server, "server", envOr("SHORTURL_SERVER", "http://localhost:8080"), "base URL of a running server")
+	fs.StringVar(&f.token, "token", os.Getenv("SUPERSCRT"), "auth token for the server")
+	fs.BoolVar(&f.offline, "offline", false, "operate directly on the configured store instead of a server")
+	fs.StringVar(&f.output, "output", "table", "output format: table or json")
+	fs.DurationVar(&f.timeout, "timeout", 30*time.Second, "timeout for the whole command")
+	fs.StringVar(&f.database, "database", "", "storage engine for -offline (memory or sqlite, defaults to $DATABASE)")
+	fs.StringVar(&f.dbPath, "database-path", "", "storage file for -offline (defaults to $DATABASE_PATH)")
+	fs.StringVar(&f.config, "config", os.Getenv("SHORTURL_CONFIG"), "config file for -offline, defaults to $SHORTURL_CONFIG")
+	return f
+}
+
+// parseFlags parses args, reporting bad flags as usage errors
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+	return nil
+}
+
+// parse parses args and checks the shared flags and the positional argument
+// count
+func (f *adminFlags) parse(fs *flag.FlagSet, args []string, nargs int) error {
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if fs.NArg() != nargs {
+		return usageErrorf("expected %d argument(s), got %d", nargs, fs.NArg())
+	}
+
+	if f.output != "table" && f.output != "json" {
+		return usageErrorf("unknown output format %q", f.output)
+	}
+
+	return nil
+}
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
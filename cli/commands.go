@@ -0,0 +1,489 @@
+package cli
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/pkg/analytics"
+	"github.com/thiagozs/go-shorturl/pkg/auth"
+	"github.com/thiagozs/go-shorturl/pkg/client"
+	"github.com/thiagozs/go-shorturl/pkg/utils"
+)
+
+func runShorten(env *Env, args []string) error {
+	fs := newFlagSet(env, "shorten")
+	f := registerAdminFlags(fs)
+	tagsFlag := fs.String("tags", "", "comma separated tags to attach to the link")
+	domainFlag := fs.String("domain", "", "short domain to create the link on, the primary one by default")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: url-shortener shorten [flags] <url>")
+		fs.PrintDefaults()
+	}
+	if err := f.parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	tags, err := utils.ParseTags(*tagsFlag)
+	if err != nil {
+		return usageErrorf("%v", err)
+	}
+
+	domain, err := parseDomainFlag(*domainFlag)
+	if err != nil {
+		return err
+	}
+
+	b, err := f.backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	originalURL := fs.Arg(0)
+	shortURL, err := b.Shorten(ctx, domain, originalURL, tags)
+	if err != nil {
+		return err
+	}
+
+	if f.output == "json" {
+		return printJSON(env.Stdout, map[string]string{
+			"short_url":    shortURL,
+			"original_url": originalURL,
+		})
+	}
+
+	return printTable(env.Stdout, []string{"SHORT URL", "ORIGINAL URL"},
+		[][]string{{shortURL, originalURL}})
+}
+
+func runStats(env *Env, args []string) error {
+	fs := newFlagSet(env, "stats")
+	f := registerAdminFlags(fs)
+	domainFlag := fs.String("domain", "", "short domain of the link, the primary one by default")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: url-shortener stats [flags] <code>")
+		fs.PrintDefaults()
+	}
+	if err := f.parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	domain, err := parseDomainFlag(*domainFlag)
+	if err != nil {
+		return err
+	}
+
+	b, err := f.backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	stats, err := b.Stats(ctx, domain, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	if f.output == "json" {
+		return printJSON(env.Stdout, stats)
+	}
+
+	return printTable(env.Stdout, []string{"FIELD", "VALUE"}, [][]string{
+		{"count", strconv.Itoa(stats.Count)},
+		{"bot_count", strconv.Itoa(stats.BotCount)},
+		{"last_ips", strings.Join(stats.LastIPs, ", ")},
+		{"referrers", strings.Join(stats.Referrers, ", ")},
+		{"last_geo_location", stats.LastGeoLocation},
+	})
+}
+
+func runUpdate(env *Env, args []string) error {
+	fs := newFlagSet(env, "update")
+	f := registerAdminFlags(fs)
+	domainFlag := fs.String("domain", "", "short domain of the link, the primary one by default")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: url-shortener update [flags] <code> <url>")
+		fs.PrintDefaults()
+	}
+	if err := f.parse(fs, args, 2); err != nil {
+		return err
+	}
+
+	domain, err := parseDomainFlag(*domainFlag)
+	if err != nil {
+		return err
+	}
+
+	b, err := f.backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	code, newURL := fs.Arg(0), fs.Arg(1)
+	if err := b.Update(ctx, domain, code, newURL); err != nil {
+		return err
+	}
+
+	if f.output == "json" {
+		return printJSON(env.Stdout, map[string]string{
+			"code":         code,
+			"domain":       domain,
+			"original_url": newURL,
+		})
+	}
+
+	return printTable(env.Stdout, []string{"CODE", "ORIGINAL URL"}, [][]string{{code, newURL}})
+}
+
+func runExport(env *Env, args []string) error {
+	fs := newFlagSet(env, "export")
+	f := registerAdminFlags(fs)
+	format := fs.String("format", analytics.FormatCSV, "export format: csv or ndjson")
+	code := fs.String("code", "", "only export clicks of this short code")
+	domainFlag := fs.String("domain", "", "short domain of -code, the primary one by default")
+	tag := fs.String("tag", "", "only export clicks of links with this tag")
+	from := fs.String("from", "", "only export clicks at or after this time (RFC 3339 or YYYY-MM-DD)")
+	to := fs.String("to", "", "only export clicks before this time (RFC 3339 or YYYY-MM-DD)")
+	includeBots := fs.Bool("include-bots", false, "also export bot hits")
+	file := fs.String("file", "", "write the export to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: url-shortener export [flags]")
+		fs.PrintDefaults()
+	}
+	if err := f.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	if *format != analytics.FormatCSV && *format != analytics.FormatNDJSON {
+		return usageErrorf("unknown format %q, use csv or ndjson", *format)
+	}
+
+	domain, err := parseDomainFlag(*domainFlag)
+	if err != nil {
+		return err
+	}
+
+	query := client.ExportQuery{
+		Format:      *format,
+		ShortURL:    *code,
+		Domain:      domain,
+		Tag:         strings.ToLower(*tag),
+		IncludeBots: *includeBots,
+	}
+
+	if *from != "" {
+		if query.From, err = analytics.ParseTime(*from); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+	if *to != "" {
+		if query.To, err = analytics.ParseTime(*to); err != nil {
+			return usageErrorf("%v", err)
+		}
+	}
+
+	b, err := f.backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	if *file == "" {
+		return b.Export(ctx, query, env.Stdout)
+	}
+
+	out, err := os.OpenFile(*file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+
+	if err := b.Export(ctx, query, out); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+func runBackup(env *Env, args []string) error {
+	fs := newFlagSet(env, "backup")
+	f := registerAdminFlags(fs)
+	file := fs.String("file", "", "write the backup to this file instead of stdout")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: url-shortener backup [flags]")
+		fs.PrintDefaults()
+	}
+	if err := f.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	b, err := f.backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	urls, err := b.Backup(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *file == "" {
+		return printURLs(env.Stdout, f.output, urls)
+	}
+
+	// Backup files are always JSON so they can be fed to restore and import
+	data, err := json.MarshalIndent(urls, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(*file, append(data, '\n'), 0o600)
+}
+
+func runImport(env *Env, args []string) error {
+	return loadBackup(env, "import", args, false)
+}
+
+func runRestore(env *Env, args []string) error {
+	return loadBackup(env, "restore", args, true)
+}
+
+// loadBackup reads a backup file ("-" for stdin) and imports it, replacing
+// every link in one step when replace is set
+func loadBackup(env *Env, name string, args []string, replace bool) error {
+	fs := newFlagSet(env, name)
+	f := registerAdminFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: url-shortener %s [flags] <file|->\n", name)
+		fs.PrintDefaults()
+	}
+	if err := f.parse(fs, args, 1); err != nil {
+		return err
+	}
+
+	urls, err := readBackup(env, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	b, err := f.backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	if replace {
+		err = b.Restore(ctx, urls)
+	} else {
+		err = b.Import(ctx, urls)
+	}
+	if err != nil {
+		return err
+	}
+
+	if f.output == "json" {
+		return printJSON(env.Stdout, map[string]int{"imported": len(urls)})
+	}
+
+	fmt.Fprintf(env.Stdout, "%d URL(s) imported\n", len(urls))
+	return nil
+}
+
+func readBackup(env *Env, path string) (map[string]string, error) {
+	var r io.Reader = env.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		r = file
+	}
+
+	urls := map[string]string{}
+	if err := json.NewDecoder(r).Decode(&urls); err != nil {
+		return nil, fmt.Errorf("invalid backup %s: %w", path, err)
+	}
+
+	return urls, nil
+}
+
+func runFlush(env *Env, args []string) error {
+	fs := newFlagSet(env, "flush")
+	f := registerAdminFlags(fs)
+	yes := fs.Bool("yes", false, "confirm removing every link")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: url-shortener flush -yes [flags]")
+		fs.PrintDefaults()
+	}
+	if err := f.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	if !*yes {
+		return usageErrorf("refusing to flush without -yes")
+	}
+
+	b, err := f.backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	urls, err := b.Flush(ctx)
+	if err != nil {
+		return err
+	}
+
+	return printURLs(env.Stdout, f.output, urls)
+}
+
+func runMigrate(env *Env, args []string) error {
+	fs := newFlagSet(env, "migrate")
+	f := registerAdminFlags(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: url-shortener migrate [flags]")
+		fmt.Fprintln(fs.Output(), "Always works on the configured store; -server and -offline are ignored.")
+		fs.PrintDefaults()
+	}
+	if err := f.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	cfg, db, err := f.openStore()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	version, err := db.Migrate()
+	if err != nil {
+		return err
+	}
+
+	if f.output == "json" {
+		return printJSON(env.Stdout, map[string]any{
+			"database":       db.Kind.String(),
+			"path":           cfg.GetDatabasePath(),
+			"schema_version": version,
+		})
+	}
+
+	return printTable(env.Stdout, []string{"DATABASE", "PATH", "SCHEMA VERSION"},
+		[][]string{{db.Kind.String(), cfg.GetDatabasePath(), strconv.Itoa(version)}})
+}
+
+func runGenToken(env *Env, args []string) error {
+	fs := newFlagSet(env, "gen-token")
+	f := registerAdminFlags(fs)
+	name := fs.String("name", "", "name of the API key to create")
+	scopesFlag := fs.String("scopes", auth.ScopeLinksWrite+","+auth.ScopeStatsRead,
+		"comma separated scopes: "+strings.Join(auth.Scopes(), ", "))
+	expires := fs.Duration("expires", 0, "lifetime of the key, e.g. 720h (0 never expires)")
+	raw := fs.Bool("raw", false, "only print a random secret, e.g. for SUPERSCRT, without storing a key")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: url-shortener gen-token -name <name> [flags]")
+		fmt.Fprintln(fs.Output(), "       url-shortener gen-token -raw")
+		fs.PrintDefaults()
+	}
+	if err := f.parse(fs, args, 0); err != nil {
+		return err
+	}
+
+	if *raw {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		fmt.Fprintln(env.Stdout, base64.RawURLEncoding.EncodeToString(b))
+		return nil
+	}
+
+	if *name == "" {
+		return usageErrorf("-name is required")
+	}
+
+	scopes, err := auth.ParseScopes(*scopesFlag)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUsage, err)
+	}
+
+	if *expires < 0 {
+		return usageErrorf("-expires cannot be negative")
+	}
+
+	b, err := f.backend()
+	if err != nil {
+		return err
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), f.timeout)
+	defer cancel()
+
+	key, token, err := b.CreateAPIKey(ctx, *name, scopes, *expires)
+	if err != nil {
+		return err
+	}
+
+	if f.output == "json" {
+		return printJSON(env.Stdout, map[string]any{"key": key, "token": token})
+	}
+
+	expiry := "never"
+	if key.ExpiresAt != nil {
+		expiry = key.ExpiresAt.Format(time.RFC3339)
+	}
+
+	if err := printTable(env.Stdout, []string{"ID", "NAME", "SCOPES", "EXPIRES"},
+		[][]string{{key.ID, key.Name, strings.Join(key.Scopes, ","), expiry}}); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(env.Stdout, "\nToken (shown only once): %s\n", token)
+	return nil
+}
+
+// parseDomainFlag normalizes a -domain flag, empty stays empty
+func parseDomainFlag(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	name, err := utils.ParseDomain(name)
+	if err != nil {
+		return "", usageErrorf("%v", err)
+	}
+	return name, nil
+}
@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// printJSON writes v as indented JSON
+func printJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// printTable writes rows under header, aligned in columns
+func printTable(w io.Writer, header []string, rows [][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// printURLs writes a short code to original URL map, sorted by code
+func printURLs(w io.Writer, format string, urls map[string]string) error {
+	if format == "json" {
+		return printJSON(w, urls)
+	}
+
+	codes := make([]string, 0, len(urls))
+	for code := range urls {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	rows := make([][]string, 0, len(codes))
+	for _, code := range codes {
+		rows = append(rows, []string{code, urls[code]})
+	}
+
+	return printTable(w, []string{"CODE", "ORIGINAL URL"}, rows)
+}
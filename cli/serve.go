@@ -0,0 +1,186 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/thiagozs/go-shorturl/config"
+	"github.com/thiagozs/go-shorturl/handler"
+	"github.com/thiagozs/go-shorturl/initialize"
+	"github.com/thiagozs/go-shorturl/pkg/lifecycle"
+	"github.com/thiagozs/go-shorturl/pkg/tracing"
+)
+
+// runServe starts the server. Settings come from, lowest precedence first,
+// the built-in defaults, the config file, the environment and the flags
+// given on the command line.
+func runServe(env *Env, args []string) error {
+	fs := newFlagSet(env, "serve")
+
+	configFlag := fs.String("config", os.Getenv("SHORTURL_CONFIG"), "config file (.yaml, .toml or .json), defaults to $SHORTURL_CONFIG")
+	printConfigFlag := fs.Bool("print-config", false, "print the effective configuration with secrets redacted and exit")
+	portFlag := fs.String("port", "", "port to listen on (default 8080)")
+	secretTokenFlag := fs.String("token", "", "bootstrap admin token, leave empty to only accept API keys")
+	domainFlag := fs.String("domain", "", "domain name (default localhost)")
+	useHttpsFlag := fs.Bool("https", false, "use https")
+	useLocalFlag := fs.Bool("local", true, "use local")
+
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	// loadConfig reads the configuration, at startup and on every reload
+	loadConfig := func() (*config.Config, error) {
+		cfg, err := config.Load(*configFlag)
+		if err != nil {
+			return nil, err
+		}
+
+		// Flags win over everything else, but only when given
+		fs.Visit(func(f *flag.Flag) {
+			switch f.Name {
+			case "port":
+				cfg.SetPort(*portFlag)
+			case "token":
+				cfg.SetToken(*secretTokenFlag)
+			case "domain":
+				cfg.SetDomain(*domainFlag)
+			case "https":
+				cfg.SetHTTPS(*useHttpsFlag)
+			case "local":
+				cfg.SetLocal(*useLocalFlag)
+			}
+		})
+
+		if err := cfg.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid configuration:\n%w", err)
+		}
+		return cfg, nil
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if *printConfigFlag {
+		return cfg.Print(env.Stdout)
+	}
+
+	// Initialize structured logger with JSON handler, the level follows the
+	// configuration across reloads.
+	// Records logged with a request context carry its trace and span IDs
+	level := new(slog.LevelVar)
+	level.Set(cfg.GetLog().LogLevel())
+	logger := slog.New(tracing.NewLogHandler(slog.NewJSONHandler(env.Stdout, &slog.HandlerOptions{Level: level})))
+
+	var init *initialize.Initialize
+	reload := func(ctx context.Context) ([]config.Change, error) {
+		next, err := loadConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		changes, err := init.Reload(next)
+		if err != nil {
+			return nil, err
+		}
+		level.Set(next.GetLog().LogLevel())
+		return changes, nil
+	}
+
+	init, err = initialize.NewInitialize(
+		initialize.WithLogger(logger),
+		initialize.WithConfig(cfg),
+		initialize.WithReloader(reload),
+	)
+	if err != nil {
+		return fmt.Errorf("create initialize: %w", err)
+	}
+
+	// Bootstrap the application
+	if err := init.Init(); err != nil {
+		return fmt.Errorf("initialize: %w", err)
+	}
+
+	shutdownCfg := cfg.GetShutdown()
+	lc, err := lifecycle.New(
+		lifecycle.WithLogger(logger),
+		lifecycle.WithDrainTimeout(shutdownCfg.Timeout),
+	)
+	if err != nil {
+		return fmt.Errorf("lifecycle: %w", err)
+	}
+
+	tracingCfg := cfg.GetTracing()
+	shutdownTracing, err := tracing.Setup(context.Background(),
+		tracing.WithExporter(tracingCfg.Exporter),
+		tracing.WithServiceName(tracingCfg.ServiceName),
+		tracing.WithSampleRatio(tracingCfg.SampleRatio),
+		// keep spans apart from the JSON logs on stdout
+		tracing.WithWriter(env.Stderr),
+	)
+	if err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+
+	// Shorten the variable name
+	api := init.GetParams().GetAPI()
+
+	// Register the server and endpoints
+	api.RegisterEndPoints()
+	api.RegisterServer()
+
+	// Components stop in reverse: the server drains first, then the
+	// connections and stores it used and last the spans they produced
+	lc.Add(lifecycle.Component{Name: "tracing", Stop: shutdownTracing})
+	lc.Add(init.Components()...)
+	lc.Add(lifecycle.Component{Name: "http", Start: api.Start, Stop: api.Shutdown, Err: api.Err()})
+	lc.Add(reloadOnHangup(logger, reload))
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	infoStart := fmt.Sprintf("Starting server on host:%s port:%s...", cfg.GetHost(), cfg.GetPort())
+	logger.Info(infoStart)
+
+	return lc.Run(ctx)
+}
+
+// reloadOnHangup reloads the configuration every time the process gets a
+// SIGHUP, for as long as the server runs
+func reloadOnHangup(logger *slog.Logger, reload handler.Reloader) lifecycle.Component {
+	hup := make(chan os.Signal, 1)
+	done := make(chan struct{})
+
+	return lifecycle.Component{
+		Name: "reload",
+		Start: func(context.Context) error {
+			signal.Notify(hup, syscall.SIGHUP)
+			go func() {
+				for {
+					select {
+					case <-hup:
+						logger.Info("Received SIGHUP, reloading configuration")
+						if _, err := reload(context.Background()); err != nil {
+							logger.Error("Failed to reload configuration", slog.String("error", err.Error()))
+						}
+					case <-done:
+						return
+					}
+				}
+			}()
+			return nil
+		},
+		Stop: func(context.Context) error {
+			signal.Stop(hup)
+			close(done)
+			return nil
+		},
+	}
+}
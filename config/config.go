@@ -1,73 +1,358 @@
 package config
 
-import "github.com/caarlos0/env/v9"
+import (
+	"log/slog"
+	"time"
+)
 
+// Config is the whole server configuration. Every field can be set from a
+// config file, using the yaml names of the sections and fields below, and
+// from the environment variable in its env tag. See Load for precedence.
 type Config struct {
-	Host   string `env:"HOST"`
-	Port   string `env:"PORT"`
-	Domain string `env:"DOMAIN"`
-	HTTPS  bool   `env:"HTTPS"`
-	Local  bool   `env:"LOCAL"`
-	Token  string `env:"SUPERSCRT"`
+	Server  ServerConfig    `yaml:"server"`
+	Log     LogConfig       `yaml:"log"`
+	Storage StorageConfig   `yaml:"storage"`
+	Auth    AuthConfig      `yaml:"auth"`
+	Limits  RateLimitConfig `yaml:"limits"`
+	Geo     GeoConfig       `yaml:"geo"`
+
+	CORSAPI      CORSConfig      `yaml:"cors_api" envPrefix:"CORS_API_"`
+	CORSRedirect CORSConfig      `yaml:"cors_redirect" envPrefix:"CORS_REDIRECT_"`
+	URLPolicy    URLPolicyConfig `yaml:"url_policy"`
+	Rules        RulesConfig     `yaml:"rules"`
+	Redirect     RedirectConfig  `yaml:"redirect"`
+	Bots         BotConfig       `yaml:"bots"`
+	Metrics      MetricsConfig   `yaml:"metrics"`
+	Tracing      TracingConfig   `yaml:"tracing"`
+	Shutdown     ShutdownConfig  `yaml:"shutdown"`
 }
 
-func NewConfig() (*Config, error) {
+// ServerConfig is where the server listens and how it builds short URLs
+type ServerConfig struct {
+	Host   string `yaml:"host" env:"HOST"`
+	Port   string `yaml:"port" env:"PORT" envDefault:"8080"`
+	Domain string `yaml:"domain" env:"DOMAIN" envDefault:"localhost"`
+	HTTPS  bool   `yaml:"https" env:"HTTPS"`
+	Local  bool   `yaml:"local" env:"LOCAL" envDefault:"true"`
+
+	// BaseURL is the public URL short links are built on, such as
+	// https://example.com/s/. Its path prefixes every route. Without it
+	// links use the domain, or the request host in local mode.
+	BaseURL string `yaml:"base_url" env:"BASE_URL"`
+
+	// TrustedProxies lists the CIDRs or addresses of the proxies whose
+	// Forwarded, X-Forwarded-For and X-Real-IP headers are believed
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" envSeparator:","`
+
+	TLS TLSConfig `yaml:"tls"`
+}
 
-	cfg := &Config{}
+// TLSConfig serves HTTPS natively. CertFiles and KeyFiles are paired by
+// position, the certificate matching the server name a client asks for is
+// served and the first one otherwise. The files are re-read when they
+// change. RedirectAddr starts a plain HTTP listener that redirects to HTTPS.
+type TLSConfig struct {
+	CertFiles      []string      `yaml:"cert_files" env:"TLS_CERT_FILES" envSeparator:","`
+	KeyFiles       []string      `yaml:"key_files" env:"TLS_KEY_FILES" envSeparator:","`
+	MinVersion     string        `yaml:"min_version" env:"TLS_MIN_VERSION" envDefault:"1.2"`
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"TLS_RELOAD_INTERVAL" envDefault:"1m"`
+	RedirectAddr   string        `yaml:"redirect_addr" env:"TLS_REDIRECT_ADDR"`
+}
+
+// Enabled reports whether the server listens with TLS
+func (t TLSConfig) Enabled() bool {
+	return len(t.CertFiles) > 0
+}
+
+// LogConfig sets the lowest level of the records logged: debug, info, warn
+// or error
+type LogConfig struct {
+	Level string `yaml:"level" env:"LOG_LEVEL" envDefault:"info"`
+}
 
-	if err := env.Parse(cfg); err != nil {
-		return cfg, err
+// LogLevel parses Level, falling back to info
+func (l LogConfig) LogLevel() slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(l.Level)); err != nil {
+		return slog.LevelInfo
 	}
+	return level
+}
+
+// StorageConfig selects the storage engine, memory or sqlite. The path is
+// only used by sqlite.
+type StorageConfig struct {
+	Driver string `yaml:"driver" env:"DATABASE" envDefault:"memory"`
+	Path   string `yaml:"path" env:"DATABASE_PATH" envDefault:"./shorturl.db"`
+}
+
+// AuthConfig holds the bootstrap admin token and the JWT verification.
+// Without a token only API keys and JWTs are accepted.
+type AuthConfig struct {
+	Token string    `yaml:"token" env:"SUPERSCRT"`
+	JWT   JWTConfig `yaml:"jwt"`
+}
+
+// ShutdownConfig bounds graceful shutdown. The readiness probe fails for
+// Delay before the listener closes, then in-flight requests, workers and
+// stores have Timeout in total to finish.
+type ShutdownConfig struct {
+	Timeout time.Duration `yaml:"timeout" env:"SHUTDOWN_TIMEOUT" envDefault:"30s"`
+	Delay   time.Duration `yaml:"delay" env:"SHUTDOWN_DELAY" envDefault:"0s"`
+}
+
+// TracingConfig selects the OpenTelemetry span exporter: none, stdout or
+// otlp. The OTLP endpoint is read from the standard OTEL_EXPORTER_OTLP_*
+// variables.
+type TracingConfig struct {
+	Exporter    string  `yaml:"exporter" env:"TRACING_EXPORTER" envDefault:"none"`
+	ServiceName string  `yaml:"service_name" env:"TRACING_SERVICE_NAME" envDefault:"go-shorturl"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" envDefault:"1"`
+}
+
+// MetricsConfig controls the Prometheus endpoint. Without an address
+// /metrics is served by the API listener and needs the metrics:read scope.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" env:"METRICS_ENABLED" envDefault:"true"`
+	Addr    string `yaml:"addr" env:"METRICS_ADDR"`
+}
+
+// BotConfig controls how bot hits are told apart from human clicks.
+// Patterns are case-insensitive substrings of the user agent added to the
+// built-in list, unless DefaultPatterns is turned off.
+type BotConfig struct {
+	Detect          bool     `yaml:"detect" env:"BOT_DETECTION" envDefault:"true"`
+	Patterns        []string `yaml:"patterns" env:"BOT_PATTERNS" envSeparator:","`
+	DefaultPatterns bool     `yaml:"default_patterns" env:"BOT_DEFAULT_PATTERNS" envDefault:"true"`
+}
+
+// GeoConfig selects how click locations are resolved: "http" queries
+// HTTPURL (ip-api.com by default), "maxmind" reads a local .mmdb file and
+// "none" skips lookups. Results are kept in an LRU cache.
+type GeoConfig struct {
+	Provider  string        `yaml:"provider" env:"GEO_PROVIDER" envDefault:"http"`
+	HTTPURL   string        `yaml:"http_url" env:"GEO_HTTP_URL" envDefault:"http://ip-api.com/json/"`
+	MaxMindDB string        `yaml:"maxmind_db" env:"GEO_MAXMIND_DB"`
+	Language  string        `yaml:"language" env:"GEO_LANGUAGE" envDefault:"en"`
+	Timeout   time.Duration `yaml:"timeout" env:"GEO_TIMEOUT" envDefault:"2s"`
+	CacheSize int           `yaml:"cache_size" env:"GEO_CACHE_SIZE" envDefault:"10000"`
+	CacheTTL  time.Duration `yaml:"cache_ttl" env:"GEO_CACHE_TTL" envDefault:"1h"`
+}
+
+// RulesConfig points at the blocklist and allowlist rule files. Links whose
+// destination becomes blocked after creation get a warning page ("warn") or
+// a 451 response ("451") depending on BlockedAction.
+type RulesConfig struct {
+	Blocklists     []string      `yaml:"blocklist_files" env:"RULES_BLOCKLIST_FILES" envSeparator:","`
+	Allowlists     []string      `yaml:"allowlist_files" env:"RULES_ALLOWLIST_FILES" envSeparator:","`
+	AllowlistOnly  bool          `yaml:"allowlist_only" env:"RULES_ALLOWLIST_ONLY"`
+	ReloadInterval time.Duration `yaml:"reload_interval" env:"RULES_RELOAD_INTERVAL" envDefault:"30s"`
+	BlockedAction  string        `yaml:"blocked_action" env:"RULES_BLOCKED_ACTION" envDefault:"warn"`
+}
+
+// Enabled reports whether any rule applies
+func (r RulesConfig) Enabled() bool {
+	return len(r.Blocklists) > 0 || len(r.Allowlists) > 0 || r.AllowlistOnly
+}
+
+// RedirectConfig holds the defaults of links that do not set their own.
+// QueryPolicy is what happens to the query string of a click: drop, append
+// or override. Permanent (301 and 308) redirects are cached by browsers for
+// PermanentMaxAge, clicks within it are not seen. ScanSecret signs the
+// links encoded in tracked QR codes, scans cannot be tracked without it.
+type RedirectConfig struct {
+	QueryPolicy     string        `yaml:"query_policy" env:"REDIRECT_QUERY_POLICY" envDefault:"drop"`
+	PermanentMaxAge time.Duration `yaml:"permanent_max_age" env:"REDIRECT_PERMANENT_MAX_AGE" envDefault:"24h"`
+	ScanSecret      string        `yaml:"scan_secret" env:"REDIRECT_SCAN_SECRET"`
+}
+
+// URLPolicyConfig restricts the destinations links may point at. The
+// configured Domain is always treated as a self domain.
+type URLPolicyConfig struct {
+	AllowedSchemes []string `yaml:"allowed_schemes" env:"URL_ALLOWED_SCHEMES" envSeparator:"," envDefault:"http,https"`
+	MaxLength      int      `yaml:"max_length" env:"URL_MAX_LENGTH" envDefault:"2048"`
+	BlockPrivate   bool     `yaml:"block_private" env:"URL_BLOCK_PRIVATE" envDefault:"true"`
+	ResolveHosts   bool     `yaml:"resolve_hosts" env:"URL_RESOLVE_HOSTS"`
+	SelfDomains    []string `yaml:"self_domains" env:"URL_SELF_DOMAINS" envSeparator:","`
+}
+
+// CORSConfig is the CORS policy of a route group. Origins accept exact
+// origins, wildcard subdomains ("https://*.example.com") or "*".
+type CORSConfig struct {
+	Origins        []string      `yaml:"origins" env:"ORIGINS" envSeparator:","`
+	Methods        []string      `yaml:"methods" env:"METHODS" envSeparator:","`
+	Headers        []string      `yaml:"headers" env:"HEADERS" envSeparator:","`
+	ExposedHeaders []string      `yaml:"exposed_headers" env:"EXPOSED_HEADERS" envSeparator:","`
+	Credentials    bool          `yaml:"credentials" env:"CREDENTIALS"`
+	MaxAge         time.Duration `yaml:"max_age" env:"MAX_AGE"`
+}
+
+// RateLimitConfig holds a "<count>/<period>" policy per route group, e.g.
+// "60/1m". Groups without a policy are not limited. Buckets are kept in
+// memory unless a Redis address is set.
+type RateLimitConfig struct {
+	API           string `yaml:"api" env:"RATE_LIMIT_API"`
+	APIBurst      int    `yaml:"api_burst" env:"RATE_LIMIT_API_BURST"`
+	Redirect      string `yaml:"redirect" env:"RATE_LIMIT_REDIRECT"`
+	RedirectBurst int    `yaml:"redirect_burst" env:"RATE_LIMIT_REDIRECT_BURST"`
+	RedisAddr     string `yaml:"redis_addr" env:"RATE_LIMIT_REDIS_ADDR"`
+	RedisPassword string `yaml:"redis_password" env:"RATE_LIMIT_REDIS_PASSWORD"`
+}
+
+// JWTConfig enables bearer token authentication when a JWKS file, a JWKS
+// URL or an HMAC secret is set
+type JWTConfig struct {
+	JWKSFile     string            `yaml:"jwks_file" env:"JWT_JWKS_FILE"`
+	JWKSURL      string            `yaml:"jwks_url" env:"JWT_JWKS_URL"`
+	JWKSTTL      time.Duration     `yaml:"jwks_ttl" env:"JWT_JWKS_TTL" envDefault:"10m"`
+	HMACSecret   string            `yaml:"hmac_secret" env:"JWT_HMAC_SECRET"`
+	Issuer       string            `yaml:"issuer" env:"JWT_ISSUER"`
+	Audience     string            `yaml:"audience" env:"JWT_AUDIENCE"`
+	ScopesClaim  string            `yaml:"scopes_claim" env:"JWT_SCOPES_CLAIM" envDefault:"scope"`
+	SubjectClaim string            `yaml:"subject_claim" env:"JWT_SUBJECT_CLAIM" envDefault:"sub"`
+	ScopeMap     map[string]string `yaml:"scope_map" env:"JWT_SCOPE_MAP" envKeyValSeparator:"="`
+}
+
+// Enabled reports whether any source of verification keys is configured
+func (j JWTConfig) Enabled() bool {
+	return j.JWKSFile != "" || j.JWKSURL != "" || j.HMACSecret != ""
+}
 
-	return cfg, nil
+// NewConfig loads the configuration from the defaults and the environment
+func NewConfig() (*Config, error) {
+	return Load("")
 }
 
+// getters -----
+
 func (c *Config) GetHost() string {
-	return c.Host
+	return c.Server.Host
 }
 
 func (c *Config) GetPort() string {
-	return c.Port
+	return c.Server.Port
 }
 
 func (c *Config) GetDomain() string {
-	return c.Domain
+	return c.Server.Domain
 }
 
+// GetHTTPS reports whether short URLs use https, always true when the
+// server terminates TLS itself
 func (c *Config) GetHTTPS() bool {
-	return c.HTTPS
+	return c.Server.HTTPS || c.Server.TLS.Enabled()
+}
+
+func (c *Config) GetBaseURL() string {
+	return c.Server.BaseURL
 }
 
 func (c *Config) GetLocal() bool {
-	return c.Local
+	return c.Server.Local
 }
 
 func (c *Config) GetToken() string {
-	return c.Token
+	return c.Auth.Token
+}
+
+func (c *Config) GetTLS() TLSConfig {
+	return c.Server.TLS
+}
+
+func (c *Config) GetLog() LogConfig {
+	return c.Log
+}
+
+func (c *Config) GetTrustedProxies() []string {
+	return c.Server.TrustedProxies
+}
+
+func (c *Config) GetDatabase() string {
+	return c.Storage.Driver
+}
+
+func (c *Config) GetDatabasePath() string {
+	return c.Storage.Path
+}
+
+func (c *Config) GetJWT() JWTConfig {
+	return c.Auth.JWT
+}
+
+func (c *Config) GetRateLimit() RateLimitConfig {
+	return c.Limits
+}
+
+func (c *Config) GetCORSAPI() CORSConfig {
+	return c.CORSAPI
+}
+
+func (c *Config) GetCORSRedirect() CORSConfig {
+	return c.CORSRedirect
+}
+
+func (c *Config) GetURLPolicy() URLPolicyConfig {
+	return c.URLPolicy
+}
+
+func (c *Config) GetRules() RulesConfig {
+	return c.Rules
+}
+
+func (c *Config) GetRedirect() RedirectConfig {
+	return c.Redirect
+}
+
+func (c *Config) GetGeo() GeoConfig {
+	return c.Geo
+}
+
+func (c *Config) GetBots() BotConfig {
+	return c.Bots
+}
+
+func (c *Config) GetMetrics() MetricsConfig {
+	return c.Metrics
+}
+
+func (c *Config) GetTracing() TracingConfig {
+	return c.Tracing
+}
+
+func (c *Config) GetShutdown() ShutdownConfig {
+	return c.Shutdown
 }
 
 // setters -----
 
 func (c *Config) SetHost(host string) {
-	c.Host = host
+	c.Server.Host = host
 }
 
 func (c *Config) SetPort(port string) {
-	c.Port = port
+	c.Server.Port = port
 }
 
 func (c *Config) SetDomain(domain string) {
-	c.Domain = domain
+	c.Server.Domain = domain
 }
 
 func (c *Config) SetHTTPS(https bool) {
-	c.HTTPS = https
+	c.Server.HTTPS = https
 }
 
 func (c *Config) SetLocal(local bool) {
-	c.Local = local
+	c.Server.Local = local
 }
 
 func (c *Config) SetToken(token string) {
-	c.Token = token
+	c.Auth.Token = token
+}
+
+func (c *Config) SetDatabase(database string) {
+	c.Storage.Driver = database
+}
+
+func (c *Config) SetDatabasePath(path string) {
+	c.Storage.Path = path
 }
@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Change is a setting that differs between two configurations, named by its
+// config file path. Secrets show as REDACTED.
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// secrets are hidden in a Change, the way Redacted hides them when printing
+var secrets = map[string]bool{
+	"auth.token":            true,
+	"auth.jwt.hmac_secret":  true,
+	"limits.redis_password": true,
+	"redirect.scan_secret":  true,
+}
+
+// restartOnly are the fields read once at startup, a reload cannot change
+// them. Entries ending in a dot cover a whole section.
+var restartOnly = []string{
+	"server.host",
+	"server.port",
+	"server.tls.",
+	"storage.",
+	"geo.",
+	"metrics.",
+	"tracing.",
+	"shutdown.",
+	"limits.redis_addr",
+	"limits.redis_password",
+}
+
+// RestartOnly reports whether changing field needs a restart
+func RestartOnly(field string) bool {
+	for _, f := range restartOnly {
+		if field == f || strings.HasSuffix(f, ".") && strings.HasPrefix(field, f) {
+			return true
+		}
+	}
+	return false
+}
+
+// Diff lists the settings that differ from old to new, in file order
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	diff(reflect.ValueOf(*old), reflect.ValueOf(*new), "", &changes)
+	return changes
+}
+
+func diff(old, new reflect.Value, prefix string, changes *[]Change) {
+	t := old.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+		path := prefix + name
+
+		a, b := old.Field(i), new.Field(i)
+		if a.Kind() == reflect.Struct {
+			diff(a, b, path+".", changes)
+			continue
+		}
+
+		if reflect.DeepEqual(a.Interface(), b.Interface()) {
+			continue
+		}
+		*changes = append(*changes, Change{Field: path, Old: show(path, a), New: show(path, b)})
+	}
+}
+
+// show formats a setting for a Change, hiding secrets
+func show(path string, v reflect.Value) string {
+	s := fmt.Sprint(v.Interface())
+	if secrets[path] && s != "" {
+		return redacted
+	}
+	return s
+}
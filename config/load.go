@@ -0,0 +1,203 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/caarlos0/env/v9"
+	"gopkg.in/yaml.v3"
+)
+
+// Load builds the configuration from, lowest precedence first:
+//
+//  1. the built-in defaults
+//  2. the config file at path, skipped when path is empty
+//  3. the environment variables that are set
+//
+// Command-line flags are applied on top by the caller. The file format
+// follows its extension: .yaml, .yml, .toml or .json. Unknown keys in the
+// file are errors so typos do not go unnoticed.
+func Load(path string) (*Config, error) {
+	cfg, err := defaults()
+	if err != nil {
+		return nil, err
+	}
+
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := overlayEnv(cfg, environ()); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// defaults returns the configuration used when nothing else is set
+func defaults() (*Config, error) {
+	// The admin API only accepts cross-origin calls from configured origins,
+	// while anyone may follow a redirect
+	cfg := &Config{
+		CORSAPI: CORSConfig{
+			Methods:        []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			Headers:        []string{"Content-Type", "Authorization", "X-Auth-Token"},
+			ExposedHeaders: []string{"RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
+			MaxAge:         10 * time.Minute,
+		},
+		CORSRedirect: CORSConfig{
+			Origins: []string{"*"},
+			Methods: []string{"GET", "HEAD", "OPTIONS"},
+			MaxAge:  10 * time.Minute,
+		},
+	}
+
+	// An empty environment leaves only the envDefault tags
+	if err := env.ParseWithOptions(cfg, env.Options{Environment: map[string]string{}}); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile decodes the config file at path over cfg. JSON and TOML are
+// converted to YAML first so every format gets the same field names and
+// duration parsing.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config file: %w", err)
+	}
+
+	var doc map[string]any
+	ext := strings.ToLower(filepath.Ext(path))
+	switch ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &doc)
+	case ".json":
+		err = json.Unmarshal(data, &doc)
+	case ".toml":
+		err = toml.Unmarshal(data, &doc)
+	default:
+		return fmt.Errorf("config file %s: unsupported format %q, use .yaml, .toml or .json", path, ext)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	if err := checkDurations(reflect.TypeOf(*cfg), doc, ""); err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	// YAML is decoded as written so errors point at its lines
+	if ext == ".json" || ext == ".toml" {
+		if data, err = yaml.Marshal(doc); err != nil {
+			return fmt.Errorf("config file %s: %w", path, err)
+		}
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	return nil
+}
+
+// checkDurations rejects numbers given for the duration fields of t found
+// in doc. A bare 30 has no unit, JSON and TOML users would otherwise be left
+// guessing between seconds and nanoseconds.
+func checkDurations(t reflect.Type, doc map[string]any, prefix string) error {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+
+		value, ok := doc[name]
+		if !ok || value == nil {
+			continue
+		}
+
+		switch {
+		case field.Type == reflect.TypeOf(time.Duration(0)):
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("%s%s: duration %v needs a unit, such as \"30s\" or \"5m\"", prefix, name, value)
+			}
+		case field.Type.Kind() == reflect.Struct:
+			if section, ok := value.(map[string]any); ok {
+				if err := checkDurations(field.Type, section, prefix+name+"."); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// overlayEnv sets the fields of cfg whose environment variable is set.
+// Parsing straight into cfg would reset the fields the file set back to
+// their envDefault, so the environment is parsed on its own and only the
+// variables present are copied over.
+func overlayEnv(cfg *Config, environment map[string]string) error {
+	fromEnv, err := defaults()
+	if err != nil {
+		return err
+	}
+
+	set := map[string]bool{}
+	err = env.ParseWithOptions(fromEnv, env.Options{
+		Environment: environment,
+		// OnSet also runs for variables that are not set at all
+		OnSet: func(key string, _ any, isDefault bool) {
+			if _, ok := environment[key]; ok && !isDefault {
+				set[key] = true
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	copySet(reflect.ValueOf(cfg).Elem(), reflect.ValueOf(fromEnv).Elem(), "", set)
+	return nil
+}
+
+// copySet copies the fields of src whose env key is in set to dst,
+// following nested sections and their envPrefix
+func copySet(dst, src reflect.Value, prefix string, set map[string]bool) {
+	t := dst.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		if field.Type.Kind() == reflect.Struct {
+			copySet(dst.Field(i), src.Field(i), prefix+field.Tag.Get("envPrefix"), set)
+			continue
+		}
+
+		if key := field.Tag.Get("env"); key != "" && set[prefix+key] {
+			dst.Field(i).Set(src.Field(i))
+		}
+	}
+}
+
+func environ() map[string]string {
+	vars := map[string]string{}
+	for _, kv := range os.Environ() {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+	return vars
+}
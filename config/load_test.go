@@ -0,0 +1,191 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile writes content to name in a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// loadDefaults decodes the file at path over the defaults
+func loadDefaults(t *testing.T, path string) (*Config, error) {
+	t.Helper()
+
+	cfg, err := defaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg, loadFile(path, cfg)
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	files := map[string]string{
+		"config.yaml": `
+server:
+  port: "9090"
+  domain: sho.rt
+  trusted_proxies: [10.0.0.0/8]
+auth:
+  jwt:
+    scope_map: {admin: "links:write"}
+cors_api:
+  origins: ["https://app.example"]
+  max_age: 1h
+shutdown:
+  delay: 5s
+`,
+		"config.toml": `
+[server]
+port = "9090"
+domain = "sho.rt"
+trusted_proxies = ["10.0.0.0/8"]
+
+[auth.jwt.scope_map]
+admin = "links:write"
+
+[cors_api]
+origins = ["https://app.example"]
+max_age = "1h"
+
+[shutdown]
+delay = "5s"
+`,
+		"config.json": `{
+  "server": {"port": "9090", "domain": "sho.rt", "trusted_proxies": ["10.0.0.0/8"]},
+  "auth": {"jwt": {"scope_map": {"admin": "links:write"}}},
+  "cors_api": {"origins": ["https://app.example"], "max_age": "1h"},
+  "shutdown": {"delay": "5s"}
+}`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := loadDefaults(t, writeFile(t, name, content))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if cfg.GetPort() != "9090" || cfg.GetDomain() != "sho.rt" {
+				t.Fatalf("server = %+v, want port 9090 on sho.rt", cfg.Server)
+			}
+			if !slices.Equal(cfg.GetTrustedProxies(), []string{"10.0.0.0/8"}) {
+				t.Fatalf("trusted_proxies = %v", cfg.GetTrustedProxies())
+			}
+			if got := cfg.GetJWT().ScopeMap["admin"]; got != "links:write" {
+				t.Fatalf("scope_map[admin] = %q, want links:write", got)
+			}
+			if api := cfg.GetCORSAPI(); !slices.Equal(api.Origins, []string{"https://app.example"}) || api.MaxAge != time.Hour {
+				t.Fatalf("cors_api = %+v", api)
+			}
+			if sd := cfg.GetShutdown(); sd.Delay != 5*time.Second || sd.Timeout != 30*time.Second {
+				t.Fatalf("shutdown = %+v, want 5s delay and the default 30s timeout", sd)
+			}
+
+			// Fields missing from the file keep their defaults
+			if cfg.GetDatabase() != "memory" || len(cfg.GetCORSAPI().Methods) == 0 {
+				t.Fatalf("defaults lost: storage %+v, cors_api methods %v", cfg.Storage, cfg.GetCORSAPI().Methods)
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{name: "yaml numeric duration", file: "c.yaml", content: "shutdown:\n  delay: 30\n", wantErr: "shutdown.delay: duration 30 needs a unit"},
+		{name: "toml numeric duration", file: "c.toml", content: "[shutdown]\ndelay = 30\n", wantErr: "shutdown.delay: duration 30 needs a unit"},
+		{name: "json numeric duration", file: "c.json", content: `{"shutdown": {"delay": 30}}`, wantErr: "shutdown.delay: duration 30 needs a unit"},
+		{name: "nested numeric duration", file: "c.json", content: `{"auth": {"jwt": {"jwks_ttl": 1.5}}}`, wantErr: "auth.jwt.jwks_ttl: duration 1.5 needs a unit"},
+		{name: "toml time", file: "c.toml", content: "[geo]\ntimeout = 00:00:02\n", wantErr: "geo.timeout"},
+		{name: "yaml unknown key", file: "c.yml", content: "server:\n  prot: 80\n", wantErr: "field prot not found"},
+		{name: "toml unknown key", file: "c.toml", content: "[server]\nprot = 80\n", wantErr: "field prot not found"},
+		{name: "json unknown section", file: "c.json", content: `{"sever": {}}`, wantErr: "field sever not found"},
+		{name: "yaml bad duration", file: "c.yaml", content: "shutdown:\n  delay: soon\n", wantErr: "soon"},
+		{name: "malformed json", file: "c.json", content: `{"server":`, wantErr: "unexpected end"},
+		{name: "malformed toml", file: "c.toml", content: "[server\n", wantErr: "c.toml"},
+		{name: "unsupported format", file: "c.ini", content: "port=1", wantErr: `unsupported format ".ini"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadDefaults(t, writeFile(t, tt.file, tt.content))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("loadFile error = %v, want it to contain %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := loadDefaults(t, filepath.Join(t.TempDir(), "none.yaml")); err == nil {
+		t.Fatal("loadFile error = nil for a missing file")
+	}
+}
+
+func TestLoadFileEmpty(t *testing.T) {
+	cfg, err := loadDefaults(t, writeFile(t, "empty.yaml", "# nothing set\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.GetPort() != "8080" {
+		t.Fatalf("port = %q, want the default 8080", cfg.GetPort())
+	}
+}
+
+func TestOverlayEnv(t *testing.T) {
+	cfg, err := loadDefaults(t, writeFile(t, "c.yaml", `
+server:
+  port: "9090"
+  domain: file.example
+cors_api:
+  origins: ["https://file.example"]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = overlayEnv(cfg, map[string]string{
+		"DOMAIN":            "env.example",
+		"CORS_API_ORIGINS":  "https://a.example,https://b.example",
+		"SHUTDOWN_DELAY":    "2s",
+		"UNRELATED_SETTING": "x",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.GetDomain() != "env.example" {
+		t.Fatalf("domain = %q, want the environment to win", cfg.GetDomain())
+	}
+	if cfg.GetPort() != "9090" {
+		t.Fatalf("port = %q, want the file value kept when PORT is unset", cfg.GetPort())
+	}
+	if got := cfg.GetCORSAPI().Origins; !slices.Equal(got, []string{"https://a.example", "https://b.example"}) {
+		t.Fatalf("cors_api.origins = %v", got)
+	}
+	if got := cfg.GetCORSRedirect().Origins; !slices.Equal(got, []string{"*"}) {
+		t.Fatalf("cors_redirect.origins = %v, want the default", got)
+	}
+	if cfg.GetShutdown().Delay != 2*time.Second {
+		t.Fatalf("shutdown.delay = %s, want 2s", cfg.GetShutdown().Delay)
+	}
+
+	if err := overlayEnv(cfg, map[string]string{"SHUTDOWN_DELAY": "30"}); err == nil {
+		t.Fatal("overlayEnv error = nil for a duration without a unit")
+	}
+}
@@ -0,0 +1,166 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"strconv"
+
+	"github.com/thiagozs/go-shorturl/pkg/baseurl"
+	"github.com/thiagozs/go-shorturl/pkg/ratelimit"
+	"github.com/thiagozs/go-shorturl/pkg/realip"
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in printed configurations
+const redacted = "REDACTED"
+
+// Validate checks the whole configuration and returns every problem found,
+// each prefixed with the file path of the field
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, field, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port <= 65535, "server.port", "invalid port %q", c.Server.Port)
+	if c.Server.BaseURL != "" {
+		if _, err := baseurl.Parse(c.Server.BaseURL); err != nil {
+			check(false, "server.base_url", "%v", err)
+		}
+	}
+	if _, err := realip.New(c.Server.TrustedProxies); err != nil {
+		check(false, "server.trusted_proxies", "%v", err)
+	}
+
+	tls := c.Server.TLS
+	check(len(tls.CertFiles) == len(tls.KeyFiles), "server.tls.key_files",
+		"got %d key files for %d cert files", len(tls.KeyFiles), len(tls.CertFiles))
+	check(tls.MinVersion == "1.2" || tls.MinVersion == "1.3",
+		"server.tls.min_version", "unsupported version %q, use 1.2 or 1.3", tls.MinVersion)
+	check(tls.ReloadInterval > 0, "server.tls.reload_interval", "must be positive")
+	if tls.RedirectAddr != "" {
+		_, _, err := net.SplitHostPort(tls.RedirectAddr)
+		check(err == nil, "server.tls.redirect_addr", "invalid address %q", tls.RedirectAddr)
+		check(tls.Enabled(), "server.tls.redirect_addr", "requires server.tls.cert_files")
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		check(false, "log.level", "unknown level %q, use debug, info, warn or error", c.Log.Level)
+	}
+
+	switch c.Storage.Driver {
+	case "memory":
+	case "sqlite":
+		check(c.Storage.Path != "", "storage.path", "required by the sqlite driver")
+	default:
+		check(false, "storage.driver", "unknown driver %q, use memory or sqlite", c.Storage.Driver)
+	}
+
+	jwt := c.Auth.JWT
+	check(jwt.JWKSURL == "" || jwt.JWKSTTL > 0, "auth.jwt.jwks_ttl", "must be positive")
+	check(jwt.ScopesClaim != "", "auth.jwt.scopes_claim", "cannot be empty")
+
+	for _, g := range []struct {
+		field, rate string
+		burst       int
+	}{
+		{"limits.api", c.Limits.API, c.Limits.APIBurst},
+		{"limits.redirect", c.Limits.Redirect, c.Limits.RedirectBurst},
+	} {
+		if g.rate != "" {
+			if _, err := ratelimit.ParsePolicy(g.rate, g.burst); err != nil {
+				check(false, g.field, "%v", err)
+			}
+		}
+		check(g.burst >= 0, g.field+"_burst", "cannot be negative")
+	}
+
+	switch c.Geo.Provider {
+	case "none":
+	case "http":
+		check(c.Geo.HTTPURL != "", "geo.http_url", "required by the http provider")
+	case "maxmind":
+		check(c.Geo.MaxMindDB != "", "geo.maxmind_db", "required by the maxmind provider")
+	default:
+		check(false, "geo.provider", "unknown provider %q, use http, maxmind or none", c.Geo.Provider)
+	}
+	check(c.Geo.Timeout > 0, "geo.timeout", "must be positive")
+	check(c.Geo.CacheSize > 0, "geo.cache_size", "must be positive")
+
+	for _, cors := range []struct {
+		field string
+		cfg   CORSConfig
+	}{{"cors_api", c.CORSAPI}, {"cors_redirect", c.CORSRedirect}} {
+		check(!cors.cfg.Credentials || !slices.Contains(cors.cfg.Origins, "*"),
+			cors.field+".credentials", "cannot be combined with the * origin, list the allowed origins")
+	}
+
+	check(len(c.URLPolicy.AllowedSchemes) > 0, "url_policy.allowed_schemes", "cannot be empty")
+	check(c.URLPolicy.MaxLength > 0, "url_policy.max_length", "must be positive")
+
+	check(c.Rules.BlockedAction == "warn" || c.Rules.BlockedAction == "451",
+		"rules.blocked_action", "unknown action %q, use warn or 451", c.Rules.BlockedAction)
+	check(c.Rules.ReloadInterval > 0, "rules.reload_interval", "must be positive")
+
+	switch c.Redirect.QueryPolicy {
+	case "drop", "append", "override":
+	default:
+		check(false, "redirect.query_policy", "unknown policy %q, use drop, append or override", c.Redirect.QueryPolicy)
+	}
+	check(c.Redirect.PermanentMaxAge >= 0, "redirect.permanent_max_age", "cannot be negative")
+
+	if c.Metrics.Addr != "" {
+		_, _, err := net.SplitHostPort(c.Metrics.Addr)
+		check(err == nil, "metrics.addr", "invalid address %q", c.Metrics.Addr)
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout", "otlp":
+	default:
+		check(false, "tracing.exporter", "unknown exporter %q, use none, stdout or otlp", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1,
+		"tracing.sample_ratio", "must be between 0 and 1")
+
+	check(c.Shutdown.Timeout > 0, "shutdown.timeout", "must be positive")
+	check(c.Shutdown.Delay >= 0 && c.Shutdown.Delay < c.Shutdown.Timeout,
+		"shutdown.delay", "must be shorter than shutdown.timeout")
+
+	return errors.Join(errs...)
+}
+
+// Redacted returns a copy of the configuration with its secrets replaced
+func (c *Config) Redacted() *Config {
+	out := *c
+
+	hide := func(s *string) {
+		if *s != "" {
+			*s = redacted
+		}
+	}
+	hide(&out.Auth.Token)
+	hide(&out.Auth.JWT.HMACSecret)
+	hide(&out.Limits.RedisPassword)
+	hide(&out.Redirect.ScanSecret)
+
+	return &out
+}
+
+// Print writes the configuration as YAML, in the config file layout, with
+// its secrets redacted
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c.Redacted()); err != nil {
+		return err
+	}
+	return enc.Close()
+}
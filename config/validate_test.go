@@ -0,0 +1,99 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr string
+	}{
+		{name: "defaults", change: func(c *Config) {}},
+		{name: "port", change: func(c *Config) { c.Server.Port = "70000" }, wantErr: "server.port"},
+		{name: "base url", change: func(c *Config) { c.Server.BaseURL = "ftp://sho.rt" }, wantErr: "server.base_url"},
+		{name: "trusted proxies", change: func(c *Config) { c.Server.TrustedProxies = []string{"proxy.lan"} }, wantErr: "server.trusted_proxies"},
+		{name: "tls pairs", change: func(c *Config) { c.Server.TLS.CertFiles = []string{"a.pem"} }, wantErr: "server.tls.key_files"},
+		{name: "tls redirect without tls", change: func(c *Config) { c.Server.TLS.RedirectAddr = ":80" }, wantErr: "server.tls.redirect_addr"},
+		{name: "log level", change: func(c *Config) { c.Log.Level = "loud" }, wantErr: "log.level"},
+		{name: "storage driver", change: func(c *Config) { c.Storage.Driver = "postgres" }, wantErr: "storage.driver"},
+		{name: "sqlite path", change: func(c *Config) { c.Storage.Driver, c.Storage.Path = "sqlite", "" }, wantErr: "storage.path"},
+		{name: "rate limit", change: func(c *Config) { c.Limits.API = "fast" }, wantErr: "limits.api"},
+		{name: "negative burst", change: func(c *Config) { c.Limits.Redirect, c.Limits.RedirectBurst = "10/s", -1 }, wantErr: "limits.redirect_burst"},
+		{name: "geo provider", change: func(c *Config) { c.Geo.Provider = "gps" }, wantErr: "geo.provider"},
+		{name: "maxmind db", change: func(c *Config) { c.Geo.Provider = "maxmind" }, wantErr: "geo.maxmind_db"},
+		{name: "credentials with any origin", change: func(c *Config) { c.CORSRedirect.Credentials = true }, wantErr: "cors_redirect.credentials"},
+		{name: "schemes", change: func(c *Config) { c.URLPolicy.AllowedSchemes = nil }, wantErr: "url_policy.allowed_schemes"},
+		{name: "blocked action", change: func(c *Config) { c.Rules.BlockedAction = "drop" }, wantErr: "rules.blocked_action"},
+		{name: "query policy", change: func(c *Config) { c.Redirect.QueryPolicy = "merge" }, wantErr: "redirect.query_policy"},
+		{name: "permanent max age", change: func(c *Config) { c.Redirect.PermanentMaxAge = -time.Second }, wantErr: "redirect.permanent_max_age"},
+		{name: "metrics addr", change: func(c *Config) { c.Metrics.Addr = "9100" }, wantErr: "metrics.addr"},
+		{name: "sample ratio", change: func(c *Config) { c.Tracing.SampleRatio = 2 }, wantErr: "tracing.sample_ratio"},
+		{name: "shutdown timeout", change: func(c *Config) { c.Shutdown.Timeout = 0 }, wantErr: "shutdown.timeout"},
+		{name: "shutdown delay", change: func(c *Config) { c.Shutdown.Delay = time.Minute }, wantErr: "shutdown.delay"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := defaults()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.change(cfg)
+
+			err = cfg.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Validate = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr+":") {
+				t.Fatalf("Validate = %v, want an error for %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg, err := defaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Server.Port = "0"
+	cfg.Log.Level = "loud"
+
+	err = cfg.Validate()
+	if err == nil || !strings.Contains(err.Error(), "server.port") || !strings.Contains(err.Error(), "log.level") {
+		t.Fatalf("Validate = %v, want both problems", err)
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg, err := defaults()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Auth.Token = "admin-token"
+	cfg.Auth.JWT.HMACSecret = "hmac-secret"
+	cfg.Limits.RedisPassword = "redis-password"
+	cfg.Redirect.ScanSecret = "scan-secret"
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, secret := range []string{"admin-token", "hmac-secret", "redis-password", "scan-secret"} {
+		if strings.Contains(buf.String(), secret) {
+			t.Fatalf("Print leaked %q:\n%s", secret, buf.String())
+		}
+	}
+	if cfg.Auth.Token != "admin-token" {
+		t.Fatal("Print modified the configuration")
+	}
+}
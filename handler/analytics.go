@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/pkg/analytics"
+)
+
+// Defaults of the stats query API
+const (
+	defaultAnalyticsRange = 7 * 24 * time.Hour
+	defaultAnalyticsTop   = 10
+	maxAnalyticsTop       = 100
+)
+
+// AnalyticsHandler answers time series and top-N breakdowns of the clicks of
+// a short URL. It reads short_url and its domain, from and to (RFC 3339 or YYYY-MM-DD,
+// defaulting to the last 7 days), granularity (hour or day), top and
+// include_bots.
+func (h *Handler) AnalyticsHandler(w http.ResponseWriter, r *http.Request) {
+	shortURL, err := h.linkKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if shortURL == "" {
+		http.Error(w, "short_url parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	q, err := parseAnalyticsQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, found := h.store(r).GetLink(shortURL); !found {
+		h.params.Logger().WarnContext(r.Context(), "Short URL not found for analytics", slog.String("short_url", shortURL))
+		http.NotFound(w, r)
+		return
+	}
+
+	events, err := h.store(r).ClickEvents(shortURL, q.From, q.To)
+	if err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to load clicks", slog.String("short_url", shortURL), slog.String("error", err.Error()))
+		http.Error(w, "Failed to load clicks", http.StatusInternalServerError)
+		return
+	}
+
+	report := analytics.Aggregate(shortURL, events, q)
+
+	h.params.Logger().InfoContext(r.Context(), "Retrieved analytics for URL", slog.String("short_url", shortURL),
+		slog.String("granularity", q.Granularity), slog.Int("clicks", report.Clicks))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+func parseAnalyticsQuery(r *http.Request) (analytics.Query, error) {
+	values := r.URL.Query()
+	q := analytics.Query{
+		To:          time.Now().UTC(),
+		Granularity: values.Get("granularity"),
+		Top:         defaultAnalyticsTop,
+	}
+
+	if v := values.Get("to"); v != "" {
+		t, err := analytics.ParseTime(v)
+		if err != nil {
+			return q, err
+		}
+		q.To = t
+	}
+
+	q.From = q.To.Add(-defaultAnalyticsRange)
+	if v := values.Get("from"); v != "" {
+		t, err := analytics.ParseTime(v)
+		if err != nil {
+			return q, err
+		}
+		q.From = t
+	}
+
+	if v := values.Get("include_bots"); v != "" {
+		include, err := strconv.ParseBool(v)
+		if err != nil {
+			return q, fmt.Errorf("include_bots must be true or false")
+		}
+		q.IncludeBots = include
+	}
+
+	if v := values.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxAnalyticsTop {
+			return q, fmt.Errorf("top must be between 1 and %d", maxAnalyticsTop)
+		}
+		q.Top = n
+	}
+
+	return q, q.Validate()
+}
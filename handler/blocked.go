@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/thiagozs/go-shorturl/pkg/rules"
+)
+
+// blockedPage tells the visitor the destination is blocked, either with a
+// 451 or with an interstitial warning they can click through
+func (h *Handler) blockedPage(w http.ResponseWriter, originalURL string, verdict rules.Verdict) {
+	unavailable := h.params.BlockedAction() == BlockedActionUnavailable
+
+	status := http.StatusOK
+	if unavailable {
+		status = http.StatusUnavailableForLegalReasons
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	templates.ExecuteTemplate(w, "blocked.html", map[string]any{
+		"Unavailable": unavailable,
+		"Reason":      verdict.Reason,
+		"URL":         originalURL,
+	})
+}
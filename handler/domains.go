@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+	"github.com/thiagozs/go-shorturl/pkg/auth"
+	"github.com/thiagozs/go-shorturl/pkg/realip"
+	"github.com/thiagozs/go-shorturl/pkg/redirect"
+	"github.com/thiagozs/go-shorturl/pkg/utils"
+)
+
+// DomainsHandler manages short domains: GET lists them, POST creates one or
+// replaces its settings and DELETE removes one
+func (h *Handler) DomainsHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listDomains(w, r)
+	case http.MethodPost:
+		h.saveDomain(w, r)
+	case http.MethodDelete:
+		h.deleteDomain(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) listDomains(w http.ResponseWriter, r *http.Request) {
+	domains, err := h.store(r).ListDomains()
+	if err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to list domains", slog.String("error", err.Error()))
+		http.Error(w, "Failed to list domains", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(domains)
+}
+
+// saveDomain reads name, redirect_code, not_found_url and allowed_creators
+// (comma separated) from the query string
+func (h *Handler) saveDomain(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	name, err := utils.ParseDomain(q.Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	domain := model.Domain{Name: name, NotFoundURL: q.Get("not_found_url"), CreatedAt: time.Now().UTC()}
+
+	if v := q.Get("redirect_code"); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil || !redirect.ValidCode(code) {
+			http.Error(w, "redirect_code must be one of 301, 302, 307 or 308", http.StatusBadRequest)
+			return
+		}
+		domain.RedirectCode = code
+	}
+
+	if domain.NotFoundURL != "" && !h.validDestination(w, r, domain.NotFoundURL) {
+		return
+	}
+
+	for _, creator := range strings.Split(q.Get("allowed_creators"), ",") {
+		if creator = strings.TrimSpace(creator); creator != "" && !slices.Contains(domain.AllowedCreators, creator) {
+			domain.AllowedCreators = append(domain.AllowedCreators, creator)
+		}
+	}
+
+	status := http.StatusCreated
+	if existing, found := h.store(r).GetDomain(name); found {
+		domain.CreatedAt = existing.CreatedAt
+		status = http.StatusOK
+	}
+
+	if err := h.store(r).SaveDomain(domain); err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to save domain", slog.String("error", err.Error()))
+		http.Error(w, "Failed to save domain", http.StatusInternalServerError)
+		return
+	}
+
+	h.params.Logger().InfoContext(r.Context(), "Domain saved", slog.String("domain", name),
+		slog.Int("redirect_code", domain.RedirectCode), slog.Any("allowed_creators", domain.AllowedCreators))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(domain)
+}
+
+// deleteDomain removes a domain. Its links are kept and resolve again if the
+// domain is added back.
+func (h *Handler) deleteDomain(w http.ResponseWriter, r *http.Request) {
+	name, err := utils.ParseDomain(r.URL.Query().Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store(r).DeleteDomain(name); err != nil {
+		h.params.Logger().WarnContext(r.Context(), "Failed to delete domain", slog.String("domain", name), slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	h.params.Logger().InfoContext(r.Context(), "Domain deleted", slog.String("domain", name))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"name": name, "message": "Domain deleted"})
+}
+
+// domain returns the namespace the links of the named domain are keyed
+// under and its settings. The primary domain, also used when name is empty,
+// has the empty namespace and may have no stored settings. ok is false when
+// name is neither the primary domain nor a registered one.
+func (h *Handler) domain(r *http.Request, name string) (namespace string, domain model.Domain, ok bool) {
+	primary := strings.ToLower(h.params.Domain())
+	if name == "" {
+		name = primary
+	}
+
+	domain, found := h.store(r).GetDomain(name)
+	if name == primary {
+		if !found {
+			domain = model.Domain{Name: primary}
+		}
+		return "", domain, true
+	}
+
+	return name, domain, found
+}
+
+// hostDomain resolves the host a redirect request was sent to, as forwarded
+// by trusted proxies. Hosts that are not registered domains, such as
+// addresses or localhost, use the primary domain.
+func (h *Handler) hostDomain(r *http.Request) (string, model.Domain) {
+	if name, err := utils.ParseDomain(realip.OriginFromRequest(r).Host); err == nil {
+		if namespace, domain, ok := h.domain(r, name); ok {
+			return namespace, domain
+		}
+	}
+
+	namespace, domain, _ := h.domain(r, "")
+	return namespace, domain
+}
+
+// linkKey returns the store key of the link named by the short_url and
+// domain query parameters, empty when short_url is
+func (h *Handler) linkKey(r *http.Request) (string, error) {
+	code := r.URL.Query().Get("short_url")
+	if code == "" {
+		return "", nil
+	}
+	if strings.Contains(code, "/") {
+		return "", fmt.Errorf("invalid short_url %q, pass the domain parameter for other domains", code)
+	}
+
+	name := r.URL.Query().Get("domain")
+	if name != "" {
+		var err error
+		if name, err = utils.ParseDomain(name); err != nil {
+			return "", err
+		}
+	}
+
+	namespace, _, ok := h.domain(r, name)
+	if !ok {
+		return "", fmt.Errorf("unknown domain %q", name)
+	}
+
+	return model.LinkKey(namespace, code), nil
+}
+
+// mayCreate reports whether the caller of r may create links on domain
+func mayCreate(r *http.Request, domain model.Domain) bool {
+	if len(domain.AllowedCreators) == 0 {
+		return true
+	}
+
+	p, ok := auth.PrincipalFromContext(r.Context())
+	if !ok {
+		return false
+	}
+
+	return slices.Contains(p.Scopes, auth.ScopeAdmin) ||
+		slices.Contains(domain.AllowedCreators, p.Subject) ||
+		slices.Contains(domain.AllowedCreators, p.Name)
+}
+
+// redirectCode returns the status redirects on domain use
+func redirectCode(domain model.Domain) int {
+	if domain.RedirectCode == 0 {
+		return http.StatusFound
+	}
+	return domain.RedirectCode
+}
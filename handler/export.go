@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+	"github.com/thiagozs/go-shorturl/pkg/analytics"
+)
+
+// exportFlushEvery is how many rows are written between flushes to the client
+const exportFlushEvery = 500
+
+// ExportHandler streams raw click events as CSV or NDJSON. It reads format,
+// short_url with its domain, tag, from and to (RFC 3339 or YYYY-MM-DD) and
+// include_bots; every filter is optional.
+func (h *Handler) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	values := r.URL.Query()
+	format := values.Get("format")
+	if format == "" {
+		format = analytics.FormatCSV
+	}
+
+	filter, err := parseClickFilter(values.Get)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if filter.ShortURL, err = h.linkKey(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exporter, err := analytics.NewExporter(w, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", analytics.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="clicks.%s"`, format))
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	rows := 0
+	err = h.store(r).ScanClicks(filter, func(e model.ClickEvent) error {
+		if err := exporter.Write(e); err != nil {
+			return err
+		}
+
+		rows++
+		if rows%exportFlushEvery == 0 {
+			if err := exporter.Flush(); err != nil {
+				return err
+			}
+			rc.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = exporter.Flush()
+	}
+
+	// The status is already sent, so a failure can only be logged
+	if err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to export clicks", slog.Int("rows", rows), slog.String("error", err.Error()))
+		return
+	}
+
+	h.params.Logger().InfoContext(r.Context(), "Exported clicks", slog.String("format", format), slog.Int("rows", rows))
+}
+
+// parseClickFilter reads the click filters shared by the export endpoint,
+// except the short URL which depends on its domain
+func parseClickFilter(get func(string) string) (model.ClickFilter, error) {
+	filter := model.ClickFilter{
+		Tag: strings.ToLower(strings.TrimSpace(get("tag"))),
+	}
+
+	var err error
+	if v := get("from"); v != "" {
+		if filter.From, err = analytics.ParseTime(v); err != nil {
+			return filter, err
+		}
+	}
+	if v := get("to"); v != "" {
+		if filter.To, err = analytics.ParseTime(v); err != nil {
+			return filter, err
+		}
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, fmt.Errorf("from must be before to")
+	}
+
+	if v := get("include_bots"); v != "" {
+		if filter.IncludeBots, err = strconv.ParseBool(v); err != nil {
+			return filter, fmt.Errorf("include_bots must be true or false")
+		}
+	}
+
+	return filter, nil
+}
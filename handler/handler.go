@@ -1,15 +1,28 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
-	"net"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/thiagozs/go-shorturl/config"
+	"github.com/thiagozs/go-shorturl/infra/database"
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+	"github.com/thiagozs/go-shorturl/pkg/analytics"
+	"github.com/thiagozs/go-shorturl/pkg/auth"
+	"github.com/thiagozs/go-shorturl/pkg/baseurl"
+	"github.com/thiagozs/go-shorturl/pkg/metrics"
+	"github.com/thiagozs/go-shorturl/pkg/realip"
+	"github.com/thiagozs/go-shorturl/pkg/redirect"
 	"github.com/thiagozs/go-shorturl/pkg/utils"
+	"github.com/thiagozs/go-shorturl/pkg/validator"
 )
 
 // Handler holds the logger and URLStore
@@ -29,6 +42,20 @@ func NewHandler(opts ...Options) (*Handler, error) {
 		return nil, fmt.Errorf("store is required")
 	}
 
+	if params.BaseURL() == nil {
+		builder, err := baseurl.New(
+			baseurl.WithDomain(params.Domain()),
+			baseurl.WithHost(params.Host()),
+			baseurl.WithPort(params.Port()),
+			baseurl.WithHTTPS(params.HTTPS()),
+			baseurl.WithLocal(params.Local()),
+		)
+		if err != nil {
+			return nil, err
+		}
+		params.baseURL = builder
+	}
+
 	return &Handler{params: params}, nil
 }
 
@@ -40,89 +67,249 @@ func (h *Handler) ShortenHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.validDestination(w, r, originalURL) {
+		return
+	}
+
+	tags, err := utils.ParseTags(r.URL.Query().Get("tags"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	title, err := utils.ParseTitle(r.URL.Query().Get("title"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	settings, err := parseRedirectSettings(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Links go on the primary domain unless another one is asked for
+	name := r.URL.Query().Get("domain")
+	if name != "" {
+		if name, err = utils.ParseDomain(name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	namespace, domain, ok := h.domain(r, name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown domain %q", name), http.StatusBadRequest)
+		return
+	}
+	if !mayCreate(r, domain) {
+		h.params.Logger().WarnContext(r.Context(), "Not allowed to create links on domain", slog.String("domain", domain.Name))
+		http.Error(w, "Not allowed to create links on this domain", http.StatusForbidden)
+		return
+	}
+
 	// Generate a short URL and store it
 	shortURL, err := utils.GenerateShortURL()
 	if err != nil {
-		h.params.Logger().Error("Failed to generate short URL", slog.String("error", err.Error()))
+		h.params.Logger().ErrorContext(r.Context(), "Failed to generate short URL", slog.String("error", err.Error()))
 		http.Error(w, "Failed to generate short URL", http.StatusInternalServerError)
 		return
 	}
 
-	h.params.Store().Save(shortURL, originalURL)
+	link := settings
+	link.ShortURL = model.LinkKey(namespace, shortURL)
+	link.OriginalURL = originalURL
+	link.Title = title
+	link.CreatedAt = time.Now().UTC()
+	link.Tags = tags
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		link.CreatedBy = p.Subject
+	}
+
+	if err := h.store(r).SaveLink(link); err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to save short URL", slog.String("error", err.Error()))
+		http.Error(w, "Failed to save short URL", http.StatusInternalServerError)
+		return
+	}
 
 	// Respond with the short URL in JSON format
-	response := map[string]string{"short_url": fmt.Sprintf("http://localhost:%s/%s", h.params.Port(), shortURL)}
-	if !h.params.Local() {
-		if h.params.HTTPS() {
-			response = map[string]string{"short_url": fmt.Sprintf("https://%s/%s", h.params.Domain(), shortURL)}
-		} else {
-			response = map[string]string{"short_url": fmt.Sprintf("http://%s/%s", h.params.Domain(), shortURL)}
-		}
-	}
+	response := map[string]string{"short_url": h.params.BaseURL().Build(r, namespace, shortURL)}
 
-	h.params.Logger().Info("URL shortened", slog.String("original_url", originalURL), slog.String("short_url", shortURL))
+	h.params.Logger().InfoContext(r.Context(), "URL shortened", slog.String("original_url", originalURL), slog.String("short_url", link.ShortURL), slog.String("created_by", link.CreatedBy))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(response)
 }
 
-// redirectHandler handles requests to redirect from a short URL to the original URL
+// redirectHandler handles requests to redirect from a short URL to the original URL.
+// The code is looked up among the links of the domain in the Host header.
+// A code ending in + or the preview=1 parameter shows a preview page instead.
 func (h *Handler) RedirectHandler(w http.ResponseWriter, r *http.Request) {
-	shortURL := r.URL.Path[1:] // Get the short URL from the path
-	originalURL, found := h.params.Store().Get(shortURL)
+	namespace, domain := h.hostDomain(r)
+	code := strings.TrimPrefix(r.URL.Path, h.BasePath()+"/") // Get the short URL from the path
+
+	preview, _ := strconv.ParseBool(r.URL.Query().Get(redirect.PreviewParam))
+	if c, ok := strings.CutSuffix(code, "+"); ok {
+		code, preview = c, true
+	}
+	shortURL := model.LinkKey(namespace, code)
+
+	// A slash would reach into the namespace of another domain
+	link, found := model.Link{}, false
+	if !strings.Contains(code, "/") {
+		link, found = h.store(r).GetLink(shortURL)
+	}
+	originalURL := link.OriginalURL
 
 	if !found {
-		h.params.Logger().Warn("Short URL not found", slog.String("short_url", shortURL))
+		h.params.Logger().WarnContext(r.Context(), "Short URL not found", slog.String("short_url", shortURL))
+		h.params.Metrics().Redirect(metrics.RedirectMiss)
+		if domain.NotFoundURL != "" {
+			http.Redirect(w, r, domain.NotFoundURL, http.StatusFound)
+			return
+		}
 		http.NotFound(w, r)
 		return
 	}
 
+	if h.params.Rules() != nil {
+		if verdict := h.params.Rules().CheckString(originalURL); verdict.Blocked {
+			h.params.Logger().WarnContext(r.Context(), "Redirect to blocked destination", slog.String("short_url", shortURL),
+				slog.String("original_url", originalURL), slog.String("rule", verdict.Rule))
+			h.params.Metrics().Redirect(metrics.RedirectBlocked)
+			h.blockedPage(w, originalURL, verdict)
+			return
+		}
+	}
+
+	if preview {
+		h.params.Metrics().Redirect(metrics.RedirectPreview)
+		h.previewPage(w, r, namespace, code, shortURL)
+		return
+	}
+
+	h.params.Metrics().Redirect(metrics.RedirectHit)
+
 	// Get client IP and referrer for stats
-	ip, _, _ := net.SplitHostPort(r.RemoteAddr)
-	referrer := r.Referer()
-	geoLocation := utils.GetGeoLocation(ip) // Fetch geolocation using the helper function
+	ip := realip.FromRequest(r)
+	click := model.Click{
+		ShortURL:  shortURL,
+		IP:        ip,
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		Source:    model.SourceLink,
+		At:        time.Now().UTC(),
+	}
+	if h.isScan(r, shortURL) {
+		click.Source = model.SourceQR
+	}
+
+	if h.params.Bots() != nil {
+		if verdict := h.params.Bots().Classify(r); verdict.Bot {
+			click.Bot = true
+			h.params.Logger().InfoContext(r.Context(), "Bot hit", slog.String("short_url", shortURL), slog.String("reason", verdict.Reason))
+		}
+	}
+
+	// Bots are not worth a geolocation lookup
+	if !click.Bot {
+		loc, err := h.params.Geo().Lookup(r.Context(), ip)
+		if err != nil {
+			h.params.Logger().WarnContext(r.Context(), "Failed to resolve geolocation", slog.String("ip", ip), slog.String("error", err.Error()))
+		}
+		click.Location = loc
+	}
 
 	// Update statistics
-	if err := h.params.Store().UpdateStats(shortURL, ip,
-		referrer, geoLocation); err != nil {
-		h.params.Logger().Error("Failed to update stats", slog.String("short_url", shortURL), slog.String("error", err.Error()))
+	if err := h.store(r).UpdateStats(click); err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to update stats", slog.String("short_url", shortURL), slog.String("error", err.Error()))
 		http.Error(w, "Failed to update stats", http.StatusInternalServerError)
 		return
 	}
 
-	h.params.Logger().Info("Redirecting", slog.String("short_url", shortURL), slog.String("original_url", originalURL), slog.String("geo_location", geoLocation))
-	http.Redirect(w, r, originalURL, http.StatusFound) // Redirect to the original URL
+	if err := h.store(r).RecordClick(analytics.NewEvent(click)); err != nil {
+		h.params.Logger().WarnContext(r.Context(), "Failed to record click", slog.String("short_url", shortURL), slog.String("error", err.Error()))
+	}
+
+	target := h.destination(r, link, domain, code, click.Source)
+	status := linkRedirectCode(link, domain)
+
+	h.params.Logger().InfoContext(r.Context(), "Redirecting", slog.String("short_url", shortURL), slog.String("original_url", target), slog.String("geo_location", click.Location.String()))
+	w.Header().Set("Cache-Control", redirect.CacheControl(status, h.params.PermanentMaxAge()))
+	http.Redirect(w, r, target, status) // Redirect to the original URL
 }
 
 // statsHandler handles requests to retrieve statistics for a shortened URL
 func (h *Handler) StatsHandler(w http.ResponseWriter, r *http.Request) {
-	shortURL := r.URL.Query().Get("short_url")
-	statsStr, found := h.params.Store().GetStats(shortURL)
+	shortURL, err := h.linkKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	statsStr, found := h.store(r).GetStats(shortURL)
 
 	if !found {
-		h.params.Logger().Warn("Short URL not found for stats",
+		h.params.Logger().WarnContext(r.Context(), "Short URL not found for stats",
 			slog.String("short_url", shortURL))
 		http.NotFound(w, r)
 		return
 	}
 
 	var stats map[string]interface{}
-	err := json.Unmarshal([]byte(statsStr), &stats)
+	err = json.Unmarshal([]byte(statsStr), &stats)
 	if err != nil {
-		h.params.Logger().Error("Failed to marshal stats", slog.String("short_url", shortURL), slog.String("error", err.Error()))
+		h.params.Logger().ErrorContext(r.Context(), "Failed to marshal stats", slog.String("short_url", shortURL), slog.String("error", err.Error()))
 		http.Error(w, "Failed to marshal stats", http.StatusInternalServerError)
 		return
 	}
 
+	// Bot hits are kept apart and only added to the count on request
+	if includeBots, _ := strconv.ParseBool(r.URL.Query().Get("include_bots")); includeBots {
+		count, _ := stats["count"].(float64)
+		bots, _ := stats["bot_count"].(float64)
+		stats["count"] = count + bots
+	}
+
+	if link, found := h.store(r).GetLink(shortURL); found {
+		stats["created_by"] = link.CreatedBy
+		stats["created_at"] = link.CreatedAt
+		stats["tags"] = link.Tags
+		if link.RedirectCode != 0 {
+			stats["redirect_code"] = link.RedirectCode
+		}
+		if link.QueryPolicy != "" {
+			stats["query_policy"] = link.QueryPolicy
+		}
+		if len(link.UTM) > 0 {
+			utm := make(map[string]string, len(link.UTM))
+			for name := range link.UTM {
+				utm[name] = link.UTM.Get(name)
+			}
+			stats["utm"] = utm
+		}
+		if link.Title != "" {
+			stats["title"] = link.Title
+		}
+	}
+	if domain, _ := model.SplitLinkKey(shortURL); domain != "" {
+		stats["domain"] = domain
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	h.params.Logger().Info("Retrieved stats for URL", slog.String("short_url", shortURL))
+	h.params.Logger().InfoContext(r.Context(), "Retrieved stats for URL", slog.String("short_url", shortURL))
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(stats)
 }
 
 // updateHandler handles requests to update the original URL for a given short URL
 func (h *Handler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
-	shortURL := r.URL.Query().Get("short_url")
+	shortURL, err := h.linkKey(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	newOriginalURL := r.URL.Query().Get("new_url")
 
 	// Validate inputs
@@ -131,14 +318,18 @@ func (h *Handler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !h.validDestination(w, r, newOriginalURL) {
+		return
+	}
+
 	// Update the URL in the store
-	if err := h.params.Store().UpdateURL(shortURL, newOriginalURL); err != nil {
-		h.params.Logger().Warn("Failed to update URL", slog.String("short_url", shortURL), slog.String("error", err.Error()))
+	if err := h.store(r).UpdateURL(shortURL, newOriginalURL); err != nil {
+		h.params.Logger().WarnContext(r.Context(), "Failed to update URL", slog.String("short_url", shortURL), slog.String("error", err.Error()))
 		http.Error(w, err.Error(), http.StatusNotFound)
 		return
 	}
 
-	h.params.Logger().Info("Updated URL", slog.String("short_url", shortURL), slog.String("new_original_url", newOriginalURL))
+	h.params.Logger().InfoContext(r.Context(), "Updated URL", slog.String("short_url", shortURL), slog.String("new_original_url", newOriginalURL))
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -148,9 +339,9 @@ func (h *Handler) UpdateHandler(w http.ResponseWriter, r *http.Request) {
 
 // flushHandler handles requests to flush all key-value pairs from memory and returns a JSON backup
 func (h *Handler) FlushHandler(w http.ResponseWriter, r *http.Request) {
-	backup, err := h.params.Store().Flush()
+	backup, err := h.store(r).Flush()
 	if err != nil {
-		h.params.Logger().Error("Failed to flush URLs", slog.String("error", err.Error()))
+		h.params.Logger().ErrorContext(r.Context(), "Failed to flush URLs", slog.String("error", err.Error()))
 		http.Error(w, "Failed to flush URLs", http.StatusInternalServerError)
 		return
 	}
@@ -159,15 +350,15 @@ func (h *Handler) FlushHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 
-	h.params.Logger().Info("Flushed all URLs and returned backup")
+	h.params.Logger().InfoContext(r.Context(), "Flushed all URLs and returned backup")
 	json.NewEncoder(w).Encode(backup)
 }
 
 // backupHandler returns the current URL mappings as a JSON object
 func (h *Handler) BackupHandler(w http.ResponseWriter, r *http.Request) {
-	backup, err := h.params.Store().Backup()
+	backup, err := h.store(r).Backup()
 	if err != nil {
-		h.params.Logger().Error("Failed to generate backup", slog.String("error", err.Error()))
+		h.params.Logger().ErrorContext(r.Context(), "Failed to generate backup", slog.String("error", err.Error()))
 		http.Error(w, "Failed to generate backup", http.StatusInternalServerError)
 		return
 	}
@@ -175,25 +366,63 @@ func (h *Handler) BackupHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write(backup)
 	w.WriteHeader(http.StatusOK)
-	h.params.Logger().Info("Returned current backup")
+	h.params.Logger().InfoContext(r.Context(), "Returned current backup")
 }
 
-// importHandler handles requests to import URLs from a JSON object
+// importHandler handles requests to import URLs from a JSON object. With
+// replace=true the URLs replace every existing link in one step.
 func (h *Handler) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	var replace bool
+	if v := r.URL.Query().Get("replace"); v != "" {
+		var err error
+		if replace, err = strconv.ParseBool(v); err != nil {
+			http.Error(w, "replace must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		h.params.Logger().Error("Failed to read request body", slog.String("error", err.Error()))
+		h.params.Logger().ErrorContext(r.Context(), "Failed to read request body", slog.String("error", err.Error()))
 		http.Error(w, "Failed to read request body", http.StatusBadRequest)
 		return
 	}
 
-	if err := h.params.Store().Import(body); err != nil {
-		h.params.Logger().Error("Failed to import URLs", slog.String("error", err.Error()))
+	var importedURLs map[string]string
+	if err := json.Unmarshal(body, &importedURLs); err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to parse imported URLs", slog.String("error", err.Error()))
+		http.Error(w, "Failed to import URLs", http.StatusBadRequest)
+		return
+	}
+
+	// Import all or nothing so a rejected entry can be fixed and resent
+	rejected := map[string]string{}
+	for shortURL, originalURL := range importedURLs {
+		if err := h.checkDestination(r.Context(), originalURL); err != nil {
+			rejected[shortURL] = err.Error()
+		}
+	}
+
+	if len(rejected) > 0 {
+		h.params.Logger().WarnContext(r.Context(), "Rejected import", slog.Int("rejected", len(rejected)))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": "some URLs were rejected", "rejected": rejected})
+		return
+	}
+
+	if replace {
+		_, err = h.store(r).Restore(body)
+	} else {
+		err = h.store(r).Import(body)
+	}
+	if err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to import URLs", slog.String("error", err.Error()))
 		http.Error(w, "Failed to import URLs", http.StatusBadRequest)
 		return
 	}
 
-	h.params.Logger().Info("URLs imported successfully")
+	h.params.Logger().InfoContext(r.Context(), "URLs imported successfully")
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -201,6 +430,47 @@ func (h *Handler) ImportHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"message": "URLs imported successfully"})
 }
 
+// checkDestination applies the URL policy and the blocklist and allowlist
+// rules to a destination
+func (h *Handler) checkDestination(ctx context.Context, rawURL string) error {
+	if h.params.Validator() != nil {
+		if _, err := h.params.Validator().Validate(ctx, rawURL); err != nil {
+			return err
+		}
+	}
+
+	if h.params.Rules() != nil {
+		if verdict := h.params.Rules().CheckString(rawURL); verdict.Blocked {
+			h.params.Logger().WarnContext(ctx, "Destination blocked by rules", slog.String("url", rawURL),
+				slog.String("rule", verdict.Rule), slog.String("reason", verdict.Reason))
+			return fmt.Errorf("blocked url: %s", verdict.Reason)
+		}
+	}
+
+	// The validator only knows the configured domain, links must not point
+	// at any of the other short domains either
+	if u, err := url.Parse(rawURL); err == nil {
+		if name, err := utils.ParseDomain(u.Host); err == nil {
+			if _, found := h.params.Store().WithContext(ctx).GetDomain(name); found {
+				return &validator.Error{URL: rawURL, Reason: "points back at the short link domain " + name}
+			}
+		}
+	}
+
+	return nil
+}
+
+// validDestination checks a destination and answers 400 when it is rejected
+func (h *Handler) validDestination(w http.ResponseWriter, r *http.Request, rawURL string) bool {
+	if err := h.checkDestination(r.Context(), rawURL); err != nil {
+		h.params.Logger().WarnContext(r.Context(), "Rejected destination URL", slog.String("url", rawURL), slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
 func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -215,3 +485,14 @@ func (h *Handler) SetConfig(cfg *config.Config) {
 	h.params.SetHTTPS(cfg.GetHTTPS())
 	h.params.SetPort(cfg.GetPort())
 }
+
+// BasePath returns the path prefix every route is mounted under, "" when
+// they are at the root
+func (h *Handler) BasePath() string {
+	return h.params.BaseURL().Prefix()
+}
+
+// store returns the store with its operations traced under the request
+func (h *Handler) store(r *http.Request) *database.Database {
+	return h.params.Store().WithContext(r.Context())
+}
@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/thiagozs/go-shorturl/pkg/health"
+)
+
+// LivezHandler reports that the process is up and serving requests. It does
+// not look at dependencies, a failing database should not get the process
+// restarted.
+func (h *Handler) LivezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": health.StatusOK})
+}
+
+// ReadyzHandler runs the dependency checks and answers 503 when a critical
+// one fails or the server is shutting down
+func (h *Handler) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	report := health.Report{Status: health.StatusOK, Checks: map[string]health.Result{}}
+	if checker := h.params.Health(); checker != nil {
+		report = checker.Ready(r.Context())
+	}
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
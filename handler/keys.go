@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/pkg/auth"
+)
+
+// KeysHandler manages API keys: GET lists them, POST creates one and DELETE
+// revokes one
+func (h *Handler) KeysHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.listKeys(w, r)
+	case http.MethodPost:
+		h.createKey(w, r)
+	case http.MethodDelete:
+		h.revokeKey(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) listKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.store(r).ListAPIKeys()
+	if err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to list API keys", slog.String("error", err.Error()))
+		http.Error(w, "Failed to list API keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(keys)
+}
+
+// createKey reads name, scopes (comma separated) and an optional expires_in
+// duration from the query string
+func (h *Handler) createKey(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	scopes, err := auth.ParseScopes(r.URL.Query().Get("scopes"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var ttl time.Duration
+	if v := r.URL.Query().Get("expires_in"); v != "" {
+		ttl, err = time.ParseDuration(v)
+		if err != nil || ttl <= 0 {
+			http.Error(w, "expires_in must be a positive duration such as 720h", http.StatusBadRequest)
+			return
+		}
+	}
+
+	key, plaintext, err := auth.NewAPIKey(name, scopes, ttl)
+	if err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to generate API key", slog.String("error", err.Error()))
+		http.Error(w, "Failed to generate API key", http.StatusInternalServerError)
+		return
+	}
+
+	if err := h.store(r).SaveAPIKey(key); err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to save API key", slog.String("error", err.Error()))
+		http.Error(w, "Failed to save API key", http.StatusInternalServerError)
+		return
+	}
+
+	creator := "unknown"
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		creator = p.Name
+	}
+
+	h.params.Logger().InfoContext(r.Context(), "API key created", slog.String("key_id", key.ID),
+		slog.String("name", key.Name), slog.Any("scopes", key.Scopes), slog.String("created_by", creator))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]any{"key": key, "token": plaintext})
+}
+
+func (h *Handler) revokeKey(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "id parameter is missing", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.store(r).DeleteAPIKey(id); err != nil {
+		h.params.Logger().WarnContext(r.Context(), "Failed to revoke API key", slog.String("key_id", id), slog.String("error", err.Error()))
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	h.params.Logger().InfoContext(r.Context(), "API key revoked", slog.String("key_id", id))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"id": id, "message": "API key revoked"})
+}
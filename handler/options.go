@@ -1,27 +1,55 @@
 package handler
 
 import (
+	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/thiagozs/go-shorturl/config"
 	"github.com/thiagozs/go-shorturl/infra/database"
+	"github.com/thiagozs/go-shorturl/pkg/baseurl"
+	"github.com/thiagozs/go-shorturl/pkg/botdetect"
+	"github.com/thiagozs/go-shorturl/pkg/geo"
+	"github.com/thiagozs/go-shorturl/pkg/health"
+	"github.com/thiagozs/go-shorturl/pkg/metrics"
+	"github.com/thiagozs/go-shorturl/pkg/redirect"
+	"github.com/thiagozs/go-shorturl/pkg/rules"
+	"github.com/thiagozs/go-shorturl/pkg/validator"
+)
+
+// What RedirectHandler does with links whose destination is now blocked
+const (
+	BlockedActionWarn        = "warn"
+	BlockedActionUnavailable = "451"
 )
 
 type Options func(*HandlerParams) error
 
 type HandlerParams struct {
-	store  *database.Database
-	logger *slog.Logger
-	config *config.Config
-	domain string
-	port   string
-	host   string
-	local  bool
-	https  bool
+	store         *database.Database
+	validator     *validator.Validator
+	rules         *rules.Engine
+	blockedAction string
+	queryPolicy   string
+	permanentAge  time.Duration
+	scanSecret    []byte
+	geo           geo.GeoResolver
+	bots          *botdetect.Detector
+	metrics       *metrics.Metrics
+	health        *health.Checker
+	reloader      Reloader
+	baseURL       *baseurl.Builder
+	logger        *slog.Logger
+	config        *config.Config
+	domain        string
+	port          string
+	host          string
+	local         bool
+	https         bool
 }
 
 func newHandlerParams(opts ...Options) (*HandlerParams, error) {
-	params := &HandlerParams{}
+	params := &HandlerParams{geo: geo.Noop{}, queryPolicy: redirect.PolicyDrop}
 	for _, opt := range opts {
 		if err := opt(params); err != nil {
 			return nil, err
@@ -79,6 +107,110 @@ func WithDomain(domain string) Options {
 	}
 }
 
+// WithBaseURL sets how the links returned to clients are built. Without it
+// they are built from the domain, port, host, local and https settings.
+func WithBaseURL(builder *baseurl.Builder) Options {
+	return func(p *HandlerParams) error {
+		p.baseURL = builder
+		return nil
+	}
+}
+
+// WithValidator sets the policy destination URLs are checked against
+func WithValidator(validator *validator.Validator) Options {
+	return func(p *HandlerParams) error {
+		p.validator = validator
+		return nil
+	}
+}
+
+// WithGeoResolver sets how click locations are resolved, no lookup is made
+// by default
+func WithGeoResolver(resolver geo.GeoResolver) Options {
+	return func(p *HandlerParams) error {
+		if resolver == nil {
+			return fmt.Errorf("geo resolver cannot be nil")
+		}
+		p.geo = resolver
+		return nil
+	}
+}
+
+// WithBotDetector enables counting bot hits apart from human clicks
+func WithBotDetector(detector *botdetect.Detector) Options {
+	return func(p *HandlerParams) error {
+		p.bots = detector
+		return nil
+	}
+}
+
+// WithMetrics enables counting redirect hits and misses
+func WithMetrics(m *metrics.Metrics) Options {
+	return func(p *HandlerParams) error {
+		p.metrics = m
+		return nil
+	}
+}
+
+// WithHealth sets the dependency checks run by the readiness probe
+func WithHealth(checker *health.Checker) Options {
+	return func(p *HandlerParams) error {
+		p.health = checker
+		return nil
+	}
+}
+
+// WithReloader enables reloading the configuration through the API
+func WithReloader(reloader Reloader) Options {
+	return func(p *HandlerParams) error {
+		p.reloader = reloader
+		return nil
+	}
+}
+
+// WithRules sets the blocklist and allowlist engine and what to do when a
+// stored link now points at a blocked destination
+func WithRules(engine *rules.Engine, blockedAction string) Options {
+	return func(p *HandlerParams) error {
+		switch blockedAction {
+		case "", BlockedActionWarn:
+			blockedAction = BlockedActionWarn
+		case BlockedActionUnavailable:
+		default:
+			return fmt.Errorf("unknown blocked action %q", blockedAction)
+		}
+		p.rules = engine
+		p.blockedAction = blockedAction
+		return nil
+	}
+}
+
+// WithRedirects sets the query policy of links without their own and how
+// long browsers may cache permanent redirects
+func WithRedirects(queryPolicy string, permanentMaxAge time.Duration) Options {
+	return func(p *HandlerParams) error {
+		policy, err := redirect.ParsePolicy(queryPolicy)
+		if err != nil {
+			return err
+		}
+		if policy == "" {
+			policy = redirect.PolicyDrop
+		}
+		p.queryPolicy = policy
+		p.permanentAge = permanentMaxAge
+		return nil
+	}
+}
+
+// WithScanSecret sets the key signing the links of tracked QR codes, an
+// empty one disables tracking
+func WithScanSecret(secret string) Options {
+	return func(p *HandlerParams) error {
+		p.scanSecret = []byte(secret)
+		return nil
+	}
+}
+
 func WithConfig(config *config.Config) Options {
 	return func(p *HandlerParams) error {
 		p.config = config
@@ -92,6 +224,54 @@ func (p *HandlerParams) Store() *database.Database {
 	return p.store
 }
 
+func (p *HandlerParams) Validator() *validator.Validator {
+	return p.validator
+}
+
+func (p *HandlerParams) Geo() geo.GeoResolver {
+	return p.geo
+}
+
+func (p *HandlerParams) Bots() *botdetect.Detector {
+	return p.bots
+}
+
+func (p *HandlerParams) Metrics() *metrics.Metrics {
+	return p.metrics
+}
+
+func (p *HandlerParams) Health() *health.Checker {
+	return p.health
+}
+
+func (p *HandlerParams) Reloader() Reloader {
+	return p.reloader
+}
+
+func (p *HandlerParams) BaseURL() *baseurl.Builder {
+	return p.baseURL
+}
+
+func (p *HandlerParams) Rules() *rules.Engine {
+	return p.rules
+}
+
+func (p *HandlerParams) BlockedAction() string {
+	return p.blockedAction
+}
+
+func (p *HandlerParams) QueryPolicy() string {
+	return p.queryPolicy
+}
+
+func (p *HandlerParams) PermanentMaxAge() time.Duration {
+	return p.permanentAge
+}
+
+func (p *HandlerParams) ScanSecret() []byte {
+	return p.scanSecret
+}
+
 func (p *HandlerParams) Logger() *slog.Logger {
 	return p.logger
 }
@@ -126,6 +306,10 @@ func (p *HandlerParams) SetStore(store *database.Database) {
 	p.store = store
 }
 
+func (p *HandlerParams) SetValidator(validator *validator.Validator) {
+	p.validator = validator
+}
+
 func (p *HandlerParams) SetLogger(logger *slog.Logger) {
 	p.logger = logger
 }
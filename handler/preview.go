@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+)
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var templates = template.Must(template.ParseFS(templateFS, "templates/*.html"))
+
+// previewPage shows where the link stored under shortURL goes instead of
+// following it. The visit is not counted, the continue link goes through
+// the short link so following it is.
+func (h *Handler) previewPage(w http.ResponseWriter, r *http.Request, namespace, code, shortURL string) {
+	link, found := h.store(r).GetLink(shortURL)
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+
+	var stats struct {
+		Count int `json:"count"`
+	}
+	if statsStr, found := h.store(r).GetStats(shortURL); found {
+		if err := json.Unmarshal([]byte(statsStr), &stats); err != nil {
+			h.params.Logger().WarnContext(r.Context(), "Failed to decode stats", slog.String("short_url", shortURL), slog.String("error", err.Error()))
+		}
+	}
+
+	h.params.Logger().InfoContext(r.Context(), "Preview", slog.String("short_url", shortURL), slog.String("original_url", link.OriginalURL))
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := templates.ExecuteTemplate(w, "preview.html", map[string]any{
+		"ShortURL":  h.params.BaseURL().Build(r, namespace, code),
+		"URL":       link.OriginalURL,
+		"Title":     link.Title,
+		"CreatedAt": link.CreatedAt,
+		"Clicks":    stats.Count,
+	}); err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to render preview", slog.String("short_url", shortURL), slog.String("error", err.Error()))
+	}
+}
@@ -0,0 +1,163 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+	"github.com/thiagozs/go-shorturl/pkg/qr"
+	"github.com/thiagozs/go-shorturl/pkg/redirect"
+)
+
+// ScanParam marks the redirects of tracked QR codes so their clicks are
+// recorded as scans. Its value signs the link, see scanSignature.
+const ScanParam = redirect.ScanParam
+
+// scanSignature signs shortURL with the scan secret, so only links taken
+// from a tracked QR code count as scans. It is empty without a secret.
+func (h *Handler) scanSignature(shortURL string) string {
+	if len(h.params.ScanSecret()) == 0 {
+		return ""
+	}
+	mac := hmac.New(sha256.New, h.params.ScanSecret())
+	mac.Write([]byte(shortURL))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// isScan tells whether r carries a valid scan marker for shortURL
+func (h *Handler) isScan(r *http.Request, shortURL string) bool {
+	want := h.scanSignature(shortURL)
+	got := r.URL.Query().Get(ScanParam)
+	return want != "" && hmac.Equal([]byte(got), []byte(want))
+}
+
+// QRHandler serves the QR code of the short link named by the path, on the
+// domain of the Host header. The query string sets format (png or svg),
+// size in pixels, level (L, M, Q or H), margin in modules, fg and bg hex
+// colors, and track=1 to encode a link whose clicks count as scans.
+func (h *Handler) QRHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	namespace, _ := h.hostDomain(r)
+	code := strings.TrimPrefix(r.URL.Path, h.BasePath()+"/qr/")
+	shortURL := model.LinkKey(namespace, code)
+
+	if code == "" || strings.Contains(code, "/") {
+		http.NotFound(w, r)
+		return
+	}
+	if _, found := h.store(r).Get(shortURL); !found {
+		h.params.Logger().WarnContext(r.Context(), "Short URL not found", slog.String("short_url", shortURL))
+		http.NotFound(w, r)
+		return
+	}
+
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = qr.FormatPNG
+	}
+	if format != qr.FormatPNG && format != qr.FormatSVG {
+		http.Error(w, "format must be png or svg", http.StatusBadRequest)
+		return
+	}
+
+	opts, err := qrOptions(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	content := h.params.BaseURL().Build(r, namespace, code)
+	if track, _ := strconv.ParseBool(q.Get("track")); track {
+		signature := h.scanSignature(shortURL)
+		if signature == "" {
+			http.Error(w, "Scan tracking is not configured", http.StatusBadRequest)
+			return
+		}
+		content += "?" + url.Values{ScanParam: {signature}}.Encode()
+	}
+
+	// The image only depends on what is encoded and how it is drawn
+	key, err := qr.Key(content, format, opts...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	sum := sha256.Sum256([]byte(key))
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.Header().Set("ETag", etag)
+	if match := r.Header.Get("If-None-Match"); match != "" && strings.Contains(match, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	c, err := qr.New(content, opts...)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := c.Render(&buf, format); err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to render QR code", slog.String("short_url", shortURL), slog.String("error", err.Error()))
+		http.Error(w, "Failed to render QR code", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", qr.ContentType(format))
+	w.Header().Set("Content-Length", strconv.Itoa(buf.Len()))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodGet {
+		w.Write(buf.Bytes())
+	}
+}
+
+// qrOptions reads the rendering settings from the query string
+func qrOptions(q url.Values) ([]qr.Options, error) {
+	var opts []qr.Options
+
+	for _, name := range []string{"size", "margin"} {
+		v := q.Get(name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q", name, v)
+		}
+		if name == "size" {
+			opts = append(opts, qr.WithSize(n))
+		} else {
+			opts = append(opts, qr.WithMargin(n))
+		}
+	}
+
+	if v := q.Get("level"); v != "" {
+		opts = append(opts, qr.WithLevel(v))
+	}
+	if v := q.Get("fg"); v != "" {
+		opts = append(opts, qr.WithForeground(v))
+	}
+	if v := q.Get("bg"); v != "" {
+		opts = append(opts, qr.WithBackground(v))
+	}
+
+	return opts, nil
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+	"github.com/thiagozs/go-shorturl/pkg/redirect"
+)
+
+// parseRedirectSettings reads the redirect_code, query_policy and utm_*
+// parameters of a new link
+func parseRedirectSettings(q url.Values) (model.Link, error) {
+	var link model.Link
+
+	if v := q.Get("redirect_code"); v != "" {
+		code, err := strconv.Atoi(v)
+		if err != nil || !redirect.ValidCode(code) {
+			return link, fmt.Errorf("redirect_code must be one of 301, 302, 307 or 308")
+		}
+		link.RedirectCode = code
+	}
+
+	policy, err := redirect.ParsePolicy(q.Get("query_policy"))
+	if err != nil {
+		return link, err
+	}
+	link.QueryPolicy = policy
+
+	utm, err := redirect.ParseUTM(q)
+	if err != nil {
+		return link, err
+	}
+	if len(utm) > 0 {
+		link.UTM = utm
+	}
+
+	return link, nil
+}
+
+// destination is where a click on link goes: its destination with the UTM
+// parameters and, following its query policy, the query string of r
+func (h *Handler) destination(r *http.Request, link model.Link, domain model.Domain, code, source string) string {
+	policy := link.QueryPolicy
+	if policy == "" {
+		policy = h.params.QueryPolicy()
+	}
+
+	target, err := redirect.Destination(link.OriginalURL, r.URL.Query(), policy, link.UTM,
+		redirect.Vars{Code: code, Domain: domain.Name, Source: source})
+	if err != nil {
+		h.params.Logger().WarnContext(r.Context(), "Failed to build destination", slog.String("short_url", link.ShortURL), slog.String("error", err.Error()))
+		return link.OriginalURL
+	}
+
+	return target
+}
+
+// linkRedirectCode returns the status a redirect of link uses, its own or
+// else its domain's
+func linkRedirectCode(link model.Link, domain model.Domain) int {
+	if link.RedirectCode != 0 {
+		return link.RedirectCode
+	}
+	return redirectCode(domain)
+}
@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/thiagozs/go-shorturl/config"
+)
+
+// Reloader re-reads the configuration and applies it to the running
+// server, returning what changed
+type Reloader func(ctx context.Context) ([]config.Change, error)
+
+// ReloadHandler reloads the configuration like SIGHUP does and returns the
+// settings that changed
+func (h *Handler) ReloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	reload := h.params.Reloader()
+	if reload == nil {
+		http.Error(w, "Reloading is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	changes, err := reload(r.Context())
+	if err != nil {
+		h.params.Logger().ErrorContext(r.Context(), "Failed to reload configuration", slog.String("error", err.Error()))
+		http.Error(w, "Failed to reload configuration: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if changes == nil {
+		changes = []config.Change{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]any{"changes": changes})
+}
@@ -1,11 +1,18 @@
 package database
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
+	"strings"
+	"time"
 
 	"github.com/thiagozs/go-shorturl/infra/database/memory"
+	"github.com/thiagozs/go-shorturl/infra/database/model"
 	"github.com/thiagozs/go-shorturl/infra/database/sqlite"
+	"github.com/thiagozs/go-shorturl/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Kind int
@@ -19,30 +26,85 @@ func (k Kind) String() string {
 	return [...]string{"Memory", "SQLite"}[k]
 }
 
+// ParseKind converts a configuration value such as "memory" or "sqlite"
+// into a Kind
+func ParseKind(kind string) (Kind, error) {
+	switch strings.ToLower(strings.TrimSpace(kind)) {
+	case "", "memory":
+		return Memory, nil
+	case "sqlite":
+		return SQLite, nil
+	default:
+		return Memory, fmt.Errorf("unsupported database kind %q", kind)
+	}
+}
+
 type DatabaseRepo interface {
 	Save(shortURL, originalURL string) error
+	SaveLink(link model.Link) error
 	Get(shortURL string) (string, bool)
+	GetLink(shortURL string) (model.Link, bool)
 	GetStats(shortURL string) (string, bool)
 	UpdateURL(shortURL, newOriginalURL string) error
-	UpdateStats(shortURL, ip, referrer, geoLocation string) error
+	UpdateStats(click model.Click) error
+	RecordClick(event model.ClickEvent) error
+	ClickEvents(shortURL string, from, to time.Time) ([]model.ClickEvent, error)
+	ScanClicks(filter model.ClickFilter, fn func(model.ClickEvent) error) error
+	Size() (model.StoreSize, error)
+	Ping(ctx context.Context) error
+	Close() error
 	Flush() (map[string]string, error)
 	Backup() ([]byte, error)
 	Import(data []byte) error
+	// Restore replaces every link with the backup in data, all or nothing,
+	// and returns the links it replaced
+	Restore(data []byte) (map[string]string, error)
+
+	SaveAPIKey(key model.APIKey) error
+	GetAPIKeyByHash(hash string) (model.APIKey, bool)
+	ListAPIKeys() ([]model.APIKey, error)
+	DeleteAPIKey(id string) error
+	TouchAPIKey(id string, at time.Time) error
+
+	SaveDomain(domain model.Domain) error
+	GetDomain(name string) (model.Domain, bool)
+	ListDomains() ([]model.Domain, error)
+	DeleteDomain(name string) error
 }
 
 type Database struct {
-	Kind   Kind
-	Engine DatabaseRepo
-	logger *slog.Logger
+	Kind     Kind
+	Engine   DatabaseRepo
+	logger   *slog.Logger
+	observer Observer
+	// ctx parents the spans of the operations, see WithContext
+	ctx context.Context
+}
+
+// Observer is told how long each storage operation took and how it failed
+type Observer interface {
+	ObserveStorage(engine, op string, d time.Duration, err error)
+}
+
+// Migrator is implemented by engines with a persistent schema
+type Migrator interface {
+	Migrate() error
+	SchemaVersion() (int, error)
+	PendingMigrations() (int, error)
 }
 
-func NewDatabase(kind Kind, logger *slog.Logger) (*Database, error) {
+// NewDatabase creates the storage engine for kind. The path is only used by
+// engines backed by a file and falls back to ./shorturl.db when empty.
+func NewDatabase(kind Kind, path string, logger *slog.Logger) (*Database, error) {
 	switch kind {
 	case Memory:
 		return &Database{Kind: kind,
 			Engine: memory.NewURLStore(), logger: logger}, nil
 	case SQLite:
-		eng, err := sqlite.NewURLStore("./shorturl.db", logger)
+		if path == "" {
+			path = "./shorturl.db"
+		}
+		eng, err := sqlite.NewURLStore(path, logger)
 		if err != nil {
 			return nil, err
 		}
@@ -53,34 +115,210 @@ func NewDatabase(kind Kind, logger *slog.Logger) (*Database, error) {
 	}
 }
 
-func (d *Database) Save(shortURL, originalURL string) {
-	d.Engine.Save(shortURL, originalURL)
+func (d *Database) Save(shortURL, originalURL string) (err error) {
+	defer d.start("save")(&err)
+	return d.Engine.Save(shortURL, originalURL)
+}
+
+func (d *Database) SaveLink(link model.Link) (err error) {
+	defer d.start("save_link")(&err)
+	return d.Engine.SaveLink(link)
 }
 
 func (d *Database) Get(shortURL string) (string, bool) {
+	defer d.start("get")(nil)
 	return d.Engine.Get(shortURL)
 }
 
+func (d *Database) GetLink(shortURL string) (model.Link, bool) {
+	defer d.start("get_link")(nil)
+	return d.Engine.GetLink(shortURL)
+}
+
 func (d *Database) GetStats(shortURL string) (string, bool) {
+	defer d.start("get_stats")(nil)
 	return d.Engine.GetStats(shortURL)
 }
 
-func (d *Database) UpdateURL(shortURL, newOriginalURL string) error {
+func (d *Database) UpdateURL(shortURL, newOriginalURL string) (err error) {
+	defer d.start("update_url")(&err)
 	return d.Engine.UpdateURL(shortURL, newOriginalURL)
 }
 
-func (d *Database) UpdateStats(shortURL, ip, referrer, geoLocation string) error {
-	return d.Engine.UpdateStats(shortURL, ip, referrer, geoLocation)
+func (d *Database) UpdateStats(click model.Click) (err error) {
+	defer d.start("update_stats")(&err)
+	return d.Engine.UpdateStats(click)
+}
+
+func (d *Database) RecordClick(event model.ClickEvent) (err error) {
+	defer d.start("record_click")(&err)
+	return d.Engine.RecordClick(event)
+}
+
+func (d *Database) ClickEvents(shortURL string, from, to time.Time) (_ []model.ClickEvent, err error) {
+	defer d.start("click_events")(&err)
+	return d.Engine.ClickEvents(shortURL, from, to)
 }
 
-func (d *Database) Flush() (map[string]string, error) {
+func (d *Database) ScanClicks(filter model.ClickFilter, fn func(model.ClickEvent) error) (err error) {
+	defer d.start("scan_clicks")(&err)
+	return d.Engine.ScanClicks(filter, fn)
+}
+
+func (d *Database) Size() (_ model.StoreSize, err error) {
+	defer d.start("size")(&err)
+	return d.Engine.Size()
+}
+
+func (d *Database) Ping(ctx context.Context) (err error) {
+	defer d.WithContext(ctx).start("ping")(&err)
+	return d.Engine.Ping(ctx)
+}
+
+func (d *Database) Close() (err error) {
+	defer d.start("close")(&err)
+	return d.Engine.Close()
+}
+
+func (d *Database) Flush() (_ map[string]string, err error) {
+	defer d.start("flush")(&err)
 	return d.Engine.Flush()
 }
 
-func (d *Database) Backup() ([]byte, error) {
+func (d *Database) Backup() (_ []byte, err error) {
+	defer d.start("backup")(&err)
 	return d.Engine.Backup()
 }
 
-func (d *Database) Import(data []byte) error {
+func (d *Database) Import(data []byte) (err error) {
+	defer d.start("import")(&err)
 	return d.Engine.Import(data)
 }
+
+func (d *Database) Restore(data []byte) (_ map[string]string, err error) {
+	defer d.start("restore")(&err)
+	return d.Engine.Restore(data)
+}
+
+func (d *Database) SaveAPIKey(key model.APIKey) (err error) {
+	defer d.start("save_api_key")(&err)
+	return d.Engine.SaveAPIKey(key)
+}
+
+func (d *Database) GetAPIKeyByHash(hash string) (model.APIKey, bool) {
+	defer d.start("get_api_key")(nil)
+	return d.Engine.GetAPIKeyByHash(hash)
+}
+
+func (d *Database) ListAPIKeys() (_ []model.APIKey, err error) {
+	defer d.start("list_api_keys")(&err)
+	return d.Engine.ListAPIKeys()
+}
+
+func (d *Database) DeleteAPIKey(id string) (err error) {
+	defer d.start("delete_api_key")(&err)
+	return d.Engine.DeleteAPIKey(id)
+}
+
+func (d *Database) TouchAPIKey(id string, at time.Time) (err error) {
+	defer d.start("touch_api_key")(&err)
+	return d.Engine.TouchAPIKey(id, at)
+}
+
+func (d *Database) SaveDomain(domain model.Domain) (err error) {
+	defer d.start("save_domain")(&err)
+	return d.Engine.SaveDomain(domain)
+}
+
+func (d *Database) GetDomain(name string) (model.Domain, bool) {
+	defer d.start("get_domain")(nil)
+	return d.Engine.GetDomain(name)
+}
+
+func (d *Database) ListDomains() (_ []model.Domain, err error) {
+	defer d.start("list_domains")(&err)
+	return d.Engine.ListDomains()
+}
+
+func (d *Database) DeleteDomain(name string) (err error) {
+	defer d.start("delete_domain")(&err)
+	return d.Engine.DeleteDomain(name)
+}
+
+// SetObserver reports the latency and errors of every storage operation to
+// o, e.g. for metrics
+func (d *Database) SetObserver(o Observer) {
+	d.observer = o
+}
+
+// start opens a span for op and returns the function that closes it and
+// reports the operation to the observer. It is deferred with a pointer to
+// the error of the operation, nil for lookups that cannot fail.
+func (d *Database) start(op string) func(err *error) {
+	engine := strings.ToLower(d.Kind.String())
+	begin := time.Now()
+
+	_, span := tracing.Tracer().Start(d.context(), "db."+op, trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", engine), attribute.String("db.operation", op)))
+
+	return func(err *error) {
+		var opErr error
+		if err != nil {
+			opErr = *err
+		}
+
+		tracing.End(span, opErr)
+		if d.observer != nil {
+			d.observer.ObserveStorage(engine, op, time.Since(begin), opErr)
+		}
+	}
+}
+
+// WithContext returns a view of the database whose operations are traced as
+// children of the span in ctx
+func (d *Database) WithContext(ctx context.Context) *Database {
+	scoped := *d
+	scoped.ctx = ctx
+	return &scoped
+}
+
+func (d *Database) context() context.Context {
+	if d.ctx == nil {
+		return context.Background()
+	}
+	return d.ctx
+}
+
+// Migrate brings the engine schema up to date and returns the resulting
+// schema version. Engines without a schema are left untouched and report 0.
+func (d *Database) Migrate() (int, error) {
+	m, ok := d.Engine.(Migrator)
+	if !ok {
+		return 0, nil
+	}
+
+	if err := m.Migrate(); err != nil {
+		return 0, err
+	}
+
+	return m.SchemaVersion()
+}
+
+// CheckSchema fails when the engine has migrations that have not run yet,
+// engines are opened as they are and only migrated by Migrate
+func (d *Database) CheckSchema() error {
+	m, ok := d.Engine.(Migrator)
+	if !ok {
+		return nil
+	}
+
+	pending, err := m.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if pending > 0 {
+		return fmt.Errorf("%d schema migration(s) pending, run the migrate command", pending)
+	}
+
+	return nil
+}
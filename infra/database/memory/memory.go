@@ -1,40 +1,59 @@
 package memory
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
 )
 
 // URLStats holds the statistics for a shortened URL
 type URLStats struct {
-	Count           int      `json:"count"`
-	LastIPs         []string `json:"last_ips"`
-	Referrers       []string `json:"referrers"`
-	LastGeoLocation string   `json:"last_geo_location"`
+	Count           int            `json:"count"`
+	BotCount        int            `json:"bot_count"`
+	ScanCount       int            `json:"scan_count"`
+	LastIPs         []string       `json:"last_ips"`
+	Referrers       []string       `json:"referrers"`
+	LastGeoLocation string         `json:"last_geo_location"`
+	LastLocation    model.Location `json:"last_location"`
 }
 
 // URLStore to hold the shortened URLs, their original URLs, and statistics
 type URLStore struct {
 	sync.RWMutex
-	urls  map[string]string
-	stats map[string]*URLStats
+	links   map[string]model.Link
+	stats   map[string]*URLStats
+	keys    map[string]model.APIKey
+	clicks  map[string][]model.ClickEvent
+	domains map[string]model.Domain
 }
 
 // NewURLStore creates a new URLStore
 func NewURLStore() *URLStore {
 	return &URLStore{
-		urls:  make(map[string]string),
-		stats: make(map[string]*URLStats),
+		links:   make(map[string]model.Link),
+		stats:   make(map[string]*URLStats),
+		keys:    make(map[string]model.APIKey),
+		clicks:  make(map[string][]model.ClickEvent),
+		domains: make(map[string]model.Domain),
 	}
 }
 
 // Save stores a shortened URL with its original URL and initializes statistics
 func (s *URLStore) Save(shortURL, originalURL string) error {
+	return s.SaveLink(model.Link{ShortURL: shortURL, OriginalURL: originalURL, CreatedAt: time.Now().UTC()})
+}
+
+// SaveLink stores a link and initializes its statistics
+func (s *URLStore) SaveLink(link model.Link) error {
 	s.Lock()
 	defer s.Unlock()
-	s.urls[shortURL] = originalURL
-	s.stats[shortURL] = &URLStats{LastIPs: []string{}, Referrers: []string{}}
+	s.links[link.ShortURL] = link
+	s.stats[link.ShortURL] = &URLStats{LastIPs: []string{}, Referrers: []string{}}
 	return nil
 }
 
@@ -42,8 +61,16 @@ func (s *URLStore) Save(shortURL, originalURL string) error {
 func (s *URLStore) Get(shortURL string) (string, bool) {
 	s.RLock()
 	defer s.RUnlock()
-	originalURL, found := s.urls[shortURL]
-	return originalURL, found
+	link, found := s.links[shortURL]
+	return link.OriginalURL, found
+}
+
+// GetLink retrieves a link with its metadata
+func (s *URLStore) GetLink(shortURL string) (model.Link, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	link, found := s.links[shortURL]
+	return link, found
 }
 
 // GetStats retrieves the statistics for a given shortened URL
@@ -65,53 +92,146 @@ func (s *URLStore) UpdateURL(shortURL, newOriginalURL string) error {
 	s.Lock()
 	defer s.Unlock()
 
-	if _, exists := s.urls[shortURL]; !exists {
+	link, exists := s.links[shortURL]
+	if !exists {
 		return fmt.Errorf("short URL not found")
 	}
 
-	s.urls[shortURL] = newOriginalURL
+	link.OriginalURL = newOriginalURL
+	s.links[shortURL] = link
 	return nil
 }
 
-// UpdateStats updates the statistics for a given shortened URL
-func (s *URLStore) UpdateStats(shortURL, ip, referrer, geoLocation string) error {
+// UpdateStats updates the statistics of the short URL that was clicked
+func (s *URLStore) UpdateStats(click model.Click) error {
 	s.Lock()
 	defer s.Unlock()
-	stats, found := s.stats[shortURL]
+	stats, found := s.stats[click.ShortURL]
 	if !found {
 		return fmt.Errorf("short URL not found")
 	}
 
-	// Update count
+	// Bot hits are only counted so they do not drown the human clicks
+	if click.Bot {
+		stats.BotCount++
+		return nil
+	}
+
+	// Update count, QR scans are counted on their own as well
 	stats.Count++
+	if click.Source == model.SourceQR {
+		stats.ScanCount++
+	}
 
 	// Update last IPs
 	if len(stats.LastIPs) >= 5 {
 		stats.LastIPs = stats.LastIPs[1:] // Keep only the last 5 IPs
 	}
-	stats.LastIPs = append(stats.LastIPs, ip)
+	stats.LastIPs = append(stats.LastIPs, click.IP)
 
 	// Update referrers
-	if referrer != "" {
+	if click.Referrer != "" {
 		if len(stats.Referrers) >= 5 {
 			stats.Referrers = stats.Referrers[1:] // Keep only the last 5 referrers
 		}
-		stats.Referrers = append(stats.Referrers, referrer)
+		stats.Referrers = append(stats.Referrers, click.Referrer)
 	}
 
 	// Update last geo location
-	stats.LastGeoLocation = geoLocation
+	stats.LastGeoLocation = click.Location.String()
+	stats.LastLocation = click.Location
 
 	return nil
 }
 
+// RecordClick keeps a click for analytics
+func (s *URLStore) RecordClick(event model.ClickEvent) error {
+	s.Lock()
+	defer s.Unlock()
+	if _, found := s.links[event.ShortURL]; !found {
+		return fmt.Errorf("short URL not found")
+	}
+
+	s.clicks[event.ShortURL] = append(s.clicks[event.ShortURL], event)
+	return nil
+}
+
+// ClickEvents returns the clicks of a short URL in [from, to)
+func (s *URLStore) ClickEvents(shortURL string, from, to time.Time) ([]model.ClickEvent, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	events := []model.ClickEvent{}
+	for _, e := range s.clicks[shortURL] {
+		if !e.At.Before(from) && e.At.Before(to) {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+// ScanClicks calls fn for every click event matching filter, link by link in
+// the order they were recorded, stopping at the first error
+func (s *URLStore) ScanClicks(filter model.ClickFilter, fn func(model.ClickEvent) error) error {
+	// Events are only ever appended, so the slices can be walked without
+	// holding the lock while fn writes them out
+	s.RLock()
+	links := make([]model.Link, 0, len(s.clicks))
+	events := make([][]model.ClickEvent, 0, len(s.clicks))
+	for shortURL, clicks := range s.clicks {
+		link := s.links[shortURL]
+		if filter.ShortURL != "" && shortURL != filter.ShortURL {
+			continue
+		}
+		links = append(links, link)
+		events = append(events, clicks)
+	}
+	s.RUnlock()
+
+	for i, link := range links {
+		for _, e := range events[i] {
+			if !filter.Match(link, e) {
+				continue
+			}
+			if err := fn(e); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Ping always succeeds, the store lives in memory
+func (s *URLStore) Ping(context.Context) error {
+	return nil
+}
+
+// Close does nothing, there is nothing to release
+func (s *URLStore) Close() error {
+	return nil
+}
+
+// Size counts the stored links, click events and API keys
+func (s *URLStore) Size() (model.StoreSize, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	size := model.StoreSize{Links: len(s.links), APIKeys: len(s.keys)}
+	for _, clicks := range s.clicks {
+		size.Clicks += len(clicks)
+	}
+	return size, nil
+}
+
 // Flush removes all key-value pairs from the URLStore and returns a backup JSON
 func (s *URLStore) Flush() (map[string]string, error) {
 	s.Lock()
 	defer s.Unlock()
-	backup := s.urls // Create a backup before flushing
-	s.urls = make(map[string]string)
+	backup := s.urlsLocked() // Create a backup before flushing
+	s.links = make(map[string]model.Link)
 	s.stats = make(map[string]*URLStats)
+	s.clicks = make(map[string][]model.ClickEvent)
 	return backup, nil
 }
 
@@ -119,7 +239,17 @@ func (s *URLStore) Flush() (map[string]string, error) {
 func (s *URLStore) Backup() ([]byte, error) {
 	s.RLock()
 	defer s.RUnlock()
-	return json.Marshal(s.urls)
+	return json.Marshal(s.urlsLocked())
+}
+
+// urlsLocked returns the short URL to original URL mapping, the caller must
+// hold the lock
+func (s *URLStore) urlsLocked() map[string]string {
+	urls := make(map[string]string, len(s.links))
+	for shortURL, link := range s.links {
+		urls[shortURL] = link.OriginalURL
+	}
+	return urls
 }
 
 // Import loads URLs from a JSON string into the URLStore
@@ -131,9 +261,148 @@ func (s *URLStore) Import(data []byte) error {
 
 	s.Lock()
 	defer s.Unlock()
+	now := time.Now().UTC()
 	for shortURL, originalURL := range importedURLs {
-		s.urls[shortURL] = originalURL
+		s.links[shortURL] = model.Link{ShortURL: shortURL, OriginalURL: originalURL, CreatedAt: now}
 		s.stats[shortURL] = &URLStats{LastIPs: []string{}, Referrers: []string{}} // Initialize stats
 	}
 	return nil
 }
+
+// Restore replaces every link with the URLs of a JSON backup and returns the
+// links it replaced
+func (s *URLStore) Restore(data []byte) (map[string]string, error) {
+	var restored map[string]string
+	if err := json.Unmarshal(data, &restored); err != nil {
+		return nil, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	backup := s.urlsLocked()
+	s.links = make(map[string]model.Link, len(restored))
+	s.stats = make(map[string]*URLStats, len(restored))
+	s.clicks = make(map[string][]model.ClickEvent)
+	now := time.Now().UTC()
+	for shortURL, originalURL := range restored {
+		s.links[shortURL] = model.Link{ShortURL: shortURL, OriginalURL: originalURL, CreatedAt: now}
+		s.stats[shortURL] = &URLStats{LastIPs: []string{}, Referrers: []string{}}
+	}
+	return backup, nil
+}
+
+// SaveAPIKey stores a new API key
+func (s *URLStore) SaveAPIKey(key model.APIKey) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, exists := s.keys[key.ID]; exists {
+		return fmt.Errorf("api key %s already exists", key.ID)
+	}
+
+	s.keys[key.ID] = key
+	return nil
+}
+
+// GetAPIKeyByHash retrieves the API key whose secret hashes to hash
+func (s *URLStore) GetAPIKeyByHash(hash string) (model.APIKey, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	for _, key := range s.keys {
+		if key.Hash == hash {
+			return key, true
+		}
+	}
+	return model.APIKey{}, false
+}
+
+// ListAPIKeys returns every API key, oldest first
+func (s *URLStore) ListAPIKeys() ([]model.APIKey, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	keys := make([]model.APIKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].CreatedAt.Before(keys[j].CreatedAt)
+	})
+
+	return keys, nil
+}
+
+// DeleteAPIKey revokes the API key with the given id
+func (s *URLStore) DeleteAPIKey(id string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, exists := s.keys[id]; !exists {
+		return fmt.Errorf("api key not found")
+	}
+
+	delete(s.keys, id)
+	return nil
+}
+
+// TouchAPIKey records that the API key was used at the given time
+func (s *URLStore) TouchAPIKey(id string, at time.Time) error {
+	s.Lock()
+	defer s.Unlock()
+
+	key, exists := s.keys[id]
+	if !exists {
+		return fmt.Errorf("api key not found")
+	}
+
+	key.LastUsedAt = &at
+	s.keys[id] = key
+	return nil
+}
+
+// SaveDomain creates a domain or replaces its settings
+func (s *URLStore) SaveDomain(domain model.Domain) error {
+	s.Lock()
+	defer s.Unlock()
+	s.domains[domain.Name] = domain
+	return nil
+}
+
+// GetDomain retrieves a domain by name
+func (s *URLStore) GetDomain(name string) (model.Domain, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	domain, found := s.domains[name]
+	return domain, found
+}
+
+// ListDomains returns every domain sorted by name
+func (s *URLStore) ListDomains() ([]model.Domain, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	domains := make([]model.Domain, 0, len(s.domains))
+	for _, domain := range s.domains {
+		domains = append(domains, domain)
+	}
+
+	sort.Slice(domains, func(i, j int) bool {
+		return domains[i].Name < domains[j].Name
+	})
+
+	return domains, nil
+}
+
+// DeleteDomain removes a domain, its links are kept
+func (s *URLStore) DeleteDomain(name string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, exists := s.domains[name]; !exists {
+		return fmt.Errorf("domain not found")
+	}
+
+	delete(s.domains, name)
+	return nil
+}
@@ -0,0 +1,168 @@
+package model
+
+import (
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Link is a short URL and what it points at
+type Link struct {
+	ShortURL    string    `json:"short_url"`
+	OriginalURL string    `json:"original_url"`
+	Title       string    `json:"title,omitempty"`
+	CreatedBy   string    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	Tags        []string  `json:"tags,omitempty"`
+	// RedirectCode is the status of its redirects, the domain's when zero
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// QueryPolicy is what happens to the query string of a click: drop,
+	// append or override. The server default applies when empty.
+	QueryPolicy string `json:"query_policy,omitempty"`
+	// UTM holds the templates of the UTM parameters added to the destination
+	UTM url.Values `json:"utm,omitempty"`
+}
+
+// LinkKey returns the key a link is stored under. Links of the primary
+// domain are keyed by their code, links of other domains by domain/code, so
+// each domain has its own namespace of codes.
+func LinkKey(domain, code string) string {
+	if domain == "" {
+		return code
+	}
+	return domain + "/" + code
+}
+
+// SplitLinkKey returns the domain and code of a key made by LinkKey, the
+// domain is empty for the primary domain
+func SplitLinkKey(key string) (domain, code string) {
+	if domain, code, ok := strings.Cut(key, "/"); ok {
+		return domain, code
+	}
+	return "", key
+}
+
+// Domain is a short domain links can be created on, with its settings
+type Domain struct {
+	Name string `json:"name"`
+	// RedirectCode is the status of its redirects, 302 when zero
+	RedirectCode int `json:"redirect_code,omitempty"`
+	// NotFoundURL is where unknown codes are sent instead of a 404
+	NotFoundURL string `json:"not_found_url,omitempty"`
+	// AllowedCreators are the API key ids or names and JWT subjects that may
+	// create links on the domain. Anyone with links:write may when empty.
+	AllowedCreators []string  `json:"allowed_creators,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// StoreSize counts what a store holds
+type StoreSize struct {
+	Links   int
+	Clicks  int
+	APIKeys int
+}
+
+// ClickFilter selects click events. Empty fields match everything.
+type ClickFilter struct {
+	ShortURL    string
+	Tag         string
+	From        time.Time
+	To          time.Time
+	IncludeBots bool
+}
+
+// Match reports whether an event of link passes the filter
+func (f ClickFilter) Match(link Link, e ClickEvent) bool {
+	if f.ShortURL != "" && link.ShortURL != f.ShortURL {
+		return false
+	}
+	if f.Tag != "" && !slices.Contains(link.Tags, f.Tag) {
+		return false
+	}
+	if !f.From.IsZero() && e.At.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !e.At.Before(f.To) {
+		return false
+	}
+	return f.IncludeBots || !e.Bot
+}
+
+// Location is where a client IP address is located. Fields are empty when
+// unknown.
+type Location struct {
+	Country     string `json:"country,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+	Region      string `json:"region,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+// String formats the location as "City, Country", or "Unknown"
+func (l Location) String() string {
+	parts := make([]string, 0, 2)
+	for _, part := range []string{l.City, l.Country} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	if len(parts) == 0 {
+		return "Unknown"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Sources a click can come from
+const (
+	// SourceLink is a visit of the short link itself
+	SourceLink = "link"
+	// SourceQR is a scan of a QR code generated with tracking
+	SourceQR = "qr"
+)
+
+// Click is a single visit of a short URL
+type Click struct {
+	ShortURL  string    `json:"short_url"`
+	IP        string    `json:"ip"`
+	Referrer  string    `json:"referrer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	Bot       bool      `json:"bot,omitempty"`
+	Source    string    `json:"source,omitempty"`
+	Location  Location  `json:"location"`
+	At        time.Time `json:"at"`
+}
+
+// ClickEvent is a click as kept for analytics. The client is only known by
+// Visitor, a hash of its IP address and user agent, and the referrer is
+// reduced to its domain.
+type ClickEvent struct {
+	ShortURL string    `json:"short_url"`
+	At       time.Time `json:"at"`
+	Visitor  string    `json:"visitor"`
+	Country  string    `json:"country"`
+	Referrer string    `json:"referrer"`
+	Browser  string    `json:"browser"`
+	OS       string    `json:"os"`
+	Device   string    `json:"device"`
+	Bot      bool      `json:"bot"`
+	Source   string    `json:"source"`
+}
+
+// APIKey is a stored credential. Only the SHA-256 hash of the secret is kept;
+// the plaintext is shown once when the key is created.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Hash       string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Expired reports whether the key has an expiry and it is before now
+func (k APIKey) Expired(now time.Time) bool {
+	return k.ExpiresAt != nil && now.After(*k.ExpiresAt)
+}
@@ -1,22 +1,30 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"log"
 	"log/slog"
+	"net/url"
 	"strings"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 // URLStats holds the statistics for a shortened URL
 type URLStats struct {
-	Count           int      `json:"count"`
-	LastIPs         []string `json:"last_ips"`
-	Referrers       []string `json:"referrers"`
-	LastGeoLocation string   `json:"last_geo_location"`
+	Count           int            `json:"count"`
+	BotCount        int            `json:"bot_count"`
+	ScanCount       int            `json:"scan_count"`
+	LastIPs         []string       `json:"last_ips"`
+	Referrers       []string       `json:"referrers"`
+	LastGeoLocation string         `json:"last_geo_location"`
+	LastLocation    model.Location `json:"last_location"`
 }
 
 // URLStore to hold the SQLite DB connection and manage URLs and statistics
@@ -25,30 +33,43 @@ type URLStore struct {
 	logger *slog.Logger
 }
 
-// NewURLStore creates a new URLStore and initializes the database
+// NewURLStore opens the database without changing its schema, see Migrate
 func NewURLStore(dbFilePath string, logger *slog.Logger) (*URLStore, error) {
 	db, err := sql.Open("sqlite3", dbFilePath)
 	if err != nil {
 		return nil, err
 	}
 
-	// Initialize the database tables
-	if err := initializeDB(db); err != nil {
+	s := &URLStore{db: db, logger: logger}
+	if err := s.checkSchema(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	return &URLStore{db: db, logger: logger}, nil
+	return s, nil
+}
+
+// checkSchema refuses databases migrated by a newer release, whose schema
+// this one does not know
+func (s *URLStore) checkSchema() error {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("schema version %d is newer than the latest known %d", version, len(migrations))
+	}
+	return nil
 }
 
-// initializeDB sets up the necessary tables
-func initializeDB(db *sql.DB) error {
-	createURLsTable := `
-	CREATE TABLE IF NOT EXISTS urls (
+// migrations holds the schema changes in the order they must be applied.
+// The index of the last applied entry plus one is kept in PRAGMA user_version,
+// so new entries must only ever be appended.
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS urls (
 		short_url TEXT PRIMARY KEY,
 		original_url TEXT NOT NULL
-	);`
-
-	createStatsTable := `
+	);
 	CREATE TABLE IF NOT EXISTS url_stats (
 		short_url TEXT PRIMARY KEY,
 		count INTEGER,
@@ -56,28 +77,120 @@ func initializeDB(db *sql.DB) error {
 		referrers TEXT,
 		last_geo_location TEXT,
 		FOREIGN KEY (short_url) REFERENCES urls (short_url)
-	);`
+	);`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id TEXT PRIMARY KEY,
+		name TEXT NOT NULL,
+		prefix TEXT NOT NULL,
+		hash TEXT NOT NULL UNIQUE,
+		scopes TEXT NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP,
+		last_used_at TIMESTAMP
+	);`,
+	`ALTER TABLE urls ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN created_at TIMESTAMP;`,
+	`ALTER TABLE url_stats ADD COLUMN last_location TEXT NOT NULL DEFAULT '{}';`,
+	`CREATE TABLE IF NOT EXISTS clicks (
+		short_url TEXT NOT NULL,
+		at TIMESTAMP NOT NULL,
+		visitor TEXT NOT NULL,
+		country TEXT NOT NULL,
+		referrer TEXT NOT NULL,
+		browser TEXT NOT NULL,
+		os TEXT NOT NULL,
+		device TEXT NOT NULL
+	);
+	CREATE INDEX IF NOT EXISTS clicks_short_url_at ON clicks (short_url, at);`,
+	`ALTER TABLE url_stats ADD COLUMN bot_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE clicks ADD COLUMN bot INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE urls ADD COLUMN tags TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE IF NOT EXISTS domains (
+		name TEXT PRIMARY KEY,
+		redirect_code INTEGER NOT NULL DEFAULT 0,
+		not_found_url TEXT NOT NULL DEFAULT '',
+		allowed_creators TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMP NOT NULL
+	);`,
+	`ALTER TABLE url_stats ADD COLUMN scan_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE clicks ADD COLUMN source TEXT NOT NULL DEFAULT 'link';`,
+	`ALTER TABLE urls ADD COLUMN title TEXT NOT NULL DEFAULT '';`,
+	`ALTER TABLE urls ADD COLUMN redirect_code INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE urls ADD COLUMN query_policy TEXT NOT NULL DEFAULT '';
+	ALTER TABLE urls ADD COLUMN utm TEXT NOT NULL DEFAULT '';`,
+}
 
-	if _, err := db.Exec(createURLsTable); err != nil {
+// migrate applies the migrations the database has not run yet
+func migrate(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
 		return err
 	}
-	if _, err := db.Exec(createStatsTable); err != nil {
-		return err
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+
+		// PRAGMA does not accept bound parameters
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+// Migrate applies any schema migrations that have not run yet
+func (s *URLStore) Migrate() error {
+	return migrate(s.db)
+}
+
+// SchemaVersion returns the number of migrations applied to the database
+func (s *URLStore) SchemaVersion() (int, error) {
+	var version int
+	err := s.db.QueryRow("PRAGMA user_version").Scan(&version)
+	return version, err
+}
+
+// PendingMigrations returns the number of migrations not applied yet
+func (s *URLStore) PendingMigrations() (int, error) {
+	version, err := s.SchemaVersion()
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations) - version, nil
+}
+
 // Save stores a shortened URL with its original URL and initializes statistics
 func (s *URLStore) Save(shortURL, originalURL string) error {
+	return s.SaveLink(model.Link{ShortURL: shortURL, OriginalURL: originalURL, CreatedAt: time.Now().UTC()})
+}
+
+// SaveLink stores a link and initializes its statistics
+func (s *URLStore) SaveLink(link model.Link) error {
 	// Insert URL into urls table
-	_, err := s.db.Exec("INSERT INTO urls (short_url, original_url) VALUES (?, ?)", shortURL, originalURL)
+	_, err := s.db.Exec(`INSERT INTO urls (short_url, original_url, title, created_by, created_at, tags, redirect_code, query_policy, utm)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		link.ShortURL, link.OriginalURL, link.Title, link.CreatedBy, link.CreatedAt, joinStrings(link.Tags),
+		link.RedirectCode, link.QueryPolicy, link.UTM.Encode())
 	if err != nil {
 		return err
 	}
 
 	// Initialize stats for the URL
-	_, err = s.db.Exec("INSERT INTO url_stats (short_url, count, last_ips, referrers, last_geo_location) VALUES (?, 0, '', '', '')", shortURL)
+	_, err = s.db.Exec("INSERT INTO url_stats (short_url, count, last_ips, referrers, last_geo_location) VALUES (?, 0, '', '', '')", link.ShortURL)
 	return err
 }
 
@@ -92,17 +205,47 @@ func (s *URLStore) Get(shortURL string) (string, bool) {
 	return originalURL, true
 }
 
+// GetLink retrieves a link with its metadata
+func (s *URLStore) GetLink(shortURL string) (model.Link, bool) {
+	link := model.Link{ShortURL: shortURL}
+	var createdAt sql.NullTime
+	var tags, utm string
+	err := s.db.QueryRow(`SELECT original_url, title, created_by, created_at, tags, redirect_code, query_policy, utm
+		FROM urls WHERE short_url = ?`, shortURL).
+		Scan(&link.OriginalURL, &link.Title, &link.CreatedBy, &createdAt, &tags, &link.RedirectCode, &link.QueryPolicy, &utm)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.logger.Error("Failed to get link", slog.String("error", err.Error()))
+		}
+		return model.Link{}, false
+	}
+
+	link.CreatedAt = createdAt.Time
+	if tags != "" {
+		link.Tags = splitString(tags)
+	}
+	if utm != "" {
+		if link.UTM, err = url.ParseQuery(utm); err != nil {
+			s.logger.Warn("Failed to decode UTM templates", slog.String("short_url", shortURL), slog.String("error", err.Error()))
+		}
+	}
+	return link, true
+}
+
 // GetStats retrieves the statistics for a given shortened URL
 func (s *URLStore) GetStats(shortURL string) (string, bool) {
 	var stats URLStats
-	var lastIPs, referrers string
-	err := s.db.QueryRow("SELECT count, last_ips, referrers, last_geo_location FROM url_stats WHERE short_url = ?", shortURL).Scan(&stats.Count, &lastIPs, &referrers, &stats.LastGeoLocation)
+	var lastIPs, referrers, lastLocation string
+	err := s.db.QueryRow("SELECT count, bot_count, scan_count, last_ips, referrers, last_geo_location, last_location FROM url_stats WHERE short_url = ?", shortURL).Scan(&stats.Count, &stats.BotCount, &stats.ScanCount, &lastIPs, &referrers, &stats.LastGeoLocation, &lastLocation)
 	if err != nil {
 		return "", false
 	}
 
 	stats.LastIPs = splitString(lastIPs)
 	stats.Referrers = splitString(referrers)
+	if err := json.Unmarshal([]byte(lastLocation), &stats.LastLocation); err != nil {
+		s.logger.Warn("Failed to decode last location", slog.String("short_url", shortURL), slog.String("error", err.Error()))
+	}
 
 	rr, err := json.Marshal(stats)
 	if err != nil {
@@ -114,14 +257,32 @@ func (s *URLStore) GetStats(shortURL string) (string, bool) {
 
 // UpdateURL updates the original URL for a given short URL
 func (s *URLStore) UpdateURL(shortURL, newOriginalURL string) error {
-	_, err := s.db.Exec("UPDATE urls SET original_url = ? WHERE short_url = ?", newOriginalURL, shortURL)
-	return err
+	res, err := s.db.Exec("UPDATE urls SET original_url = ? WHERE short_url = ?", newOriginalURL, shortURL)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("short URL not found")
+	}
+	return nil
 }
 
-// UpdateStats updates the statistics for a given shortened URL
-func (s *URLStore) UpdateStats(shortURL, ip, referrer, geoLocation string) error {
+// UpdateStats updates the statistics of the short URL that was clicked
+func (s *URLStore) UpdateStats(click model.Click) error {
+	// Bot hits are only counted so they do not drown the human clicks
+	if click.Bot {
+		res, err := s.db.Exec("UPDATE url_stats SET bot_count = bot_count + 1 WHERE short_url = ?", click.ShortURL)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return fmt.Errorf("short URL not found")
+		}
+		return nil
+	}
+
 	// Retrieve existing stats
-	statsStr, found := s.GetStats(shortURL)
+	statsStr, found := s.GetStats(click.ShortURL)
 	if !found {
 		return fmt.Errorf("short URL not found")
 	}
@@ -132,17 +293,135 @@ func (s *URLStore) UpdateStats(shortURL, ip, referrer, geoLocation string) error
 		return err
 	}
 
-	// Update stats
+	// Update stats, QR scans are counted on their own as well
 	stats.Count++
-	stats.LastIPs = appendWithLimit(stats.LastIPs, ip, 5)
-	stats.Referrers = appendWithLimit(stats.Referrers, referrer, 5)
-	stats.LastGeoLocation = geoLocation
+	if click.Source == model.SourceQR {
+		stats.ScanCount++
+	}
+	stats.LastIPs = appendWithLimit(stats.LastIPs, click.IP, 5)
+	stats.Referrers = appendWithLimit(stats.Referrers, click.Referrer, 5)
+	stats.LastGeoLocation = click.Location.String()
 
-	_, err := s.db.Exec("UPDATE url_stats SET count = ?, last_ips = ?, referrers = ?, last_geo_location = ? WHERE short_url = ?",
-		stats.Count, joinStrings(stats.LastIPs), joinStrings(stats.Referrers), stats.LastGeoLocation, shortURL)
+	lastLocation, err := json.Marshal(click.Location)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("UPDATE url_stats SET count = ?, scan_count = ?, last_ips = ?, referrers = ?, last_geo_location = ?, last_location = ? WHERE short_url = ?",
+		stats.Count, stats.ScanCount, joinStrings(stats.LastIPs), joinStrings(stats.Referrers), stats.LastGeoLocation, string(lastLocation), click.ShortURL)
 	return err
 }
 
+// RecordClick keeps a click for analytics
+func (s *URLStore) RecordClick(e model.ClickEvent) error {
+	_, err := s.db.Exec(`INSERT INTO clicks (short_url, at, visitor, country, referrer, browser, os, device, bot, source)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ShortURL, e.At.UTC(), e.Visitor, e.Country, e.Referrer, e.Browser, e.OS, e.Device, e.Bot, e.Source)
+	return err
+}
+
+// ClickEvents returns the clicks of a short URL in [from, to)
+func (s *URLStore) ClickEvents(shortURL string, from, to time.Time) ([]model.ClickEvent, error) {
+	rows, err := s.db.Query(`SELECT at, visitor, country, referrer, browser, os, device, bot, source
+		FROM clicks WHERE short_url = ? AND at >= ? AND at < ? ORDER BY at`,
+		shortURL, from.UTC(), to.UTC())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []model.ClickEvent{}
+	for rows.Next() {
+		e := model.ClickEvent{ShortURL: shortURL}
+		if err := rows.Scan(&e.At, &e.Visitor, &e.Country, &e.Referrer, &e.Browser, &e.OS, &e.Device, &e.Bot, &e.Source); err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+
+	return events, rows.Err()
+}
+
+// ScanClicks calls fn for every click event matching filter, oldest first,
+// stopping at the first error. Rows are streamed from the database.
+func (s *URLStore) ScanClicks(filter model.ClickFilter, fn func(model.ClickEvent) error) error {
+	query := `SELECT c.short_url, c.at, c.visitor, c.country, c.referrer, c.browser, c.os, c.device, c.bot, c.source
+		FROM clicks c JOIN urls u ON u.short_url = c.short_url WHERE 1 = 1`
+	var args []any
+
+	if filter.ShortURL != "" {
+		query += " AND c.short_url = ?"
+		args = append(args, filter.ShortURL)
+	}
+	if filter.Tag != "" {
+		// '_' is a LIKE wildcard and a valid tag character
+		query += ` AND ',' || u.tags || ',' LIKE ? ESCAPE '\'`
+		args = append(args, "%,"+strings.ReplaceAll(filter.Tag, "_", `\_`)+",%")
+	}
+	if !filter.From.IsZero() {
+		query += " AND c.at >= ?"
+		args = append(args, filter.From.UTC())
+	}
+	if !filter.To.IsZero() {
+		query += " AND c.at < ?"
+		args = append(args, filter.To.UTC())
+	}
+	if !filter.IncludeBots {
+		query += " AND c.bot = 0"
+	}
+
+	rows, err := s.db.Query(query+" ORDER BY c.at", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e model.ClickEvent
+		if err := rows.Scan(&e.ShortURL, &e.At, &e.Visitor, &e.Country, &e.Referrer,
+			&e.Browser, &e.OS, &e.Device, &e.Bot, &e.Source); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// Ping checks that the database file can still be written to, opening and
+// rolling back a write transaction without changing anything
+func (s *URLStore) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM urls WHERE 0")
+	return err
+}
+
+// Close closes the database file
+func (s *URLStore) Close() error {
+	return s.db.Close()
+}
+
+// Size counts the stored links, click events and API keys
+func (s *URLStore) Size() (model.StoreSize, error) {
+	var size model.StoreSize
+	err := s.db.QueryRow(`SELECT
+		(SELECT COUNT(*) FROM urls),
+		(SELECT COUNT(*) FROM clicks),
+		(SELECT COUNT(*) FROM api_keys)`).Scan(&size.Links, &size.Clicks, &size.APIKeys)
+	return size, err
+}
+
 // Helper function to append an item to a list with a maximum limit
 func appendWithLimit(list []string, item string, limit int) []string {
 	if item == "" {
@@ -187,6 +466,10 @@ func (s *URLStore) Flush() (map[string]string, error) {
 		return nil, err
 	}
 	_, err = s.db.Exec("DELETE FROM url_stats")
+	if err != nil {
+		return nil, err
+	}
+	_, err = s.db.Exec("DELETE FROM clicks")
 	return backup, err
 }
 
@@ -224,3 +507,229 @@ func (s *URLStore) Import(data []byte) error {
 	}
 	return nil
 }
+
+// Restore replaces every link with the URLs of a JSON backup in a single
+// transaction and returns the links it replaced. Nothing changes when any
+// URL cannot be stored.
+func (s *URLStore) Restore(data []byte) (map[string]string, error) {
+	var restored map[string]string
+	if err := json.Unmarshal(data, &restored); err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT short_url, original_url FROM urls")
+	if err != nil {
+		return nil, err
+	}
+	backup := make(map[string]string)
+	for rows.Next() {
+		var shortURL, originalURL string
+		if err := rows.Scan(&shortURL, &originalURL); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		backup[shortURL] = originalURL
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, table := range []string{"urls", "url_stats", "clicks"} {
+		if _, err := tx.Exec("DELETE FROM " + table); err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().UTC()
+	for shortURL, originalURL := range restored {
+		if _, err := tx.Exec("INSERT INTO urls (short_url, original_url, created_at) VALUES (?, ?, ?)",
+			shortURL, originalURL, now); err != nil {
+			return nil, fmt.Errorf("restore %s: %w", shortURL, err)
+		}
+		if _, err := tx.Exec("INSERT INTO url_stats (short_url, count, last_ips, referrers, last_geo_location) VALUES (?, 0, '', '', '')",
+			shortURL); err != nil {
+			return nil, fmt.Errorf("restore %s: %w", shortURL, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return backup, nil
+}
+
+// SaveAPIKey stores a new API key
+func (s *URLStore) SaveAPIKey(key model.APIKey) error {
+	_, err := s.db.Exec(`INSERT INTO api_keys (id, name, prefix, hash, scopes, created_at, expires_at, last_used_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		key.ID, key.Name, key.Prefix, key.Hash, joinStrings(key.Scopes), key.CreatedAt, key.ExpiresAt, key.LastUsedAt)
+	return err
+}
+
+// GetAPIKeyByHash retrieves the API key whose secret hashes to hash
+func (s *URLStore) GetAPIKeyByHash(hash string) (model.APIKey, bool) {
+	row := s.db.QueryRow(`SELECT id, name, prefix, hash, scopes, created_at, expires_at, last_used_at
+		FROM api_keys WHERE hash = ?`, hash)
+
+	key, err := scanAPIKey(row)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.logger.Error("Failed to get API key", slog.String("error", err.Error()))
+		}
+		return model.APIKey{}, false
+	}
+
+	return key, true
+}
+
+// ListAPIKeys returns every API key, oldest first
+func (s *URLStore) ListAPIKeys() ([]model.APIKey, error) {
+	rows, err := s.db.Query(`SELECT id, name, prefix, hash, scopes, created_at, expires_at, last_used_at
+		FROM api_keys ORDER BY created_at`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []model.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// DeleteAPIKey revokes the API key with the given id
+func (s *URLStore) DeleteAPIKey(id string) error {
+	res, err := s.db.Exec("DELETE FROM api_keys WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("api key not found")
+	}
+
+	return nil
+}
+
+// TouchAPIKey records that the API key was used at the given time
+func (s *URLStore) TouchAPIKey(id string, at time.Time) error {
+	_, err := s.db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", at, id)
+	return err
+}
+
+// SaveDomain creates a domain or replaces its settings
+func (s *URLStore) SaveDomain(domain model.Domain) error {
+	_, err := s.db.Exec(`INSERT INTO domains (name, redirect_code, not_found_url, allowed_creators, created_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET redirect_code = excluded.redirect_code,
+			not_found_url = excluded.not_found_url, allowed_creators = excluded.allowed_creators`,
+		domain.Name, domain.RedirectCode, domain.NotFoundURL, joinStrings(domain.AllowedCreators), domain.CreatedAt)
+	return err
+}
+
+// GetDomain retrieves a domain by name
+func (s *URLStore) GetDomain(name string) (model.Domain, bool) {
+	row := s.db.QueryRow(`SELECT name, redirect_code, not_found_url, allowed_creators, created_at
+		FROM domains WHERE name = ?`, name)
+
+	domain, err := scanDomain(row)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			s.logger.Error("Failed to get domain", slog.String("error", err.Error()))
+		}
+		return model.Domain{}, false
+	}
+
+	return domain, true
+}
+
+// ListDomains returns every domain sorted by name
+func (s *URLStore) ListDomains() ([]model.Domain, error) {
+	rows, err := s.db.Query(`SELECT name, redirect_code, not_found_url, allowed_creators, created_at
+		FROM domains ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	domains := []model.Domain{}
+	for rows.Next() {
+		domain, err := scanDomain(rows)
+		if err != nil {
+			return nil, err
+		}
+		domains = append(domains, domain)
+	}
+
+	return domains, rows.Err()
+}
+
+// DeleteDomain removes a domain, its links are kept
+func (s *URLStore) DeleteDomain(name string) error {
+	res, err := s.db.Exec("DELETE FROM domains WHERE name = ?", name)
+	if err != nil {
+		return err
+	}
+
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("domain not found")
+	}
+
+	return nil
+}
+
+// scanner is implemented by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row scanner) (model.APIKey, error) {
+	var key model.APIKey
+	var scopes string
+	var expiresAt, lastUsedAt sql.NullTime
+
+	if err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Hash, &scopes,
+		&key.CreatedAt, &expiresAt, &lastUsedAt); err != nil {
+		return model.APIKey{}, err
+	}
+
+	key.Scopes = splitString(scopes)
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+
+	return key, nil
+}
+
+func scanDomain(row scanner) (model.Domain, error) {
+	var domain model.Domain
+	var creators string
+
+	if err := row.Scan(&domain.Name, &domain.RedirectCode, &domain.NotFoundURL,
+		&creators, &domain.CreatedAt); err != nil {
+		return model.Domain{}, err
+	}
+
+	if creators != "" {
+		domain.AllowedCreators = splitString(creators)
+	}
+
+	return domain, nil
+}
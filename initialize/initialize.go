@@ -1,17 +1,46 @@
 package initialize
 
 import (
+	"context"
 	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
 
 	"github.com/thiagozs/go-shorturl/api"
 	"github.com/thiagozs/go-shorturl/config"
 	"github.com/thiagozs/go-shorturl/handler"
 	"github.com/thiagozs/go-shorturl/infra/database"
 	"github.com/thiagozs/go-shorturl/middleware"
+	"github.com/thiagozs/go-shorturl/pkg/baseurl"
+	"github.com/thiagozs/go-shorturl/pkg/botdetect"
+	"github.com/thiagozs/go-shorturl/pkg/certs"
+	"github.com/thiagozs/go-shorturl/pkg/geo"
+	"github.com/thiagozs/go-shorturl/pkg/health"
+	"github.com/thiagozs/go-shorturl/pkg/jwt"
+	"github.com/thiagozs/go-shorturl/pkg/lifecycle"
+	"github.com/thiagozs/go-shorturl/pkg/metrics"
+	"github.com/thiagozs/go-shorturl/pkg/ratelimit"
+	"github.com/thiagozs/go-shorturl/pkg/realip"
+	"github.com/thiagozs/go-shorturl/pkg/rules"
+	"github.com/thiagozs/go-shorturl/pkg/tracing"
+	"github.com/thiagozs/go-shorturl/pkg/validator"
 )
 
 type Initialize struct {
 	params *InitializeParams
+	// components hold the stores and connections opened by Init
+	components []lifecycle.Component
+
+	// Built once by Init and kept across reloads
+	metrics *metrics.Metrics
+	geo     geo.GeoResolver
+	checker *health.Checker
+	limiter ratelimit.Limiter
+
+	// mu serializes reloads
+	mu sync.Mutex
 }
 
 func NewInitialize(opts ...Options) (*Initialize, error) {
@@ -23,36 +52,151 @@ func NewInitialize(opts ...Options) (*Initialize, error) {
 	return &Initialize{params: params}, nil
 }
 
-func (i *Initialize) Init(reload ...string) error {
+func (i *Initialize) Init() (err error) {
 
 	if i.params.GetLogger() == nil {
 		return fmt.Errorf("logger is required")
 	}
 
-	// Load configuration
-	cfg, err := config.NewConfig()
+	// Use the configuration given with WithConfig, loading it from the
+	// environment otherwise
+	cfg := i.params.GetConfig()
+	if cfg == nil {
+		if cfg, err = config.NewConfig(); err != nil {
+			return err
+		}
+		i.params.SetConfig(cfg)
+	}
+
+	// Create a database connection
+	kind, err := database.ParseKind(cfg.GetDatabase())
 	if err != nil {
 		return err
 	}
 
-	if len(reload) > 0 {
-		i.params.GetLogger().Info("Reloading configuration")
-		cfg = i.params.GetConfig()
-		i.params.SetConfig(cfg)
-	} else {
-		i.params.SetConfig(cfg)
+	db, err := database.NewDatabase(kind, cfg.GetDatabasePath(), i.params.GetLogger())
+	if err != nil {
+		return err
 	}
 
-	// Create a database connection
-	db, err := database.NewDatabase(database.Memory, i.params.GetLogger())
+	i.params.SetDB(db)
+
+	// Stores and connections opened below, released if Init fails halfway
+	var components []lifecycle.Component
+	defer func() {
+		if err != nil {
+			stopComponents(i.params.GetLogger(), components)
+		}
+	}()
+	components = append(components, lifecycle.Component{Name: "storage",
+		Stop: func(context.Context) error { return db.Close() }})
+
+	// The server migrates on startup, the other commands only open the store
+	version, err := db.Migrate()
+	if err != nil {
+		return fmt.Errorf("migrate storage: %w", err)
+	}
+	i.params.GetLogger().Info("Storage schema up to date", slog.String("database", db.Kind.String()),
+		slog.Int("schema_version", version))
+
+	if cfg.GetMetrics().Enabled {
+		i.metrics = metrics.New()
+		db.SetObserver(i.metrics)
+		i.metrics.RegisterStoreSize(db.Size)
+	}
+
+	geoResolver, err := newGeoResolver(cfg.GetGeo(), i.metrics)
 	if err != nil {
 		return err
 	}
+	i.geo = geoResolver
+	components = append(components, lifecycle.Component{Name: "geo",
+		Stop: func(context.Context) error { return geo.Close(geoResolver) }})
 
-	i.params.SetDB(db)
+	// Readiness checks, only storage is critical: without geolocation, fresh
+	// rules or a shared rate limiter links still resolve
+	i.checker = health.New(0)
+	i.checker.Add(health.Check{Name: "storage", Critical: true, Fn: db.Ping})
+	i.checker.Add(health.Check{Name: "geo", Interval: time.Minute,
+		Fn: func(ctx context.Context) error { return geo.Ping(ctx, geoResolver) }})
+
+	// The limiter keeps its buckets across reloads, only the policies of
+	// each group are reloaded
+	i.limiter = newRateLimiter(cfg.GetRateLimit())
+	if pinger, ok := i.limiter.(ratelimit.Pinger); ok {
+		i.checker.Add(health.Check{Name: "ratelimit", Fn: pinger.Ping})
+	}
+	if closer, ok := i.limiter.(io.Closer); ok {
+		components = append(components, lifecycle.Component{Name: "ratelimit",
+			Stop: func(context.Context) error { return closer.Close() }})
+	}
+
+	hd, md, engine, err := i.build(cfg)
+	if err != nil {
+		return err
+	}
+	i.use(hd, md, engine)
+
+	// Load API with handlers and middlewares
+	apiOpts := []api.Options{
+		api.WithLogger(i.params.GetLogger()),
+		api.WithPort(cfg.GetPort()),
+		api.WithDomain(cfg.GetDomain()),
+		api.WithHost(cfg.GetHost()),
+		api.WithHTTPS(cfg.GetHTTPS()),
+		api.WithDB(db),
+		api.WithMiddleware(md),
+		api.WithHandlers(hd),
+		api.WithConfig(cfg),
+		api.WithHealth(i.checker),
+		api.WithDrainDelay(cfg.GetShutdown().Delay),
+	}
+
+	if i.metrics != nil {
+		apiOpts = append(apiOpts, api.WithMetrics(i.metrics, cfg.GetMetrics().Addr))
+	}
+
+	if tlsCfg := cfg.GetTLS(); tlsCfg.Enabled() {
+		store, err := newCertStore(tlsCfg, i.params.GetLogger())
+		if err != nil {
+			return err
+		}
+		i.checker.Add(health.Check{Name: "tls",
+			Fn: func(context.Context) error { return store.Health() }})
+		apiOpts = append(apiOpts, api.WithTLS(store.TLSConfig()),
+			api.WithRedirectAddr(tlsCfg.RedirectAddr))
+	}
+
+	ap, err := api.NewApi(apiOpts...)
+	if err != nil {
+		return err
+	}
+
+	i.params.SetAPI(ap)
+	i.components = components
+
+	return nil
+}
+
+// build creates the handlers and middlewares for cfg around the store,
+// geolocation, metrics and limiter made by Init, and the rules engine when
+// rules are enabled. It runs again on every reload and changes nothing until
+// the result is passed to use.
+func (i *Initialize) build(cfg *config.Config) (*handler.Handler, *middleware.Middleware, *rules.Engine, error) {
+	db := i.params.GetDB()
+
+	urlValidator, err := NewValidator(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
 	// Load handlers
 	handlerOpts := []handler.Options{
+		handler.WithValidator(urlValidator),
+		handler.WithGeoResolver(i.geo),
+		handler.WithMetrics(i.metrics),
+		handler.WithHealth(i.checker),
+		handler.WithReloader(i.params.GetReloader()),
 		handler.WithStore(db),
 		handler.WithLogger(i.params.GetLogger()),
 		handler.WithPort(cfg.GetPort()),
@@ -60,64 +204,364 @@ func (i *Initialize) Init(reload ...string) error {
 		handler.WithHost(cfg.GetHost()),
 		handler.WithLocal(cfg.GetLocal()),
 		handler.WithHTTPS(cfg.GetHTTPS()),
+		handler.WithRedirects(cfg.GetRedirect().QueryPolicy, cfg.GetRedirect().PermanentMaxAge),
+		handler.WithScanSecret(cfg.GetRedirect().ScanSecret),
 		handler.WithConfig(cfg),
 	}
 
+	builder, err := NewBaseURL(cfg)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	handlerOpts = append(handlerOpts, handler.WithBaseURL(builder))
+
+	engine, err := NewRulesEngine(cfg, i.params.GetLogger())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if engine != nil {
+		handlerOpts = append(handlerOpts, handler.WithRules(engine, cfg.GetRules().BlockedAction))
+	}
+
+	if botCfg := cfg.GetBots(); botCfg.Detect {
+		var patterns []string
+		if botCfg.DefaultPatterns {
+			patterns = append(patterns, botdetect.DefaultPatterns...)
+		}
+		patterns = append(patterns, botCfg.Patterns...)
+		handlerOpts = append(handlerOpts, handler.WithBotDetector(botdetect.New(patterns)))
+	}
+
 	hd, err := handler.NewHandler(handlerOpts...)
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 
-	i.params.SetHandler(hd)
+	realIP, err := realip.New(cfg.GetTrustedProxies())
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	policies, err := rateLimitPolicies(cfg.GetRateLimit())
+	if err != nil {
+		return nil, nil, nil, err
+	}
 
 	// Load Midlewares
 	optsMid := []middleware.Options{
+		middleware.WithRealIP(realIP),
+		middleware.WithMetrics(i.metrics),
 		middleware.WithLogger(i.params.GetLogger()),
 		middleware.WithToken(cfg.GetToken()),
+		middleware.WithStore(db),
+		middleware.WithCORS(middleware.GroupAPI, corsPolicy(cfg.GetCORSAPI())),
+		middleware.WithCORS(middleware.GroupRedirect, corsPolicy(cfg.GetCORSRedirect())),
+		middleware.WithRateLimiter(i.limiter, policies),
+	}
+
+	if jwtCfg := cfg.GetJWT(); jwtCfg.Enabled() {
+		verifier, err := newJWTVerifier(jwtCfg)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		optsMid = append(optsMid, middleware.WithJWT(verifier, middleware.JWTMapping{
+			ScopesClaim:  jwtCfg.ScopesClaim,
+			SubjectClaim: jwtCfg.SubjectClaim,
+			ScopeMap:     jwtCfg.ScopeMap,
+		}))
 	}
 
 	md, err := middleware.NewMiddleware(optsMid...)
 	if err != nil {
-		return err
+		return nil, nil, nil, err
 	}
 
+	return hd, md, engine, nil
+}
+
+// use makes the result of build the current handlers and middlewares,
+// checking the rules engine for readiness when there is one
+func (i *Initialize) use(hd *handler.Handler, md *middleware.Middleware, engine *rules.Engine) {
+	i.params.SetHandler(hd)
 	i.params.SetMiddleware(md)
 
-	// Load API with handlers and middlewares
-	apiOpts := []api.Options{
-		api.WithLogger(i.params.GetLogger()),
-		api.WithPort(cfg.GetPort()),
-		api.WithDomain(cfg.GetDomain()),
-		api.WithHost(cfg.GetHost()),
-		api.WithHTTPS(cfg.GetHTTPS()),
-		api.WithDB(db),
-		api.WithMiddleware(md),
-		api.WithHandlers(hd),
-		api.WithConfig(cfg),
+	if engine == nil {
+		i.checker.Remove("rules")
+		return
 	}
+	i.checker.Add(health.Check{Name: "rules",
+		Fn: func(context.Context) error { return engine.Health() }})
+}
 
-	ap, err := api.NewApi(apiOpts...)
+// Reload applies cfg to the running server without touching the store or
+// the listener: tokens, JWT, CORS, rate limit policies, domains, URL policy,
+// rules and bot detection take effect for the next request while in-flight
+// requests finish with the previous settings. Settings that need a restart
+// are kept as they are and reported in the log. It returns what changed.
+func (i *Initialize) Reload(cfg *config.Config) ([]config.Change, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	logger := i.params.GetLogger()
+	prev := i.params.GetConfig()
+
+	for _, c := range keepRestartOnly(prev, cfg) {
+		logger.Warn("Configuration change needs a restart, ignored", slog.String("field", c.Field),
+			slog.String("old", c.Old), slog.String("new", c.New))
+	}
+
+	changes := config.Diff(prev, cfg)
+	if len(changes) == 0 {
+		logger.Info("Configuration reloaded, nothing changed")
+		return changes, nil
+	}
+
+	hd, md, engine, err := i.build(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	i.params.SetAPI(ap)
+	if err := i.params.GetAPI().Swap(hd, md); err != nil {
+		return nil, err
+	}
+	i.use(hd, md, engine)
+	i.params.GetAPI().SetConfig(cfg)
+	i.params.SetConfig(cfg)
 
-	return nil
+	for _, c := range changes {
+		logger.Info("Configuration changed", slog.String("field", c.Field),
+			slog.String("old", c.Old), slog.String("new", c.New))
+	}
+	logger.Info("Configuration reloaded", slog.Int("changes", len(changes)))
+
+	return changes, nil
 }
 
-func (i *Initialize) GetParams() *InitializeParams {
-	return i.params
+// keepRestartOnly copies the settings read once at startup from prev into
+// next and returns the ones that differed
+func keepRestartOnly(prev, next *config.Config) []config.Change {
+	var ignored []config.Change
+	for _, c := range config.Diff(prev, next) {
+		if config.RestartOnly(c.Field) {
+			ignored = append(ignored, c)
+		}
+	}
+
+	next.Server.Host = prev.Server.Host
+	next.Server.Port = prev.Server.Port
+	next.Storage = prev.Storage
+	next.Geo = prev.Geo
+	next.Metrics = prev.Metrics
+	next.Tracing = prev.Tracing
+	next.Shutdown = prev.Shutdown
+	next.Limits.RedisAddr = prev.Limits.RedisAddr
+	next.Limits.RedisPassword = prev.Limits.RedisPassword
+
+	return ignored
 }
 
-func (i *Initialize) SetConfigByFlags(cfg *config.Config) {
-	i.params.SetConfig(cfg)
+// Components returns the stores and connections opened by Init,
+// in the order they must be started. They are stopped in reverse.
+func (i *Initialize) Components() []lifecycle.Component {
+	return i.components
 }
 
-func (i *Initialize) ReloadInit() error {
-	if i.params.GetLogger() == nil {
-		return fmt.Errorf("logger is required")
+// stopComponents releases components in reverse order, logging failures
+func stopComponents(logger *slog.Logger, components []lifecycle.Component) {
+	for j := len(components) - 1; j >= 0; j-- {
+		c := components[j]
+		if c.Stop == nil {
+			continue
+		}
+		if err := c.Stop(context.Background()); err != nil {
+			logger.Error("Failed to release component", slog.String("component", c.Name),
+				slog.String("error", err.Error()))
+		}
+	}
+}
+
+// newJWTVerifier builds a verifier from every configured key source
+func newJWTVerifier(cfg config.JWTConfig) (*jwt.Verifier, error) {
+	var sources jwt.MultiSource
+
+	if cfg.JWKSFile != "" {
+		sources = append(sources, jwt.NewFileJWKS(cfg.JWKSFile, cfg.JWKSTTL))
+	}
+
+	if cfg.JWKSURL != "" {
+		sources = append(sources, jwt.NewURLJWKS(cfg.JWKSURL, nil, cfg.JWKSTTL))
 	}
 
-	return i.Init("reload")
+	if cfg.HMACSecret != "" {
+		sources = append(sources, jwt.StaticKeys{{Alg: jwt.HS256, Public: []byte(cfg.HMACSecret)}})
+	}
+
+	return jwt.NewVerifier(
+		jwt.WithKeySource(sources),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithAudience(cfg.Audience),
+	)
+}
+
+// NewValidator builds the destination URL policy from cfg
+func NewValidator(cfg *config.Config) (*validator.Validator, error) {
+	policy := cfg.GetURLPolicy()
+
+	opts := []validator.Options{
+		validator.WithMaxLength(policy.MaxLength),
+		validator.WithBlockPrivate(policy.BlockPrivate),
+		validator.WithResolveHosts(policy.ResolveHosts),
+		validator.WithSelfDomains(policy.SelfDomains...),
+	}
+
+	if len(policy.AllowedSchemes) > 0 {
+		opts = append(opts, validator.WithSchemes(policy.AllowedSchemes...))
+	}
+
+	// Links on our own domain would redirect to themselves, local or not
+	if cfg.GetDomain() != "" {
+		opts = append(opts, validator.WithSelfDomains(cfg.GetDomain()))
+	}
+	if base, err := baseurl.Parse(cfg.GetBaseURL()); err == nil {
+		opts = append(opts, validator.WithSelfDomains(base.Hostname()))
+	}
+
+	return validator.NewValidator(opts...)
+}
+
+// NewRulesEngine loads the destination rules from cfg, nil when none are
+// configured
+func NewRulesEngine(cfg *config.Config, logger *slog.Logger) (*rules.Engine, error) {
+	rulesCfg := cfg.GetRules()
+	if !rulesCfg.Enabled() {
+		return nil, nil
+	}
+
+	engine, err := rules.NewEngine(
+		rules.WithLogger(logger),
+		rules.WithBlocklists(rulesCfg.Blocklists...),
+		rules.WithAllowlists(rulesCfg.Allowlists...),
+		rules.WithAllowlistOnly(rulesCfg.AllowlistOnly),
+		rules.WithReloadInterval(rulesCfg.ReloadInterval),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("load rules: %w", err)
+	}
+
+	return engine, nil
+}
+
+// NewBaseURL returns the builder of the links returned to clients
+func NewBaseURL(cfg *config.Config) (*baseurl.Builder, error) {
+	return baseurl.New(
+		baseurl.WithBaseURL(cfg.GetBaseURL()),
+		baseurl.WithDomain(cfg.GetDomain()),
+		baseurl.WithHost(cfg.GetHost()),
+		baseurl.WithPort(cfg.GetPort()),
+		baseurl.WithHTTPS(cfg.GetHTTPS()),
+		baseurl.WithLocal(cfg.GetLocal()),
+	)
+}
+
+// newGeoResolver builds the configured geolocation provider behind a cache,
+// timing the lookups that miss it
+func newGeoResolver(cfg config.GeoConfig, mtr *metrics.Metrics) (geo.GeoResolver, error) {
+	var resolver geo.GeoResolver
+
+	switch cfg.Provider {
+	case "none", "":
+		return geo.Noop{}, nil
+	case "http":
+		resolver = geo.NewHTTPResolver(cfg.HTTPURL, cfg.Timeout)
+	case "maxmind":
+		if cfg.MaxMindDB == "" {
+			return nil, fmt.Errorf("GEO_MAXMIND_DB is required for the maxmind provider")
+		}
+		mm, err := geo.NewMaxMindResolver(cfg.MaxMindDB, cfg.Language)
+		if err != nil {
+			return nil, err
+		}
+		resolver = mm
+	default:
+		return nil, fmt.Errorf("unknown geo provider %q", cfg.Provider)
+	}
+
+	cached := geo.NewCached(mtr.InstrumentGeo(cfg.Provider, resolver), cfg.CacheSize, cfg.CacheTTL)
+	return tracing.Geo(cfg.Provider, cached), nil
+}
+
+func corsPolicy(cfg config.CORSConfig) middleware.CORSPolicy {
+	return middleware.CORSPolicy{
+		AllowedOrigins:   cfg.Origins,
+		AllowedMethods:   cfg.Methods,
+		AllowedHeaders:   cfg.Headers,
+		ExposedHeaders:   cfg.ExposedHeaders,
+		AllowCredentials: cfg.Credentials,
+		MaxAge:           cfg.MaxAge,
+	}
+}
+
+// newCertStore loads the certificate and key pairs of cfg
+func newCertStore(cfg config.TLSConfig, logger *slog.Logger) (*certs.Store, error) {
+	if len(cfg.CertFiles) != len(cfg.KeyFiles) {
+		return nil, fmt.Errorf("got %d TLS key files for %d cert files", len(cfg.KeyFiles), len(cfg.CertFiles))
+	}
+
+	opts := []certs.Options{
+		certs.WithLogger(logger),
+		certs.WithMinVersion(cfg.MinVersion),
+		certs.WithReloadInterval(cfg.ReloadInterval),
+	}
+	for n, cert := range cfg.CertFiles {
+		opts = append(opts, certs.WithPair(cert, cfg.KeyFiles[n]))
+	}
+
+	return certs.New(opts...)
+}
+
+// newRateLimiter keeps the buckets in Redis when an address is set and in
+// memory otherwise
+func newRateLimiter(cfg config.RateLimitConfig) ratelimit.Limiter {
+	if cfg.RedisAddr != "" {
+		return ratelimit.NewRedisLimiter(cfg.RedisAddr, cfg.RedisPassword, "shorturl:ratelimit:", 0)
+	}
+	return ratelimit.NewMemoryLimiter()
+}
+
+// rateLimitPolicies parses the policy of each route group. Groups without
+// a policy are not limited.
+func rateLimitPolicies(cfg config.RateLimitConfig) (map[string]ratelimit.Policy, error) {
+	policies := map[string]ratelimit.Policy{}
+
+	groups := []struct {
+		name  string
+		rate  string
+		burst int
+	}{
+		{middleware.GroupAPI, cfg.API, cfg.APIBurst},
+		{middleware.GroupRedirect, cfg.Redirect, cfg.RedirectBurst},
+	}
+
+	for _, g := range groups {
+		if g.rate == "" {
+			continue
+		}
+
+		policy, err := ratelimit.ParsePolicy(g.rate, g.burst)
+		if err != nil {
+			return nil, fmt.Errorf("rate limit %s: %w", g.name, err)
+		}
+		policies[g.name] = policy
+	}
+
+	return policies, nil
+}
+
+func (i *Initialize) GetParams() *InitializeParams {
+	return i.params
+}
+
+func (i *Initialize) SetConfigByFlags(cfg *config.Config) {
+	i.params.SetConfig(cfg)
 }
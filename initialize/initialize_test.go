@@ -0,0 +1,50 @@
+package initialize
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/thiagozs/go-shorturl/config"
+	"github.com/thiagozs/go-shorturl/pkg/validator"
+)
+
+func TestNewValidatorRejectsOwnDomain(t *testing.T) {
+	tests := []struct {
+		name    string
+		domain  string
+		baseURL string
+		url     string
+	}{
+		{name: "default domain", url: "http://localhost/x"},
+		{name: "local domain", domain: "sho.rt", url: "http://sho.rt/x"},
+		{name: "domain with port", domain: "sho.rt", url: "https://SHO.RT.:8443/x"},
+		{name: "base url host", domain: "sho.rt", baseURL: "https://go.example/s", url: "https://go.example/s/x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("BASE_URL", tt.baseURL)
+			if tt.domain != "" {
+				t.Setenv("DOMAIN", tt.domain)
+			}
+
+			cfg, err := config.NewConfig()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v, err := NewValidator(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = v.Validate(context.Background(), tt.url)
+			var verr *validator.Error
+			if !errors.As(err, &verr) || !strings.Contains(verr.Reason, "short link domain") {
+				t.Fatalf("Validate(%q) error = %v, want the short link domain rejected", tt.url, err)
+			}
+		})
+	}
+}
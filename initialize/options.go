@@ -19,6 +19,7 @@ type InitializeParams struct {
 	logger     *slog.Logger
 	config     *config.Config
 	api        *api.API
+	reloader   handler.Reloader
 }
 
 func newInitializeParams(opts ...Options) (*InitializeParams, error) {
@@ -73,6 +74,14 @@ func WithAPI(api *api.API) Options {
 	}
 }
 
+// WithReloader lets admins reload the configuration at /admin/reload
+func WithReloader(reloader handler.Reloader) Options {
+	return func(p *InitializeParams) error {
+		p.reloader = reloader
+		return nil
+	}
+}
+
 // getters -----
 
 func (p *InitializeParams) GetDB() *database.Database {
@@ -99,6 +108,10 @@ func (p *InitializeParams) GetAPI() *api.API {
 	return p.api
 }
 
+func (p *InitializeParams) GetReloader() handler.Reloader {
+	return p.reloader
+}
+
 // setters -----
 
 func (p *InitializeParams) SetDB(db *database.Database) {
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy describes which cross-origin requests a route group accepts
+type CORSPolicy struct {
+	// AllowedOrigins lists exact origins such as "https://app.example.com",
+	// wildcard subdomains such as "https://*.example.com", or "*" for any
+	// origin
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders lists request headers the browser may send, "*" allows
+	// whatever the preflight asks for
+	AllowedHeaders []string
+	ExposedHeaders []string
+	// AllowCredentials is never honoured for origins only allowed through
+	// "*", any site could otherwise make credentialed calls
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin and
+// whether the origin is allowed at all
+func (p CORSPolicy) allowOrigin(origin string) (string, bool) {
+	for _, allowed := range p.AllowedOrigins {
+		if allowed == "*" {
+			return "*", true
+		}
+
+		if matchOrigin(allowed, origin) {
+			return origin, true
+		}
+	}
+	return "", false
+}
+
+// matchOrigin compares origins case-insensitively, letting "*." in pattern
+// stand for one or more subdomain labels
+func matchOrigin(pattern, origin string) bool {
+	pattern, origin = strings.ToLower(pattern), strings.ToLower(origin)
+
+	prefix, suffix, wildcard := strings.Cut(pattern, "*.")
+	if !wildcard {
+		return pattern == origin
+	}
+
+	suffix = "." + suffix
+	if !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+	return sub != "" && !strings.ContainsAny(sub, "/:")
+}
+
+func (p CORSPolicy) allowMethod(method string) bool {
+	return slices.ContainsFunc(p.AllowedMethods, func(m string) bool {
+		return strings.EqualFold(m, method)
+	})
+}
+
+// CORS returns a middleware function applying the CORS policy of group.
+// Preflight requests are answered here and never reach the handler; groups
+// without a policy get no CORS headers, so browsers block cross-origin calls.
+func (m *Middleware) CORS(group string) MiddlewaresFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions &&
+				r.Header.Get("Access-Control-Request-Method") != ""
+
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if preflight {
+				h.Add("Vary", "Access-Control-Request-Method")
+				h.Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			policy, ok := m.params.CORSPolicies()[group]
+			allowOrigin, allowed := policy.allowOrigin(origin)
+			if !ok || !allowed {
+				if preflight {
+					w.WriteHeader(http.StatusNoContent)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Origin", allowOrigin)
+			if policy.AllowCredentials && allowOrigin != "*" {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if len(policy.ExposedHeaders) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !policy.allowMethod(r.Header.Get("Access-Control-Request-Method")) {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			h.Set("Access-Control-Allow-Methods", strings.Join(policy.AllowedMethods, ", "))
+
+			if slices.Contains(policy.AllowedHeaders, "*") {
+				if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+					h.Set("Access-Control-Allow-Headers", requested)
+				}
+			} else if len(policy.AllowedHeaders) > 0 {
+				h.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowedHeaders, ", "))
+			}
+
+			if policy.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+}
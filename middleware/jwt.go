@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/thiagozs/go-shorturl/pkg/auth"
+)
+
+// JWTMapping describes how the claims of a verified token become a principal
+type JWTMapping struct {
+	// ScopesClaim holds the granted scopes, as a space separated string or
+	// an array. Defaults to "scope".
+	ScopesClaim string
+	// SubjectClaim identifies the caller and is recorded as the creator of
+	// the links it shortens. Defaults to "sub".
+	SubjectClaim string
+	// ScopeMap renames identity provider scopes to ours. Scopes missing from
+	// the map are kept only when they already are one of ours.
+	ScopeMap map[string]string
+}
+
+// bearerToken extracts the token of an Authorization: Bearer header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// authenticateJWT verifies token and maps its claims to a principal
+func (m *Middleware) authenticateJWT(ctx context.Context, token string) (*auth.Principal, error) {
+	verifier := m.params.JWT()
+	if verifier == nil {
+		return nil, errors.New("bearer tokens are not enabled")
+	}
+
+	claims, err := verifier.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := m.params.Claims()
+
+	subjectClaim := mapping.SubjectClaim
+	if subjectClaim == "" {
+		subjectClaim = "sub"
+	}
+
+	subject := claims.String(subjectClaim)
+	if subject == "" {
+		return nil, errors.New("token has no " + subjectClaim + " claim")
+	}
+
+	scopesClaim := mapping.ScopesClaim
+	if scopesClaim == "" {
+		scopesClaim = "scope"
+	}
+
+	return &auth.Principal{
+		Name:    subject,
+		Subject: subject,
+		Scopes:  mapScopes(claims.Strings(scopesClaim), mapping.ScopeMap),
+		Method:  "jwt",
+	}, nil
+}
+
+func mapScopes(granted []string, scopeMap map[string]string) []string {
+	scopes := []string{}
+	for _, scope := range granted {
+		if mapped, ok := scopeMap[scope]; ok {
+			scope = mapped
+		}
+
+		if slices.Contains(auth.Scopes(), scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
@@ -1,13 +1,25 @@
 package middleware
 
 import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/thiagozs/go-shorturl/config"
+	"github.com/thiagozs/go-shorturl/pkg/auth"
+	"github.com/thiagozs/go-shorturl/pkg/realip"
+	"github.com/thiagozs/go-shorturl/pkg/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+// lastUsedInterval is how stale the last used time of an API key may get
+// before a request updates it
+const lastUsedInterval = time.Minute
+
 type Handlers func(w http.ResponseWriter, r *http.Request)
 
 type Middlewares func(http.Handler) http.Handler
@@ -34,74 +46,178 @@ func NewMiddleware(opts ...Options) (*Middleware, error) {
 	}, nil
 }
 
+// ClientIP resolves the client address once so logging, rate limiting and
+// stats all see the same one, along with the scheme and host the client
+// addressed for building links
+func (m *Middleware) ClientIP(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := realip.WithClientIP(r.Context(), m.params.RealIP().ClientIP(r))
+		ctx = realip.WithOrigin(ctx, m.params.RealIP().Origin(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	}
+}
+
 // loggingMiddleware is a middleware function that logs details about each request
 func (m *Middleware) Logging(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
-		m.logger.Info("Received request",
+		m.logger.InfoContext(r.Context(), "Received request",
 			slog.String("method", r.Method),
 			slog.String("path", r.URL.Path),
-			slog.String("remote_addr", r.RemoteAddr),
+			slog.String("remote_addr", realip.FromRequest(r)),
 			slog.String("user_agent", r.UserAgent()),
 			slog.String("referer", r.Referer()),
 		)
 		next.ServeHTTP(w, r)
-		m.logger.Info("Processed request", slog.Duration("duration", time.Since(start)))
+		m.logger.InfoContext(r.Context(), "Processed request", slog.Duration("duration", time.Since(start)))
 	}
 }
 
-// tokenAuthMiddleware is a middleware function that checks for a valid token in the request header
-func (m *Middleware) TokenAuth(next http.HandlerFunc) http.HandlerFunc {
+// Authenticate resolves the credentials of the request once, before rate
+// limiting, so callers are limited per principal rather than per token they
+// claim. Failures are kept for RequireScope to answer, the request goes on.
+func (m *Middleware) Authenticate(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		token := r.Header.Get("X-Auth-Token")
-		if token != m.authToken {
-			m.logger.Warn("Unauthorized access attempt", slog.String("remote_addr", r.RemoteAddr))
-			http.Error(w, "Forbidden: Invalid or missing token", http.StatusForbidden)
-			return
+		principal, err := m.traceAuthenticate(r)
+		ctx := context.WithValue(r.Context(), authResultKey{}, authResult{principal, err})
+		if err == nil {
+			ctx = auth.WithPrincipal(ctx, principal)
 		}
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 }
 
-func (m *Middleware) CORS(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Set CORS headers
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Auth-Token")
-		w.Header().Set("Content-Type", "application/json")
-
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
+// RequireScope returns a middleware function that authenticates the request,
+// unless Authenticate already did, and rejects callers that were not granted
+// scope
+func (m *Middleware) RequireScope(scope string) MiddlewaresFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			res, ok := r.Context().Value(authResultKey{}).(authResult)
+			if !ok {
+				res.principal, res.err = m.traceAuthenticate(r)
+			}
+			principal, err := res.principal, res.err
+			if err != nil {
+				m.logger.WarnContext(r.Context(), "Unauthorized access attempt",
+					slog.String("remote_addr", realip.FromRequest(r)),
+					slog.String("error", err.Error()))
+				http.Error(w, "Unauthorized: "+err.Error(), http.StatusUnauthorized)
+				return
+			}
+
+			if !principal.HasScope(scope) {
+				m.logger.WarnContext(r.Context(), "Forbidden access attempt",
+					slog.String("remote_addr", realip.FromRequest(r)),
+					slog.String("principal", principal.Name),
+					slog.String("scope", scope))
+				http.Error(w, fmt.Sprintf("Forbidden: missing scope %s", scope), http.StatusForbidden)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
 		}
+	}
+}
 
-		// Let the request pass
-		next.ServeHTTP(w, r)
+// authResultKey keeps the outcome of Authenticate in the request context
+type authResultKey struct{}
+
+type authResult struct {
+	principal *auth.Principal
+	err       error
+}
+
+// traceAuthenticate authenticates the request in its own span
+func (m *Middleware) traceAuthenticate(r *http.Request) (*auth.Principal, error) {
+	ctx, span := tracing.Tracer().Start(r.Context(), "auth.authenticate")
+	principal, err := m.authenticate(r.WithContext(ctx))
+	if err == nil {
+		span.SetAttributes(attribute.String("auth.method", principal.Method),
+			attribute.String("auth.subject", principal.Subject))
 	}
+	tracing.End(span, err)
+	return principal, err
 }
 
-func (m Middleware) SugarM(middlewares []Middlewares, handler Handlers) http.Handler {
-	var chain http.Handler
-	for i, middleware := range middlewares {
-		if i == 0 {
-			chain = middleware(http.HandlerFunc(handler))
-		} else {
-			chain = middleware(chain)
+// authenticate resolves the credentials of the request to a principal. API
+// keys are read from X-Auth-Token or an Authorization bearer token; other
+// bearer tokens are verified as JWTs. The configured token, when set, is
+// accepted as a bootstrap admin credential so the first API keys can be
+// created.
+func (m *Middleware) authenticate(r *http.Request) (*auth.Principal, error) {
+	token := r.Header.Get("X-Auth-Token")
+	if token == "" {
+		bearer, ok := bearerToken(r)
+		if !ok {
+			return nil, errors.New("missing token")
+		}
+		if !auth.IsAPIKey(bearer) {
+			return m.authenticateJWT(r.Context(), bearer)
 		}
+		token = bearer
+	}
+
+	if m.authToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(m.authToken)) == 1 {
+		return &auth.Principal{
+			Name:    "bootstrap",
+			Subject: "bootstrap",
+			Scopes:  []string{auth.ScopeAdmin},
+			Method:  "token",
+		}, nil
+	}
+
+	store := m.params.Store()
+	if store == nil || !auth.IsAPIKey(token) {
+		return nil, errors.New("invalid token")
+	}
+	store = store.WithContext(r.Context())
+
+	key, found := store.GetAPIKeyByHash(auth.HashKey(token))
+	if !found {
+		return nil, errors.New("invalid token")
+	}
+
+	now := time.Now().UTC()
+	if key.Expired(now) {
+		return nil, errors.New("token expired")
+	}
+
+	// Only record usage once per interval to spare the store a write on
+	// every request
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedInterval {
+		if err := store.TouchAPIKey(key.ID, now); err != nil {
+			m.logger.Warn("Failed to record API key usage",
+				slog.String("key_id", key.ID), slog.String("error", err.Error()))
+		}
+	}
+
+	return &auth.Principal{
+		Name:    key.Name,
+		Subject: key.ID,
+		Scopes:  key.Scopes,
+		Method:  "api_key",
+	}, nil
+}
+
+// SugarM wraps handler with middlewares. The first middleware is the
+// outermost one, so it sees the request first.
+func (m Middleware) SugarM(middlewares []Middlewares, handler Handlers) http.Handler {
+	var chain http.Handler = http.HandlerFunc(handler)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		chain = middlewares[i](chain)
 	}
 
 	return chain
 }
 
+// SugarMFunc wraps handler with middlewares. The first middleware is the
+// outermost one, so it sees the request first.
 func (m Middleware) SugarMFunc(middlewares []MiddlewaresFunc, handler Handlers) http.HandlerFunc {
-	var chain http.HandlerFunc
-	for i, middleware := range middlewares {
-		if i == 0 {
-			chain = middleware(http.HandlerFunc(handler))
-		} else {
-			chain = middleware(chain)
-		}
+	var chain = http.HandlerFunc(handler)
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		chain = middlewares[i](chain)
 	}
 
 	return chain
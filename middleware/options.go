@@ -4,14 +4,37 @@ import (
 	"log/slog"
 
 	"github.com/thiagozs/go-shorturl/config"
+	"github.com/thiagozs/go-shorturl/infra/database"
+	"github.com/thiagozs/go-shorturl/pkg/jwt"
+	"github.com/thiagozs/go-shorturl/pkg/metrics"
+	"github.com/thiagozs/go-shorturl/pkg/ratelimit"
+	"github.com/thiagozs/go-shorturl/pkg/realip"
 )
 
 type Options func(*MiddlewareParams) error
 
+// Route groups that can be given their own rate limit and CORS policies
+const (
+	GroupAPI      = "api"
+	GroupRedirect = "redirect"
+)
+
 type MiddlewareParams struct {
 	config *config.Config
 	logger *slog.Logger
+	store  *database.Database
 	token  string
+	jwt    *jwt.Verifier
+	claims JWTMapping
+
+	limiter  ratelimit.Limiter
+	policies map[string]ratelimit.Policy
+
+	cors map[string]CORSPolicy
+
+	realIP *realip.Resolver
+
+	metrics *metrics.Metrics
 }
 
 func newMiddlewareParams(opts ...Options) (*MiddlewareParams, error) {
@@ -38,6 +61,62 @@ func WithToken(token string) Options {
 	}
 }
 
+// WithStore sets the store API keys are looked up in
+func WithStore(store *database.Database) Options {
+	return func(p *MiddlewareParams) error {
+		p.store = store
+		return nil
+	}
+}
+
+// WithJWT enables Authorization: Bearer tokens verified by verifier, turned
+// into a principal following mapping
+func WithJWT(verifier *jwt.Verifier, mapping JWTMapping) Options {
+	return func(p *MiddlewareParams) error {
+		p.jwt = verifier
+		p.claims = mapping
+		return nil
+	}
+}
+
+// WithRateLimiter enables rate limiting for the route groups that have a
+// policy
+func WithRateLimiter(limiter ratelimit.Limiter, policies map[string]ratelimit.Policy) Options {
+	return func(p *MiddlewareParams) error {
+		p.limiter = limiter
+		p.policies = policies
+		return nil
+	}
+}
+
+// WithRealIP sets the resolver finding the client address behind trusted
+// proxies
+func WithRealIP(resolver *realip.Resolver) Options {
+	return func(p *MiddlewareParams) error {
+		p.realIP = resolver
+		return nil
+	}
+}
+
+// WithMetrics enables request counts and latencies per route
+func WithMetrics(m *metrics.Metrics) Options {
+	return func(p *MiddlewareParams) error {
+		p.metrics = m
+		return nil
+	}
+}
+
+// WithCORS sets the CORS policy of a route group
+func WithCORS(group string, policy CORSPolicy) Options {
+	return func(p *MiddlewareParams) error {
+		if p.cors == nil {
+			p.cors = make(map[string]CORSPolicy)
+		}
+		p.cors[group] = policy
+		return nil
+	}
+}
+
 func WithConfig(config *config.Config) Options {
 	return func(p *MiddlewareParams) error {
 		p.config = config
@@ -53,18 +132,59 @@ func (p *MiddlewareParams) Logger() *slog.Logger {
 	return p.logger
 }
 
+func (p *MiddlewareParams) Store() *database.Database {
+	return p.store
+}
+
 func (p *MiddlewareParams) Token() string {
 	return p.token
 }
 
+func (p *MiddlewareParams) JWT() *jwt.Verifier {
+	return p.jwt
+}
+
+func (p *MiddlewareParams) Claims() JWTMapping {
+	return p.claims
+}
+
+func (p *MiddlewareParams) Limiter() ratelimit.Limiter {
+	return p.limiter
+}
+
+func (p *MiddlewareParams) Policies() map[string]ratelimit.Policy {
+	return p.policies
+}
+
+func (p *MiddlewareParams) CORSPolicies() map[string]CORSPolicy {
+	return p.cors
+}
+
+func (p *MiddlewareParams) RealIP() *realip.Resolver {
+	return p.realIP
+}
+
+func (p *MiddlewareParams) Metrics() *metrics.Metrics {
+	return p.metrics
+}
+
 func (p *MiddlewareParams) SetLogger(logger *slog.Logger) {
 	p.logger = logger
 }
 
+func (p *MiddlewareParams) SetStore(store *database.Database) {
+	p.store = store
+}
+
 func (p *MiddlewareParams) SetToken(token string) {
 	p.token = token
 }
 
+func (p *MiddlewareParams) SetJWT(verifier *jwt.Verifier, mapping JWTMapping) {
+	p.jwt = verifier
+	p.claims = mapping
+}
+
 func (p *MiddlewareParams) SetConfig(config *config.Config) {
 	p.config = config
 }
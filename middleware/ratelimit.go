@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/pkg/auth"
+	"github.com/thiagozs/go-shorturl/pkg/realip"
+)
+
+// RateLimit returns a middleware function limiting requests with the policy
+// of group. Authenticated requests are limited per principal, the others per
+// client IP. When the limiter fails the request is let through.
+func (m *Middleware) RateLimit(group string) MiddlewaresFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			limiter := m.params.Limiter()
+			policy, ok := m.params.Policies()[group]
+			if limiter == nil || !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key := group + ":" + rateLimitKey(r)
+			res, err := limiter.Allow(r.Context(), key, policy)
+			if err != nil {
+				m.logger.Error("Rate limiter failed", slog.String("group", group),
+					slog.String("error", err.Error()))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(policy.Burst))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", policy.Burst, ceilSeconds(policy.Window())))
+
+			if !res.Allowed {
+				retryAfter := ceilSeconds(res.RetryAfter)
+				m.logger.Warn("Rate limit exceeded", slog.String("group", group),
+					slog.String("remote_addr", realip.FromRequest(r)))
+
+				h.Set("Retry-After", strconv.Itoa(retryAfter))
+				h.Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusTooManyRequests)
+				json.NewEncoder(w).Encode(map[string]any{
+					"error":       "rate limit exceeded",
+					"retry_after": retryAfter,
+				})
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		}
+	}
+}
+
+// rateLimitKey identifies the caller: the principal Authenticate resolved,
+// otherwise its IP address. Tokens that failed to authenticate count against
+// the IP so random ones cannot open fresh buckets.
+func rateLimitKey(r *http.Request) string {
+	if p, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return "principal:" + p.Method + ":" + p.Subject
+	}
+
+	return "ip:" + realip.FromRequest(r)
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,257 @@
+package analytics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+	"github.com/thiagozs/go-shorturl/pkg/useragent"
+)
+
+// Granularities of a time series
+const (
+	Hour = "hour"
+	Day  = "day"
+)
+
+// Dimensions a report breaks clicks down by
+const (
+	DimCountry  = "country"
+	DimReferrer = "referrer"
+	DimBrowser  = "browser"
+	DimOS       = "os"
+	DimDevice   = "device"
+	DimSource   = "source"
+)
+
+// Direct is the referrer of clicks that did not send one
+const Direct = "direct"
+
+// maxBuckets bounds the length of a time series
+const maxBuckets = 24 * 366
+
+// NewEvent turns a click into the event kept for analytics
+func NewEvent(click model.Click) model.ClickEvent {
+	agent := useragent.Parse(click.UserAgent)
+
+	sum := sha256.Sum256([]byte(click.IP + "|" + click.UserAgent))
+
+	country := click.Location.CountryCode
+	if country == "" {
+		country = useragent.Unknown
+	}
+
+	source := click.Source
+	if source == "" {
+		source = model.SourceLink
+	}
+
+	return model.ClickEvent{
+		ShortURL: click.ShortURL,
+		At:       click.At.UTC(),
+		Visitor:  hex.EncodeToString(sum[:8]),
+		Country:  country,
+		Referrer: ReferrerDomain(click.Referrer),
+		Browser:  agent.Browser,
+		OS:       agent.OS,
+		Device:   agent.Device,
+		Bot:      click.Bot,
+		Source:   source,
+	}
+}
+
+// ReferrerDomain reduces a Referer header to its host without "www."
+func ReferrerDomain(referrer string) string {
+	if referrer == "" {
+		return Direct
+	}
+
+	u, err := url.Parse(referrer)
+	if err != nil || u.Hostname() == "" {
+		return useragent.Unknown
+	}
+
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// Query selects the clicks of a report and how they are grouped
+type Query struct {
+	From        time.Time
+	To          time.Time
+	Granularity string
+	Top         int
+	IncludeBots bool
+}
+
+// Validate checks the query and fills in the granularity when it is empty:
+// hourly for ranges up to two days, daily otherwise
+func (q *Query) Validate() error {
+	if !q.From.Before(q.To) {
+		return fmt.Errorf("from must be before to")
+	}
+
+	if q.Granularity == "" {
+		q.Granularity = Day
+		if q.To.Sub(q.From) <= 48*time.Hour {
+			q.Granularity = Hour
+		}
+	}
+
+	step, err := stepOf(q.Granularity)
+	if err != nil {
+		return err
+	}
+
+	if q.To.Sub(q.From)/step > maxBuckets {
+		return fmt.Errorf("time range too large for %s granularity", q.Granularity)
+	}
+
+	if q.Top <= 0 {
+		return fmt.Errorf("top must be positive")
+	}
+
+	return nil
+}
+
+func stepOf(granularity string) (time.Duration, error) {
+	switch granularity {
+	case Hour:
+		return time.Hour, nil
+	case Day:
+		return 24 * time.Hour, nil
+	default:
+		return 0, fmt.Errorf("unknown granularity %q", granularity)
+	}
+}
+
+// Point is one bucket of a time series
+type Point struct {
+	Time   time.Time `json:"time"`
+	Clicks int       `json:"clicks"`
+	Unique int       `json:"unique"`
+}
+
+// Count is how often a value of a dimension was seen
+type Count struct {
+	Value  string `json:"value"`
+	Clicks int    `json:"clicks"`
+}
+
+// Report is the aggregated view of the clicks of a link
+type Report struct {
+	ShortURL    string             `json:"short_url"`
+	From        time.Time          `json:"from"`
+	To          time.Time          `json:"to"`
+	Granularity string             `json:"granularity"`
+	Clicks      int                `json:"clicks"`
+	Unique      int                `json:"unique_visitors"`
+	Bots        int                `json:"bot_clicks"`
+	Series      []Point            `json:"series"`
+	Breakdowns  map[string][]Count `json:"breakdowns"`
+}
+
+// Aggregate builds the report of q from events. Buckets are aligned to UTC
+// hours or days and empty buckets are kept so the series can be plotted as
+// is. Unique visitors are estimated from distinct visitor hashes. Bot hits
+// are counted apart and left out of the rest unless IncludeBots is set.
+func Aggregate(shortURL string, events []model.ClickEvent, q Query) Report {
+	step, _ := stepOf(q.Granularity)
+	start := q.From.UTC().Truncate(step)
+
+	report := Report{
+		ShortURL:    shortURL,
+		From:        q.From.UTC(),
+		To:          q.To.UTC(),
+		Granularity: q.Granularity,
+		Series:      []Point{},
+	}
+
+	clicks := map[time.Time]int{}
+	buckets := map[time.Time]map[string]bool{}
+	visitors := map[string]bool{}
+	counts := map[string]map[string]int{
+		DimCountry: {}, DimReferrer: {}, DimBrowser: {}, DimOS: {}, DimDevice: {}, DimSource: {},
+	}
+
+	for _, e := range events {
+		if e.At.Before(q.From) || !e.At.Before(q.To) {
+			continue
+		}
+
+		if e.Bot {
+			report.Bots++
+			if !q.IncludeBots {
+				continue
+			}
+		}
+
+		report.Clicks++
+		visitors[e.Visitor] = true
+
+		bucket := e.At.UTC().Truncate(step)
+		clicks[bucket]++
+		if buckets[bucket] == nil {
+			buckets[bucket] = map[string]bool{}
+		}
+		buckets[bucket][e.Visitor] = true
+
+		counts[DimCountry][e.Country]++
+		counts[DimReferrer][e.Referrer]++
+		counts[DimBrowser][e.Browser]++
+		counts[DimOS][e.OS]++
+		counts[DimDevice][e.Device]++
+		counts[DimSource][e.Source]++
+	}
+	report.Unique = len(visitors)
+
+	for t := start; t.Before(q.To); t = t.Add(step) {
+		report.Series = append(report.Series, Point{Time: t, Clicks: clicks[t], Unique: len(buckets[t])})
+	}
+
+	report.Breakdowns = make(map[string][]Count, len(counts))
+	for dim, values := range counts {
+		report.Breakdowns[dim] = top(values, q.Top)
+	}
+
+	return report
+}
+
+// top returns the n most frequent values, ties broken by name
+func top(values map[string]int, n int) []Count {
+	out := make([]Count, 0, len(values))
+	for v, c := range values {
+		out = append(out, Count{Value: v, Clicks: c})
+	}
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Clicks != out[j].Clicks {
+			return out[i].Clicks > out[j].Clicks
+		}
+		return out[i].Value < out[j].Value
+	})
+
+	if len(out) > n {
+		out = out[:n]
+	}
+
+	return out
+}
+
+// ParseTime accepts an RFC 3339 timestamp or a YYYY-MM-DD date (midnight UTC)
+func ParseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t.UTC(), nil
+	}
+
+	t, err := time.Parse(time.DateOnly, s)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339 or YYYY-MM-DD", s)
+	}
+
+	return t, nil
+}
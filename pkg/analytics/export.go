@@ -0,0 +1,92 @@
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+)
+
+// Export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// exportHeader is the first row of a CSV export
+var exportHeader = []string{"short_url", "at", "visitor", "country", "referrer", "browser", "os", "device", "bot", "source"}
+
+// Exporter writes click events one at a time
+type Exporter interface {
+	Write(e model.ClickEvent) error
+	// Flush pushes buffered events to the underlying writer
+	Flush() error
+}
+
+// ContentType returns the media type of an export format
+func ContentType(format string) string {
+	if format == FormatNDJSON {
+		return "application/x-ndjson"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// NewExporter returns an exporter writing format to w
+func NewExporter(w io.Writer, format string) (Exporter, error) {
+	switch format {
+	case FormatCSV, "":
+		return &csvExporter{w: csv.NewWriter(w)}, nil
+	case FormatNDJSON:
+		return &ndjsonExporter{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unknown export format %q, use csv or ndjson", format)
+	}
+}
+
+type csvExporter struct {
+	w      *csv.Writer
+	header bool
+}
+
+func (x *csvExporter) Write(e model.ClickEvent) error {
+	if !x.header {
+		x.header = true
+		if err := x.w.Write(exportHeader); err != nil {
+			return err
+		}
+	}
+
+	return x.w.Write([]string{
+		e.ShortURL, e.At.UTC().Format(time.RFC3339Nano), e.Visitor, e.Country,
+		e.Referrer, e.Browser, e.OS, e.Device, strconv.FormatBool(e.Bot), e.Source,
+	})
+}
+
+// Flush also writes the header of an empty export
+func (x *csvExporter) Flush() error {
+	if !x.header {
+		x.header = true
+		if err := x.w.Write(exportHeader); err != nil {
+			return err
+		}
+	}
+
+	x.w.Flush()
+	return x.w.Error()
+}
+
+type ndjsonExporter struct {
+	enc *json.Encoder
+}
+
+func (x *ndjsonExporter) Write(e model.ClickEvent) error {
+	return x.enc.Encode(e)
+}
+
+func (x *ndjsonExporter) Flush() error {
+	return nil
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+)
+
+// Scopes that can be granted to a credential
+const (
+	ScopeLinksWrite  = "links:write"
+	ScopeStatsRead   = "stats:read"
+	ScopeMetricsRead = "metrics:read"
+	ScopeAdmin       = "admin"
+)
+
+// keyPrefix marks a string as one of our API keys
+const keyPrefix = "sk_"
+
+// Scopes returns every scope known to the server
+func Scopes() []string {
+	return []string{ScopeLinksWrite, ScopeStatsRead, ScopeMetricsRead, ScopeAdmin}
+}
+
+// ParseScopes splits a comma or space separated list and rejects unknown
+// scopes
+func ParseScopes(s string) ([]string, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+
+	scopes := make([]string, 0, len(fields))
+	for _, scope := range fields {
+		if !slices.Contains(Scopes(), scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+
+	return scopes, nil
+}
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	// Name identifies the credential, e.g. the API key name
+	Name string
+	// Subject identifies who the credential belongs to
+	Subject string
+	Scopes  []string
+	// Method is how the caller authenticated, e.g. "api_key"
+	Method string
+}
+
+// HasScope reports whether the principal was granted scope. The admin scope
+// grants every other scope.
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	return slices.Contains(p.Scopes, scope) || slices.Contains(p.Scopes, ScopeAdmin)
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying p
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFromContext returns the principal stored by WithPrincipal, if any
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
+
+// HashKey returns the value stored for a plaintext key
+func HashKey(plaintext string) string {
+	sum := sha256.Sum256([]byte(plaintext))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether token looks like a key created by NewAPIKey
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, keyPrefix)
+}
+
+// NewAPIKey creates a key with a random secret. The plaintext secret is
+// returned separately and is not recoverable from the key. A zero ttl creates
+// a key that never expires.
+func NewAPIKey(name string, scopes []string, ttl time.Duration) (model.APIKey, string, error) {
+	if name == "" {
+		return model.APIKey{}, "", fmt.Errorf("name is required")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return model.APIKey{}, "", err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return model.APIKey{}, "", err
+	}
+
+	plaintext := keyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	now := time.Now().UTC()
+
+	key := model.APIKey{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		Prefix:    plaintext[:len(keyPrefix)+6],
+		Hash:      HashKey(plaintext),
+		Scopes:    scopes,
+		CreatedAt: now,
+	}
+
+	if ttl > 0 {
+		expires := now.Add(ttl)
+		key.ExpiresAt = &expires
+	}
+
+	return key, plaintext, nil
+}
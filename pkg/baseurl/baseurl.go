@@ -0,0 +1,78 @@
+package baseurl
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/thiagozs/go-shorturl/pkg/realip"
+)
+
+// Builder builds the public URLs of short links. A configured base URL
+// wins and its path prefixes every link. Otherwise the scheme comes from the
+// request, as forwarded by trusted proxies, and the host is the primary
+// domain, or in local mode the host the request was sent to.
+type Builder struct {
+	params *BuilderParams
+}
+
+func New(opts ...Options) (*Builder, error) {
+	params, err := newBuilderParams(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Builder{params: params}, nil
+}
+
+// Prefix returns the path routes are mounted under, such as /s, or "" when
+// they are at the root
+func (b *Builder) Prefix() string {
+	if base := b.params.Base(); base != nil {
+		return base.Path
+	}
+	return ""
+}
+
+// Build returns the URL of code on domain, the primary domain when empty.
+// r is the request being answered, nil outside of one.
+func (b *Builder) Build(r *http.Request, domain, code string) string {
+	u := url.URL{Scheme: "http", Path: b.Prefix() + "/" + code}
+
+	switch base := b.params.Base(); {
+	case base != nil:
+		u.Scheme, u.Host = base.Scheme, base.Host
+	case b.params.Local():
+		u.Host = net.JoinHostPort(b.localHost(), b.params.Port())
+		if r != nil {
+			origin := realip.OriginFromRequest(r)
+			u.Scheme, u.Host = origin.Scheme, origin.Host
+		}
+	default:
+		u.Host = b.params.Domain()
+		if r != nil {
+			u.Scheme = realip.OriginFromRequest(r).Scheme
+		}
+	}
+
+	// Other domains share the scheme and prefix of the primary one
+	if domain != "" && domain != b.params.Domain() {
+		u.Host = domain
+	}
+
+	if b.params.HTTPS() && b.params.Base() == nil {
+		u.Scheme = "https"
+	}
+
+	return u.String()
+}
+
+// localHost is the host of local mode links outside of a request
+func (b *Builder) localHost() string {
+	switch host := b.params.Host(); host {
+	case "", "0.0.0.0", "::":
+		return "localhost"
+	default:
+		return host
+	}
+}
@@ -0,0 +1,134 @@
+package baseurl
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+type Options func(*BuilderParams) error
+
+type BuilderParams struct {
+	base   *url.URL
+	domain string
+	host   string
+	port   string
+	https  bool
+	local  bool
+}
+
+func newBuilderParams(opts ...Options) (*BuilderParams, error) {
+	params := &BuilderParams{}
+	for _, opt := range opts {
+		if err := opt(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// WithBaseURL sets the public URL links are built on, such as
+// https://example.com/s/. Its path is the prefix routes are mounted under.
+// An empty raw URL leaves links to be built from the request.
+func WithBaseURL(raw string) Options {
+	return func(p *BuilderParams) error {
+		if raw == "" {
+			p.base = nil
+			return nil
+		}
+
+		base, err := Parse(raw)
+		if err != nil {
+			return err
+		}
+		p.base = base
+		return nil
+	}
+}
+
+// WithDomain sets the primary domain, used for links outside local mode
+func WithDomain(domain string) Options {
+	return func(p *BuilderParams) error {
+		p.domain = strings.ToLower(domain)
+		return nil
+	}
+}
+
+// WithHost sets the address the server listens on, used for links in local
+// mode outside of a request
+func WithHost(host string) Options {
+	return func(p *BuilderParams) error {
+		p.host = host
+		return nil
+	}
+}
+
+func WithPort(port string) Options {
+	return func(p *BuilderParams) error {
+		p.port = port
+		return nil
+	}
+}
+
+// WithHTTPS forces https links whatever scheme the request came with
+func WithHTTPS(https bool) Options {
+	return func(p *BuilderParams) error {
+		p.https = https
+		return nil
+	}
+}
+
+// WithLocal builds links on the host the request was sent to instead of the
+// primary domain
+func WithLocal(local bool) Options {
+	return func(p *BuilderParams) error {
+		p.local = local
+		return nil
+	}
+}
+
+// Parse checks a base URL: an absolute http or https URL without
+// credentials, query or fragment
+func Parse(raw string) (*url.URL, error) {
+	base, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url %q: %w", raw, err)
+	}
+
+	if base.Scheme != "http" && base.Scheme != "https" || base.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q: must be an absolute http or https URL", raw)
+	}
+	if base.User != nil || base.RawQuery != "" || base.Fragment != "" {
+		return nil, fmt.Errorf("invalid base url %q: credentials, query and fragment are not allowed", raw)
+	}
+
+	base.Path = strings.TrimRight(base.Path, "/")
+	base.RawPath = ""
+	return base, nil
+}
+
+// getters -----
+
+func (p *BuilderParams) Base() *url.URL {
+	return p.base
+}
+
+func (p *BuilderParams) Domain() string {
+	return p.domain
+}
+
+func (p *BuilderParams) Host() string {
+	return p.host
+}
+
+func (p *BuilderParams) Port() string {
+	return p.port
+}
+
+func (p *BuilderParams) HTTPS() bool {
+	return p.https
+}
+
+func (p *BuilderParams) Local() bool {
+	return p.local
+}
@@ -0,0 +1,70 @@
+package botdetect
+
+import (
+	"net/http"
+	"strings"
+)
+
+// DefaultPatterns match the user agents of common crawlers, link preview
+// fetchers of chat apps and social networks, and HTTP libraries
+var DefaultPatterns = []string{
+	"bot", "crawler", "spider", "slurp", "crawl",
+	"facebookexternalhit", "facebookcatalog", "meta-externalagent",
+	"whatsapp", "telegrambot", "slackbot", "slack-imgproxy", "discordbot",
+	"twitterbot", "linkedinbot", "skypeuripreview", "pinterest", "redditbot",
+	"embedly", "vkshare", "iframely", "bitlybot", "google-pagerenderer",
+	"googleother", "applebot", "yahoo! slurp", "duckduckbot", "baiduspider",
+	"headlesschrome", "phantomjs", "lighthouse", "preview",
+	"curl/", "wget/", "python-requests", "python-urllib", "go-http-client",
+	"java/", "okhttp", "libwww-perl", "httpclient", "axios/", "node-fetch",
+}
+
+// Verdict tells whether a request came from a bot and why
+type Verdict struct {
+	Bot    bool
+	Reason string
+}
+
+// Detector classifies requests by user agent and a few heuristics
+type Detector struct {
+	patterns []string
+}
+
+// New returns a detector matching the given case-insensitive substrings
+func New(patterns []string) *Detector {
+	d := &Detector{}
+	for _, p := range patterns {
+		if p = strings.ToLower(strings.TrimSpace(p)); p != "" {
+			d.patterns = append(d.patterns, p)
+		}
+	}
+	return d
+}
+
+// Classify looks at the user agent first, then at signs that the request is
+// a prefetch or preview rather than a visit
+func (d *Detector) Classify(r *http.Request) Verdict {
+	ua := strings.ToLower(r.UserAgent())
+	if strings.TrimSpace(ua) == "" {
+		return Verdict{Bot: true, Reason: "empty user agent"}
+	}
+
+	for _, p := range d.patterns {
+		if strings.Contains(ua, p) {
+			return Verdict{Bot: true, Reason: "user agent matches " + p}
+		}
+	}
+
+	if r.Method == http.MethodHead {
+		return Verdict{Bot: true, Reason: "HEAD request"}
+	}
+
+	for _, h := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		v := strings.ToLower(r.Header.Get(h))
+		if strings.Contains(v, "prefetch") || strings.Contains(v, "preview") {
+			return Verdict{Bot: true, Reason: h + " header"}
+		}
+	}
+
+	return Verdict{}
+}
@@ -0,0 +1,197 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cipherSuites are the TLS 1.2 suites offered, forward secret AEAD only.
+// TLS 1.3 suites are not configurable and all of them are safe.
+var cipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+type certSet struct {
+	// certs in the configured order, the first one is the default
+	certs []*tls.Certificate
+	// names maps DNS names, including wildcards, to their certificate
+	names map[string]*tls.Certificate
+	// mtimes of the files the certificates were read from
+	mtimes map[string]time.Time
+}
+
+// Store serves certificates from PEM files, picking one by the server name
+// the client asks for (SNI). The files are re-read when they change on
+// disk, checked at most once per reload interval during handshakes, so
+// renewed certificates are picked up without a restart.
+type Store struct {
+	params *StoreParams
+
+	current   atomic.Pointer[certSet]
+	reloading sync.Mutex
+	checked   atomic.Int64 // unix nanoseconds of the last change check
+	// reloadErr holds the error of the last failed hot reload, cleared by
+	// the next successful one
+	reloadErr atomic.Pointer[error]
+}
+
+func New(opts ...Options) (*Store, error) {
+	params, err := newStoreParams(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Logger() == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+	if len(params.Pairs()) == 0 {
+		return nil, fmt.Errorf("at least one certificate is required")
+	}
+
+	s := &Store{params: params}
+	if err := s.Reload(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// TLSConfig returns a server configuration with modern defaults serving the
+// certificates of the store
+func (s *Store) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:       s.params.MinVersion(),
+		CipherSuites:     cipherSuites,
+		CurvePreferences: []tls.CurveID{tls.X25519, tls.CurveP256},
+		GetCertificate:   s.GetCertificate,
+	}
+}
+
+// GetCertificate picks the certificate for the server name of a handshake:
+// an exact match, then a wildcard match, then the first certificate
+func (s *Store) GetCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	s.maybeReload()
+	set := s.current.Load()
+
+	name := strings.ToLower(strings.TrimSuffix(hello.ServerName, "."))
+	if cert, ok := set.names[name]; ok {
+		return cert, nil
+	}
+	if _, parent, ok := strings.Cut(name, "."); ok {
+		if cert, ok := set.names["*."+parent]; ok {
+			return cert, nil
+		}
+	}
+
+	return set.certs[0], nil
+}
+
+// Reload reads every certificate again, keeping the current ones when any
+// of them fails to load
+func (s *Store) Reload() error {
+	set := &certSet{
+		names:  map[string]*tls.Certificate{},
+		mtimes: map[string]time.Time{},
+	}
+
+	for _, pair := range s.params.Pairs() {
+		for _, path := range []string{pair.CertFile, pair.KeyFile} {
+			info, err := os.Stat(path)
+			if err != nil {
+				return err
+			}
+			set.mtimes[path] = info.ModTime()
+		}
+
+		cert, err := tls.LoadX509KeyPair(pair.CertFile, pair.KeyFile)
+		if err != nil {
+			return fmt.Errorf("load %s: %w", pair.CertFile, err)
+		}
+
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return fmt.Errorf("parse %s: %w", pair.CertFile, err)
+		}
+		cert.Leaf = leaf
+
+		if time.Now().After(leaf.NotAfter) {
+			s.params.Logger().Warn("Serving an expired certificate", slog.String("file", pair.CertFile),
+				slog.Time("not_after", leaf.NotAfter))
+		}
+
+		set.certs = append(set.certs, &cert)
+		for _, name := range leaf.DNSNames {
+			name = strings.ToLower(name)
+			// The first certificate listing a name wins
+			if _, ok := set.names[name]; !ok {
+				set.names[name] = &cert
+			}
+		}
+	}
+
+	s.current.Store(set)
+	s.checked.Store(time.Now().UnixNano())
+	s.reloadErr.Store(nil)
+	return nil
+}
+
+// Health returns why the last hot reload failed, or nil when the
+// certificates on disk are the ones being served
+func (s *Store) Health() error {
+	if err := s.reloadErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// maybeReload reloads the certificates when a file changed, checking at
+// most once per reload interval and never blocking a handshake on another
+// reload
+func (s *Store) maybeReload() {
+	last := time.Unix(0, s.checked.Load())
+	if time.Since(last) < s.params.ReloadInterval() {
+		return
+	}
+
+	if !s.reloading.TryLock() {
+		return
+	}
+	changed := s.changed()
+	s.checked.Store(time.Now().UnixNano())
+	s.reloading.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if err := s.Reload(); err != nil {
+		s.reloadErr.Store(&err)
+		s.params.Logger().Error("Failed to reload certificates, keeping previous ones",
+			slog.String("error", err.Error()))
+		return
+	}
+
+	s.params.Logger().Info("Reloaded certificates")
+}
+
+func (s *Store) changed() bool {
+	for path, mtime := range s.current.Load().mtimes {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(mtime) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,99 @@
+package certs
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type Options func(*StoreParams) error
+
+type StoreParams struct {
+	logger         *slog.Logger
+	pairs          []Pair
+	reloadInterval time.Duration
+	minVersion     uint16
+}
+
+// Pair is a certificate chain file and its private key file, both PEM
+type Pair struct {
+	CertFile string
+	KeyFile  string
+}
+
+func newStoreParams(opts ...Options) (*StoreParams, error) {
+	params := &StoreParams{
+		reloadInterval: 30 * time.Second,
+		minVersion:     tls.VersionTLS12,
+	}
+	for _, opt := range opts {
+		if err := opt(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+func WithLogger(logger *slog.Logger) Options {
+	return func(p *StoreParams) error {
+		p.logger = logger
+		return nil
+	}
+}
+
+// WithPair adds a certificate and its key. The first pair is served to
+// clients whose server name matches no certificate.
+func WithPair(certFile, keyFile string) Options {
+	return func(p *StoreParams) error {
+		if certFile == "" || keyFile == "" {
+			return fmt.Errorf("both a certificate and a key file are required")
+		}
+		p.pairs = append(p.pairs, Pair{CertFile: certFile, KeyFile: keyFile})
+		return nil
+	}
+}
+
+// WithReloadInterval sets how often the files are checked for changes
+func WithReloadInterval(interval time.Duration) Options {
+	return func(p *StoreParams) error {
+		if interval <= 0 {
+			return fmt.Errorf("reload interval must be positive, got %s", interval)
+		}
+		p.reloadInterval = interval
+		return nil
+	}
+}
+
+// WithMinVersion sets the oldest TLS version accepted: "1.2" or "1.3"
+func WithMinVersion(version string) Options {
+	return func(p *StoreParams) error {
+		switch version {
+		case "", "1.2":
+			p.minVersion = tls.VersionTLS12
+		case "1.3":
+			p.minVersion = tls.VersionTLS13
+		default:
+			return fmt.Errorf("unsupported TLS version %q, use 1.2 or 1.3", version)
+		}
+		return nil
+	}
+}
+
+// getters -----
+
+func (p *StoreParams) Logger() *slog.Logger {
+	return p.logger
+}
+
+func (p *StoreParams) Pairs() []Pair {
+	return p.pairs
+}
+
+func (p *StoreParams) ReloadInterval() time.Duration {
+	return p.reloadInterval
+}
+
+func (p *StoreParams) MinVersion() uint16 {
+	return p.minVersion
+}
@@ -0,0 +1,639 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// URLStats holds the statistics for a shortened URL as returned by /stats
+type URLStats struct {
+	Count           int               `json:"count"`
+	BotCount        int               `json:"bot_count"`
+	ScanCount       int               `json:"scan_count"`
+	LastIPs         []string          `json:"last_ips"`
+	Referrers       []string          `json:"referrers"`
+	LastGeoLocation string            `json:"last_geo_location"`
+	LastLocation    Location          `json:"last_location"`
+	Tags            []string          `json:"tags"`
+	Title           string            `json:"title,omitempty"`
+	RedirectCode    int               `json:"redirect_code,omitempty"`
+	QueryPolicy     string            `json:"query_policy,omitempty"`
+	UTM             map[string]string `json:"utm,omitempty"`
+	CreatedBy       string            `json:"created_by,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+}
+
+// Location is where a click came from
+type Location struct {
+	Country     string `json:"country,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+	Region      string `json:"region,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+// APIKey describes a stored API key. The secret is only returned by
+// CreateAPIKey.
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+}
+
+// Domain is a short domain and its settings
+type Domain struct {
+	Name            string    `json:"name"`
+	RedirectCode    int       `json:"redirect_code,omitempty"`
+	NotFoundURL     string    `json:"not_found_url,omitempty"`
+	AllowedCreators []string  `json:"allowed_creators,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// Client talks to a running shortener server over its HTTP API
+type Client struct {
+	params  *ClientParams
+	baseURL *url.URL
+}
+
+func NewClient(opts ...Options) (*Client, error) {
+	params, err := newClientParams(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.BaseURL() == "" {
+		return nil, fmt.Errorf("base url is required")
+	}
+
+	base, err := url.Parse(strings.TrimRight(params.BaseURL(), "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+
+	return &Client{params: params, baseURL: base}, nil
+}
+
+// ShortenOptions are the optional settings of a new link. Zero values leave
+// the choice to the server and the domain.
+type ShortenOptions struct {
+	Tags []string
+	// Domain is the short domain the link goes on, the primary one when
+	// empty
+	Domain       string
+	Title        string
+	RedirectCode int
+	// QueryPolicy is drop, append or override
+	QueryPolicy string
+	// UTM maps utm_* parameter names to templates, which may use {code},
+	// {domain} and {source}
+	UTM map[string]string
+}
+
+// Shorten creates a new short URL for originalURL and returns it
+func (c *Client) Shorten(ctx context.Context, originalURL string, opts ShortenOptions) (string, error) {
+	var out struct {
+		ShortURL string `json:"short_url"`
+	}
+
+	q := url.Values{"url": {originalURL}}
+	if len(opts.Tags) > 0 {
+		q.Set("tags", strings.Join(opts.Tags, ","))
+	}
+	if opts.Domain != "" {
+		q.Set("domain", opts.Domain)
+	}
+	if opts.Title != "" {
+		q.Set("title", opts.Title)
+	}
+	if opts.RedirectCode != 0 {
+		q.Set("redirect_code", strconv.Itoa(opts.RedirectCode))
+	}
+	if opts.QueryPolicy != "" {
+		q.Set("query_policy", opts.QueryPolicy)
+	}
+	for name, tpl := range opts.UTM {
+		if !strings.HasPrefix(name, "utm_") {
+			return "", fmt.Errorf("unknown UTM parameter %q", name)
+		}
+		q.Set(name, tpl)
+	}
+
+	if err := c.do(ctx, http.MethodPost, "/shorten", q, nil, &out); err != nil {
+		return "", err
+	}
+
+	return out.ShortURL, nil
+}
+
+// Stats returns the statistics for the given short code on domain, the
+// primary domain when empty
+func (c *Client) Stats(ctx context.Context, domain, code string) (*URLStats, error) {
+	stats := &URLStats{}
+
+	if err := c.do(ctx, http.MethodGet, "/stats", linkQuery(domain, code), nil, stats); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// AnalyticsQuery selects the clicks of an analytics report. Zero values
+// leave the choice to the server: the last 7 days, hourly or daily buckets
+// depending on the range and the top 10 values of each dimension.
+type AnalyticsQuery struct {
+	// Domain is the short domain of the link, the primary one when empty
+	Domain      string
+	From        time.Time
+	To          time.Time
+	Granularity string
+	Top         int
+	IncludeBots bool
+}
+
+// AnalyticsPoint is one bucket of a time series
+type AnalyticsPoint struct {
+	Time   time.Time `json:"time"`
+	Clicks int       `json:"clicks"`
+	Unique int       `json:"unique"`
+}
+
+// AnalyticsCount is how often a value of a dimension was seen
+type AnalyticsCount struct {
+	Value  string `json:"value"`
+	Clicks int    `json:"clicks"`
+}
+
+// Analytics is the time series and breakdowns of the clicks of a link
+type Analytics struct {
+	ShortURL    string                      `json:"short_url"`
+	From        time.Time                   `json:"from"`
+	To          time.Time                   `json:"to"`
+	Granularity string                      `json:"granularity"`
+	Clicks      int                         `json:"clicks"`
+	Unique      int                         `json:"unique_visitors"`
+	Bots        int                         `json:"bot_clicks"`
+	Series      []AnalyticsPoint            `json:"series"`
+	Breakdowns  map[string][]AnalyticsCount `json:"breakdowns"`
+}
+
+// Analytics returns the time series and top-N breakdowns of the clicks of a
+// short code
+func (c *Client) Analytics(ctx context.Context, code string, query AnalyticsQuery) (*Analytics, error) {
+	q := linkQuery(query.Domain, code)
+	if !query.From.IsZero() {
+		q.Set("from", query.From.UTC().Format(time.RFC3339))
+	}
+	if !query.To.IsZero() {
+		q.Set("to", query.To.UTC().Format(time.RFC3339))
+	}
+	if query.Granularity != "" {
+		q.Set("granularity", query.Granularity)
+	}
+	if query.Top > 0 {
+		q.Set("top", strconv.Itoa(query.Top))
+	}
+	if query.IncludeBots {
+		q.Set("include_bots", "true")
+	}
+
+	report := &Analytics{}
+	if err := c.do(ctx, http.MethodGet, "/stats/query", q, nil, report); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ExportQuery filters the click events of an export. Zero values match
+// everything; Format is csv unless set to ndjson.
+type ExportQuery struct {
+	Format   string
+	ShortURL string
+	// Domain is the short domain of ShortURL, the primary one when empty
+	Domain      string
+	Tag         string
+	From        time.Time
+	To          time.Time
+	IncludeBots bool
+}
+
+// Export streams raw click events to w as they arrive. A failure halfway
+// leaves a partial export in w and is not retried.
+func (c *Client) Export(ctx context.Context, query ExportQuery, w io.Writer) error {
+	q := url.Values{}
+	if query.ShortURL != "" {
+		q = linkQuery(query.Domain, query.ShortURL)
+	}
+	if query.Format != "" {
+		q.Set("format", query.Format)
+	}
+	if query.Tag != "" {
+		q.Set("tag", query.Tag)
+	}
+	if !query.From.IsZero() {
+		q.Set("from", query.From.UTC().Format(time.RFC3339))
+	}
+	if !query.To.IsZero() {
+		q.Set("to", query.To.UTC().Format(time.RFC3339))
+	}
+	if query.IncludeBots {
+		q.Set("include_bots", "true")
+	}
+
+	return c.do(ctx, http.MethodGet, "/export", q, nil, w)
+}
+
+// Update points an existing short code on domain at newURL, the primary
+// domain when empty
+func (c *Client) Update(ctx context.Context, domain, code, newURL string) error {
+	q := linkQuery(domain, code)
+	q.Set("new_url", newURL)
+	return c.do(ctx, http.MethodPost, "/update", q, nil, nil)
+}
+
+// QROptions are the rendering settings of a QR code. Zero values use the
+// server defaults: a 256 pixel PNG at level M with a margin of 4 modules.
+type QROptions struct {
+	// Domain is the short domain of the link, the primary one when empty
+	Domain string
+	// Format is png or svg
+	Format string
+	Size   int
+	// Level is the error correction level: L, M, Q or H
+	Level  string
+	Margin *int
+	// Foreground and Background are hex colors such as 000 or 1a2b3c
+	Foreground string
+	Background string
+	// Track encodes a link whose clicks count as scans
+	Track bool
+}
+
+// QR writes the QR code of the given short code to w
+func (c *Client) QR(ctx context.Context, code string, opts QROptions, w io.Writer) error {
+	q := url.Values{}
+	if opts.Format != "" {
+		q.Set("format", opts.Format)
+	}
+	if opts.Size != 0 {
+		q.Set("size", strconv.Itoa(opts.Size))
+	}
+	if opts.Level != "" {
+		q.Set("level", opts.Level)
+	}
+	if opts.Margin != nil {
+		q.Set("margin", strconv.Itoa(*opts.Margin))
+	}
+	if opts.Foreground != "" {
+		q.Set("fg", opts.Foreground)
+	}
+	if opts.Background != "" {
+		q.Set("bg", opts.Background)
+	}
+	if opts.Track {
+		q.Set("track", "true")
+	}
+
+	// QR codes are served on the domain the request is sent to
+	return c.doHost(ctx, opts.Domain, http.MethodGet, "/qr/"+code, q, nil, w)
+}
+
+// Flush removes every link from the server and returns what was removed
+func (c *Client) Flush(ctx context.Context) (map[string]string, error) {
+	backup := map[string]string{}
+	if err := c.do(ctx, http.MethodPost, "/flush", nil, nil, &backup); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// Backup returns every short code and its original URL
+func (c *Client) Backup(ctx context.Context) (map[string]string, error) {
+	backup := map[string]string{}
+	if err := c.do(ctx, http.MethodGet, "/backup", nil, nil, &backup); err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// Import loads the given short code to original URL mappings into the server
+func (c *Client) Import(ctx context.Context, urls map[string]string) error {
+	body, err := json.Marshal(urls)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "/import", nil, body, nil)
+}
+
+// Restore replaces every link with urls. The server checks every URL first
+// and leaves the links untouched when any is rejected.
+func (c *Client) Restore(ctx context.Context, urls map[string]string) error {
+	body, err := json.Marshal(urls)
+	if err != nil {
+		return err
+	}
+	return c.do(ctx, http.MethodPost, "/import", url.Values{"replace": {"true"}}, body, nil)
+}
+
+// CreateAPIKey creates a key with the given scopes and returns it with its
+// secret. A zero ttl creates a key that never expires.
+func (c *Client) CreateAPIKey(ctx context.Context, name string, scopes []string, ttl time.Duration) (*APIKey, string, error) {
+	var out struct {
+		Key   *APIKey `json:"key"`
+		Token string  `json:"token"`
+	}
+
+	q := url.Values{"name": {name}, "scopes": {strings.Join(scopes, ",")}}
+	if ttl > 0 {
+		q.Set("expires_in", ttl.String())
+	}
+
+	if err := c.do(ctx, http.MethodPost, "/keys", q, nil, &out); err != nil {
+		return nil, "", err
+	}
+
+	return out.Key, out.Token, nil
+}
+
+// ListAPIKeys returns every API key without their secrets
+func (c *Client) ListAPIKeys(ctx context.Context) ([]APIKey, error) {
+	keys := []APIKey{}
+	if err := c.do(ctx, http.MethodGet, "/keys", nil, nil, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey deletes the API key with the given id
+func (c *Client) RevokeAPIKey(ctx context.Context, id string) error {
+	return c.do(ctx, http.MethodDelete, "/keys", url.Values{"id": {id}}, nil, nil)
+}
+
+// SaveDomain creates a short domain or replaces its settings
+func (c *Client) SaveDomain(ctx context.Context, domain Domain) (*Domain, error) {
+	q := url.Values{"name": {domain.Name}}
+	if domain.RedirectCode != 0 {
+		q.Set("redirect_code", strconv.Itoa(domain.RedirectCode))
+	}
+	if domain.NotFoundURL != "" {
+		q.Set("not_found_url", domain.NotFoundURL)
+	}
+	if len(domain.AllowedCreators) > 0 {
+		q.Set("allowed_creators", strings.Join(domain.AllowedCreators, ","))
+	}
+
+	out := &Domain{}
+	if err := c.do(ctx, http.MethodPost, "/domains", q, nil, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// ListDomains returns every short domain
+func (c *Client) ListDomains(ctx context.Context) ([]Domain, error) {
+	domains := []Domain{}
+	if err := c.do(ctx, http.MethodGet, "/domains", nil, nil, &domains); err != nil {
+		return nil, err
+	}
+	return domains, nil
+}
+
+// DeleteDomain removes a short domain, its links are kept
+func (c *Client) DeleteDomain(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/domains", url.Values{"name": {name}}, nil, nil)
+}
+
+// ConfigChange is a setting changed by Reload, secrets are redacted
+type ConfigChange struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+// Reload makes the server re-read its configuration like SIGHUP does and
+// returns the settings that changed
+func (c *Client) Reload(ctx context.Context) ([]ConfigChange, error) {
+	var out struct {
+		Changes []ConfigChange `json:"changes"`
+	}
+
+	if err := c.do(ctx, http.MethodPost, "/admin/reload", nil, nil, &out); err != nil {
+		return nil, err
+	}
+	return out.Changes, nil
+}
+
+// CheckResult is the outcome of one dependency check of the readiness probe
+type CheckResult struct {
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	LatencyMS float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Readiness is the report of the readiness probe
+type Readiness struct {
+	Status   string                 `json:"status"`
+	Draining bool                   `json:"draining,omitempty"`
+	Checks   map[string]CheckResult `json:"checks"`
+}
+
+// Livez returns nil when the server process is up. Probes are sent once,
+// they report the state of the server right now.
+func (c *Client) Livez(ctx context.Context) error {
+	_, err := c.attempt(ctx, "", http.MethodGet, "/livez", nil, nil, nil)
+	return err
+}
+
+// Readyz returns the readiness report of the server. When the server is not
+// ready, failing or draining, the report comes with an error matching
+// ErrUnavailable.
+func (c *Client) Readyz(ctx context.Context) (*Readiness, error) {
+	report := &Readiness{}
+
+	_, err := c.attempt(ctx, "", http.MethodGet, "/readyz", nil, nil, report)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusServiceUnavailable {
+		if json.Unmarshal([]byte(apiErr.Message), report) == nil {
+			return report, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// Health returns nil when the server reports itself healthy
+func (c *Client) Health(ctx context.Context) error {
+	var out struct {
+		Status string `json:"status"`
+	}
+
+	if err := c.do(ctx, http.MethodGet, "/health", nil, nil, &out); err != nil {
+		return err
+	}
+
+	if out.Status != "ok" {
+		return fmt.Errorf("server unhealthy: %s", out.Status)
+	}
+	return nil
+}
+
+// do sends the request, retrying transient failures, and decodes a JSON
+// response into out when out is not nil. Only idempotent methods are retried
+// after errors the server may have acted on, see APIError.retryable.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, body []byte, out any) error {
+	return c.doHost(ctx, "", method, path, query, body, out)
+}
+
+// doHost is do with the Host header set to host, unless empty
+func (c *Client) doHost(ctx context.Context, host, method, path string, query url.Values, body []byte, out any) error {
+	wait := c.params.Backoff()
+
+	var lastErr error
+	for attempt := 0; attempt <= c.params.Retries(); attempt++ {
+		if attempt > 0 {
+			delay := jitter(wait)
+			var apiErr *APIError
+			if errors.As(lastErr, &apiErr) && apiErr.RetryAfter > delay {
+				delay = apiErr.RetryAfter
+			}
+			if err := sleep(ctx, delay); err != nil {
+				return errors.Join(lastErr, err)
+			}
+			wait = min(wait*2, c.params.MaxBackoff())
+		}
+
+		retry, err := c.attempt(ctx, host, method, path, query, body, out)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+
+		if !retry || ctx.Err() != nil {
+			break
+		}
+	}
+
+	return lastErr
+}
+
+// attempt performs a single round trip and reports whether a failure is
+// worth retrying
+func (c *Client) attempt(ctx context.Context, host, method, path string, query url.Values, body []byte, out any) (bool, error) {
+	u := c.baseURL.JoinPath(path)
+	if probes[path] {
+		u = c.baseURL.ResolveReference(&url.URL{Path: path})
+	}
+	u.RawQuery = query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return false, err
+	}
+
+	if host != "" {
+		req.Host = host
+	}
+	if c.params.Token() != "" {
+		req.Header.Set("X-Auth-Token", c.params.Token())
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if _, ok := out.(io.Writer); !ok {
+		req.Header.Set("Accept", "application/json")
+	}
+
+	resp, err := c.params.HTTPClient().Do(req)
+	if err != nil {
+		return idempotent(method), err
+	}
+	defer resp.Body.Close()
+
+	// Streamed responses are copied as they arrive; once bytes reach the
+	// writer the request cannot be retried
+	if w, ok := out.(io.Writer); ok && resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		_, err := io.Copy(w, resp.Body)
+		return false, err
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return idempotent(method), err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		apiErr := &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    strings.TrimSpace(string(data)),
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		}
+		return apiErr.retryable(method), apiErr
+	}
+
+	if out == nil || len(data) == 0 {
+		return false, nil
+	}
+
+	if err := json.Unmarshal(data, out); err != nil {
+		return false, fmt.Errorf("decode response: %w", err)
+	}
+
+	return false, nil
+}
+
+// probes are served at the root of the server whatever the path of the
+// base URL
+var probes = map[string]bool{"/livez": true, "/readyz": true}
+
+// linkQuery names the link with code on domain, the primary one when empty
+func linkQuery(domain, code string) url.Values {
+	q := url.Values{"short_url": {code}}
+	if domain != "" {
+		q.Set("domain", domain)
+	}
+	return q
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// jitter spreads retries from many clients by waiting between d/2 and d
+func jitter(d time.Duration) time.Duration {
+	half := d / 2
+	if half <= 0 {
+		return d
+	}
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
@@ -0,0 +1,615 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/api"
+	"github.com/thiagozs/go-shorturl/config"
+	"github.com/thiagozs/go-shorturl/handler"
+	"github.com/thiagozs/go-shorturl/infra/database"
+	"github.com/thiagozs/go-shorturl/middleware"
+	"github.com/thiagozs/go-shorturl/pkg/auth"
+	"github.com/thiagozs/go-shorturl/pkg/client"
+	"github.com/thiagozs/go-shorturl/pkg/health"
+	"github.com/thiagozs/go-shorturl/pkg/ratelimit"
+	"github.com/thiagozs/go-shorturl/pkg/realip"
+	"github.com/thiagozs/go-shorturl/pkg/validator"
+)
+
+const adminToken = "test-admin-token"
+
+// newAPI builds the real API around a memory store, with extra middleware
+// options such as a rate limiter
+func newAPI(t *testing.T, opts ...middleware.Options) http.Handler {
+	t.Helper()
+	return newAPIWith(t, nil, opts...)
+}
+
+// newAPIWith is newAPI with extra handler options
+func newAPIWith(t *testing.T, handlerOpts []handler.Options, opts ...middleware.Options) http.Handler {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	db, err := database.NewDatabase(database.Memory, "", logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := validator.NewValidator()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hd, err := handler.NewHandler(append([]handler.Options{
+		handler.WithStore(db),
+		handler.WithValidator(v),
+		handler.WithLogger(logger),
+		handler.WithDomain("localhost"),
+		handler.WithLocal(true),
+	}, handlerOpts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolver, err := realip.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md, err := middleware.NewMiddleware(append([]middleware.Options{
+		middleware.WithLogger(logger),
+		middleware.WithToken(adminToken),
+		middleware.WithStore(db),
+		middleware.WithRealIP(resolver),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := api.NewApi(
+		api.WithLogger(logger),
+		api.WithDB(db),
+		api.WithHandlers(hd),
+		api.WithMiddleware(md),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.RegisterEndPoints(); err != nil {
+		t.Fatal(err)
+	}
+
+	return a.Handler()
+}
+
+func newClient(t *testing.T, baseURL, token string, opts ...client.Options) *client.Client {
+	t.Helper()
+
+	c, err := client.NewClient(append([]client.Options{
+		client.WithBaseURL(baseURL),
+		client.WithToken(token),
+		client.WithBackoff(time.Millisecond, 5*time.Millisecond),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// code returns the short code of a short link
+func code(t *testing.T, shortURL string) string {
+	t.Helper()
+	i := strings.LastIndex(shortURL, "/")
+	if i < 0 || i == len(shortURL)-1 {
+		t.Fatalf("unexpected short url %q", shortURL)
+	}
+	return shortURL[i+1:]
+}
+
+// follow requests a short link without following the redirect and returns
+// its Location
+func follow(t *testing.T, shortURL string) string {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, shortURL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/130.0")
+
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noFollow.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("redirect status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+	return resp.Header.Get("Location")
+}
+
+func TestLinkLifecycle(t *testing.T) {
+	srv := httptest.NewServer(newAPI(t))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := newClient(t, srv.URL, adminToken)
+
+	shortURL, err := c.Shorten(ctx, "https://example.com/first", client.ShortenOptions{Tags: []string{"docs"}})
+	if err != nil {
+		t.Fatalf("Shorten: %v", err)
+	}
+	if !strings.HasPrefix(shortURL, srv.URL+"/") {
+		t.Fatalf("short url %q is not on %s", shortURL, srv.URL)
+	}
+
+	if got := follow(t, shortURL); got != "https://example.com/first" {
+		t.Fatalf("Location = %q, want the original url", got)
+	}
+
+	if err := c.Update(ctx, "", code(t, shortURL), "https://example.com/second"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if got := follow(t, shortURL); got != "https://example.com/second" {
+		t.Fatalf("Location after update = %q, want the new url", got)
+	}
+
+	stats, err := c.Stats(ctx, "", code(t, shortURL))
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.Count != 2 {
+		t.Errorf("Count = %d, want 2", stats.Count)
+	}
+	if len(stats.Tags) != 1 || stats.Tags[0] != "docs" {
+		t.Errorf("Tags = %v, want [docs]", stats.Tags)
+	}
+}
+
+// get sends a GET for path to srv with the Host header set to host and
+// returns the response without following redirects
+func get(t *testing.T, srv *httptest.Server, host, path string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL+path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Host = host
+	req.Header.Set("User-Agent", "Mozilla/5.0 (X11; Linux x86_64) Firefox/130.0")
+
+	noFollow := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := noFollow.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func TestShortenOptions(t *testing.T) {
+	srv := httptest.NewServer(newAPI(t))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := newClient(t, srv.URL, adminToken)
+
+	if _, err := c.SaveDomain(ctx, client.Domain{Name: "go.example"}); err != nil {
+		t.Fatalf("SaveDomain: %v", err)
+	}
+
+	shortURL, err := c.Shorten(ctx, "https://example.com/landing?a=1", client.ShortenOptions{
+		Tags:         []string{"spring"},
+		Domain:       "go.example",
+		Title:        "Spring sale",
+		RedirectCode: http.StatusMovedPermanently,
+		QueryPolicy:  "append",
+		UTM:          map[string]string{"utm_source": "{source}", "utm_campaign": "{domain}"},
+	})
+	if err != nil {
+		t.Fatalf("Shorten: %v", err)
+	}
+	if !strings.Contains(shortURL, "://go.example/") {
+		t.Fatalf("short url %q is not on go.example", shortURL)
+	}
+	short := code(t, shortURL)
+
+	stats, err := c.Stats(ctx, "go.example", short)
+	if err != nil {
+		t.Fatalf("Stats: %v", err)
+	}
+	if stats.Title != "Spring sale" || stats.RedirectCode != http.StatusMovedPermanently ||
+		stats.QueryPolicy != "append" || stats.UTM["utm_source"] != "{source}" {
+		t.Fatalf("Stats = %+v, want the link settings", stats)
+	}
+	if _, err := c.Stats(ctx, "", short); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("Stats on the primary domain = %v, want ErrNotFound", err)
+	}
+
+	if err := c.Update(ctx, "go.example", short, "https://example.com/summer"); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := c.Update(ctx, "", short, "https://example.com/summer"); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("Update on the primary domain = %v, want ErrNotFound", err)
+	}
+
+	resp := get(t, srv, "go.example", "/"+short+"?b=2")
+	want := "https://example.com/summer?b=2&utm_campaign=go.example&utm_source=link"
+	if resp.StatusCode != http.StatusMovedPermanently || resp.Header.Get("Location") != want {
+		t.Fatalf("redirect = %d %q, want 301 %q", resp.StatusCode, resp.Header.Get("Location"), want)
+	}
+
+	var apiErr *client.APIError
+	_, err = c.Shorten(ctx, "https://example.com/", client.ShortenOptions{RedirectCode: http.StatusSeeOther})
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Shorten with a 303 = %v, want a 400", err)
+	}
+	if _, err := c.Shorten(ctx, "https://example.com/", client.ShortenOptions{UTM: map[string]string{"url": "x"}}); err == nil {
+		t.Fatal("Shorten with a non utm_ parameter succeeded")
+	}
+}
+
+func TestQR(t *testing.T) {
+	srv := httptest.NewServer(newAPIWith(t, []handler.Options{handler.WithScanSecret("scan-secret")}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := newClient(t, srv.URL, adminToken)
+
+	if _, err := c.SaveDomain(ctx, client.Domain{Name: "go.example"}); err != nil {
+		t.Fatalf("SaveDomain: %v", err)
+	}
+	primary, err := c.Shorten(ctx, "https://example.com/", client.ShortenOptions{})
+	if err != nil {
+		t.Fatalf("Shorten: %v", err)
+	}
+	other, err := c.Shorten(ctx, "https://example.com/", client.ShortenOptions{Domain: "go.example"})
+	if err != nil {
+		t.Fatalf("Shorten: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.QR(ctx, code(t, primary), client.QROptions{Size: 128}, &buf); err != nil {
+		t.Fatalf("QR: %v", err)
+	}
+	img, err := png.DecodeConfig(&buf)
+	if err != nil {
+		t.Fatalf("QR is not a PNG: %v", err)
+	}
+	if img.Width != 128 || img.Height != 128 {
+		t.Fatalf("QR is %dx%d, want 128x128", img.Width, img.Height)
+	}
+
+	margin := 0
+	buf.Reset()
+	opts := client.QROptions{Domain: "go.example", Format: "svg", Level: "H", Margin: &margin, Foreground: "123456", Track: true}
+	if err := c.QR(ctx, code(t, other), opts, &buf); err != nil {
+		t.Fatalf("QR on go.example: %v", err)
+	}
+	if !strings.Contains(buf.String(), `fill="#123456"`) {
+		t.Fatalf("QR = %q, want an SVG in the foreground color", buf.String())
+	}
+
+	if err := c.QR(ctx, code(t, other), client.QROptions{}, io.Discard); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("QR on the primary domain = %v, want ErrNotFound", err)
+	}
+	var apiErr *client.APIError
+	if err := c.QR(ctx, code(t, primary), client.QROptions{Size: 1}, io.Discard); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("QR with a bad size = %v, want a 400", err)
+	}
+}
+
+func TestReload(t *testing.T) {
+	ctx := context.Background()
+
+	srv := httptest.NewServer(newAPI(t))
+	defer srv.Close()
+
+	var apiErr *client.APIError
+	if _, err := newClient(t, srv.URL, adminToken).Reload(ctx); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotImplemented {
+		t.Fatalf("Reload without a reloader = %v, want a 501", err)
+	}
+
+	reloader := func(context.Context) ([]config.Change, error) {
+		return []config.Change{{Field: "log.level", Old: "info", New: "debug"}}, nil
+	}
+	srv = httptest.NewServer(newAPIWith(t, []handler.Options{handler.WithReloader(reloader)}))
+	defer srv.Close()
+
+	changes, err := newClient(t, srv.URL, adminToken).Reload(ctx)
+	if err != nil {
+		t.Fatalf("Reload: %v", err)
+	}
+	if len(changes) != 1 || changes[0] != (client.ConfigChange{Field: "log.level", Old: "info", New: "debug"}) {
+		t.Fatalf("Reload = %+v, want the log level change", changes)
+	}
+
+	if _, err := newClient(t, srv.URL, "wrong-token").Reload(ctx); !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("Reload with a wrong token = %v, want ErrUnauthorized", err)
+	}
+}
+
+func TestProbes(t *testing.T) {
+	checker := health.New(0)
+	srv := httptest.NewServer(newAPIWith(t, []handler.Options{handler.WithHealth(checker)}))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	// Probes are at the root even when the API is under a path
+	c := newClient(t, srv.URL+"/s", "")
+
+	if err := c.Livez(ctx); err != nil {
+		t.Fatalf("Livez: %v", err)
+	}
+	report, err := c.Readyz(ctx)
+	if err != nil {
+		t.Fatalf("Readyz: %v", err)
+	}
+	if report.Status != health.StatusOK {
+		t.Fatalf("Readyz = %+v, want ok", report)
+	}
+
+	checker.Drain()
+	report, err = c.Readyz(ctx)
+	if !errors.Is(err, client.ErrUnavailable) {
+		t.Fatalf("Readyz while draining = %v, want ErrUnavailable", err)
+	}
+	if report == nil || !report.Draining {
+		t.Fatalf("Readyz while draining = %+v, want the draining report", report)
+	}
+	if err := c.Livez(ctx); err != nil {
+		t.Fatalf("Livez while draining: %v", err)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	srv := httptest.NewServer(newAPI(t))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := newClient(t, srv.URL, adminToken)
+
+	if _, err := c.Shorten(ctx, "https://example.com/kept", client.ShortenOptions{}); err != nil {
+		t.Fatalf("Shorten: %v", err)
+	}
+
+	bad := map[string]string{"good": "https://example.com/", "bad": "ftp://example.com/"}
+	var apiErr *client.APIError
+	if err := c.Restore(ctx, bad); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("Restore with a rejected URL = %v, want a 400", err)
+	}
+	backup, err := c.Backup(ctx)
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if len(backup) != 1 {
+		t.Fatalf("links after a rejected restore = %v, want the original one", backup)
+	}
+
+	good := map[string]string{"abc": "https://example.com/a", "def": "https://example.com/d"}
+	if err := c.Restore(ctx, good); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if backup, err = c.Backup(ctx); err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if len(backup) != 2 || backup["abc"] != good["abc"] || backup["def"] != good["def"] {
+		t.Fatalf("links after restore = %v, want %v", backup, good)
+	}
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	srv := httptest.NewServer(newAPI(t))
+	defer srv.Close()
+
+	ctx := context.Background()
+	admin := newClient(t, srv.URL, adminToken)
+
+	key, secret, err := admin.CreateAPIKey(ctx, "writer", []string{auth.ScopeLinksWrite}, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	writer := newClient(t, srv.URL, secret)
+	if _, err := writer.Shorten(ctx, "https://example.com/", client.ShortenOptions{}); err != nil {
+		t.Fatalf("Shorten with the new key: %v", err)
+	}
+	if _, err := writer.Stats(ctx, "", "whatever"); !errors.Is(err, client.ErrForbidden) {
+		t.Fatalf("Stats without the scope = %v, want ErrForbidden", err)
+	}
+
+	if err := admin.RevokeAPIKey(ctx, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	keys, err := admin.ListAPIKeys(ctx)
+	if err != nil {
+		t.Fatalf("ListAPIKeys: %v", err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("ListAPIKeys = %v, want none", keys)
+	}
+
+	if _, err := writer.Shorten(ctx, "https://example.com/", client.ShortenOptions{}); !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("Shorten with a revoked key = %v, want ErrUnauthorized", err)
+	}
+	if err := admin.RevokeAPIKey(ctx, key.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("RevokeAPIKey twice = %v, want ErrNotFound", err)
+	}
+}
+
+func TestBackupImportFlush(t *testing.T) {
+	srv := httptest.NewServer(newAPI(t))
+	defer srv.Close()
+
+	ctx := context.Background()
+	c := newClient(t, srv.URL, adminToken)
+
+	urls := map[string]string{"abc": "https://example.com/a", "def": "https://example.com/d"}
+	if err := c.Import(ctx, urls); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	backup, err := c.Backup(ctx)
+	if err != nil {
+		t.Fatalf("Backup: %v", err)
+	}
+	if len(backup) != 2 || backup["abc"] != urls["abc"] || backup["def"] != urls["def"] {
+		t.Fatalf("Backup = %v, want %v", backup, urls)
+	}
+
+	flushed, err := c.Flush(ctx)
+	if err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	if len(flushed) != 2 {
+		t.Fatalf("Flush = %v, want the imported links", flushed)
+	}
+	if backup, err = c.Backup(ctx); err != nil || len(backup) != 0 {
+		t.Fatalf("Backup after flush = %v, %v, want no links", backup, err)
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	limiter := middleware.WithRateLimiter(ratelimit.NewMemoryLimiter(),
+		map[string]ratelimit.Policy{middleware.GroupAPI: {Rate: 0.01, Burst: 2}})
+	srv := httptest.NewServer(newAPI(t, limiter))
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	_, err := newClient(t, srv.URL, adminToken).Stats(ctx, "", "missing")
+	if !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("Stats of an unknown code = %v, want ErrNotFound", err)
+	}
+
+	_, err = newClient(t, srv.URL, "wrong-token").Stats(ctx, "", "missing")
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("Stats with a wrong token = %v, want ErrUnauthorized", err)
+	}
+
+	// Unauthenticated requests share the bucket of their IP whatever token
+	// they send, the admin one above has its own
+	_, err = newClient(t, srv.URL, "another-wrong-token").Stats(ctx, "", "missing")
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("Stats with another wrong token = %v, want ErrUnauthorized", err)
+	}
+
+	_, err = newClient(t, srv.URL, "yet-another-token", client.WithRetries(0)).Stats(ctx, "", "missing")
+	var apiErr *client.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("Stats over the limit = %v, want a 429", err)
+	}
+	if apiErr.RetryAfter <= 0 {
+		t.Errorf("RetryAfter = %s, want the Retry-After of the response", apiErr.RetryAfter)
+	}
+}
+
+// flaky answers the first failures requests with status, then passes them
+// to next
+func flaky(next http.Handler, failures int32, status int, header http.Header) (http.Handler, *atomic.Int32) {
+	var calls atomic.Int32
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) <= failures {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}), &calls
+}
+
+func TestRetries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("GET is retried after 5xx", func(t *testing.T) {
+		h, calls := flaky(newAPI(t), 2, http.StatusServiceUnavailable, nil)
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+
+		if err := newClient(t, srv.URL, adminToken).Health(ctx); err != nil {
+			t.Fatalf("Health: %v", err)
+		}
+		if got := calls.Load(); got != 3 {
+			t.Fatalf("calls = %d, want 3", got)
+		}
+	})
+
+	t.Run("GET gives up after the retries", func(t *testing.T) {
+		h, calls := flaky(newAPI(t), 10, http.StatusBadGateway, nil)
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+
+		err := newClient(t, srv.URL, adminToken, client.WithRetries(2)).Health(ctx)
+		var apiErr *client.APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway {
+			t.Fatalf("Health = %v, want a 502", err)
+		}
+		if got := calls.Load(); got != 3 {
+			t.Fatalf("calls = %d, want 3", got)
+		}
+	})
+
+	t.Run("POST is not retried after 5xx", func(t *testing.T) {
+		h, calls := flaky(newAPI(t), 1, http.StatusServiceUnavailable, nil)
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+
+		if _, err := newClient(t, srv.URL, adminToken).Shorten(ctx, "https://example.com/", client.ShortenOptions{}); err == nil {
+			t.Fatal("Shorten succeeded, want the 503")
+		}
+		if got := calls.Load(); got != 1 {
+			t.Fatalf("calls = %d, want 1", got)
+		}
+	})
+
+	t.Run("POST is retried after 429 with Retry-After", func(t *testing.T) {
+		h, calls := flaky(newAPI(t), 1, http.StatusTooManyRequests, http.Header{"Retry-After": {"1"}})
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+
+		start := time.Now()
+		if _, err := newClient(t, srv.URL, adminToken).Shorten(ctx, "https://example.com/", client.ShortenOptions{}); err != nil {
+			t.Fatalf("Shorten: %v", err)
+		}
+		if got := calls.Load(); got != 2 {
+			t.Fatalf("calls = %d, want 2", got)
+		}
+		if waited := time.Since(start); waited < time.Second {
+			t.Errorf("waited %s, want at least the Retry-After of 1s", waited)
+		}
+	})
+
+	t.Run("client errors are not retried", func(t *testing.T) {
+		h, calls := flaky(newAPI(t), 0, 0, nil)
+		srv := httptest.NewServer(h)
+		defer srv.Close()
+
+		if _, err := newClient(t, srv.URL, adminToken).Stats(ctx, "", "missing"); !errors.Is(err, client.ErrNotFound) {
+			t.Fatalf("Stats = %v, want ErrNotFound", err)
+		}
+		if got := calls.Load(); got != 1 {
+			t.Fatalf("calls = %d, want 1", got)
+		}
+	})
+}
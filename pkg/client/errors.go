@@ -0,0 +1,96 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var (
+	// ErrUnauthorized is returned when the auth token is missing, unknown or
+	// expired.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is returned when the auth token lacks the scope the
+	// endpoint requires.
+	ErrForbidden = errors.New("forbidden")
+	// ErrNotFound is returned when the requested short URL does not exist.
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when the request collides with an existing link.
+	ErrConflict = errors.New("conflict")
+	// ErrUnavailable is returned when the server is not ready or shutting
+	// down.
+	ErrUnavailable = errors.New("unavailable")
+)
+
+// APIError describes a non-2xx response from the server. It matches
+// ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict and
+// ErrUnavailable through errors.Is.
+type APIError struct {
+	StatusCode int
+	Message    string
+	// RetryAfter is how long the server asked to wait, zero when it did not
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("shorturl: %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("shorturl: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnavailable:
+		return e.StatusCode == http.StatusServiceUnavailable
+	}
+	return false
+}
+
+// retryable reports whether a request with method that got this response is
+// worth retrying. A 429 with Retry-After was refused before doing anything,
+// so even writes may be sent again; other failures only for idempotent
+// methods, a write may have been applied before the server failed.
+func (e *APIError) retryable(method string) bool {
+	if e.StatusCode == http.StatusTooManyRequests && e.RetryAfter > 0 {
+		return true
+	}
+	if !idempotent(method) {
+		return false
+	}
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
+
+// idempotent reports whether sending a request with method twice has the
+// same effect as sending it once
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// parseRetryAfter reads a Retry-After header in seconds or as an HTTP date
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return max(time.Duration(secs)*time.Second, 0)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0)
+	}
+	return 0
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+type Options func(*ClientParams) error
+
+type ClientParams struct {
+	baseURL    string
+	token      string
+	httpClient *http.Client
+	retries    int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+func newClientParams(opts ...Options) (*ClientParams, error) {
+	params := &ClientParams{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		retries:    3,
+		backoff:    200 * time.Millisecond,
+		maxBackoff: 5 * time.Second,
+	}
+	for _, opt := range opts {
+		if err := opt(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+func WithBaseURL(baseURL string) Options {
+	return func(p *ClientParams) error {
+		p.baseURL = baseURL
+		return nil
+	}
+}
+
+func WithToken(token string) Options {
+	return func(p *ClientParams) error {
+		p.token = token
+		return nil
+	}
+}
+
+func WithHTTPClient(httpClient *http.Client) Options {
+	return func(p *ClientParams) error {
+		if httpClient == nil {
+			return fmt.Errorf("http client cannot be nil")
+		}
+		p.httpClient = httpClient
+		return nil
+	}
+}
+
+// WithRetries sets how many times a failed request is retried after the
+// first attempt. Writes (POST) are only retried after a 429 with
+// Retry-After. Zero disables retries.
+func WithRetries(retries int) Options {
+	return func(p *ClientParams) error {
+		if retries < 0 {
+			return fmt.Errorf("retries cannot be negative")
+		}
+		p.retries = retries
+		return nil
+	}
+}
+
+// WithBackoff sets the initial and maximum wait between retries. The wait
+// doubles after every attempt until it reaches max.
+func WithBackoff(initial, max time.Duration) Options {
+	return func(p *ClientParams) error {
+		if initial <= 0 || max < initial {
+			return fmt.Errorf("invalid backoff: initial=%s max=%s", initial, max)
+		}
+		p.backoff = initial
+		p.maxBackoff = max
+		return nil
+	}
+}
+
+// getters -----
+
+func (p *ClientParams) BaseURL() string {
+	return p.baseURL
+}
+
+func (p *ClientParams) Token() string {
+	return p.token
+}
+
+func (p *ClientParams) HTTPClient() *http.Client {
+	return p.httpClient
+}
+
+func (p *ClientParams) Retries() int {
+	return p.retries
+}
+
+func (p *ClientParams) Backoff() time.Duration {
+	return p.backoff
+}
+
+func (p *ClientParams) MaxBackoff() time.Duration {
+	return p.maxBackoff
+}
+
+// setters -----
+
+func (p *ClientParams) SetBaseURL(baseURL string) {
+	p.baseURL = baseURL
+}
+
+func (p *ClientParams) SetToken(token string) {
+	p.token = token
+}
+
+func (p *ClientParams) SetHTTPClient(httpClient *http.Client) {
+	p.httpClient = httpClient
+}
+
+func (p *ClientParams) SetRetries(retries int) {
+	p.retries = retries
+}
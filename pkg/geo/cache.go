@@ -0,0 +1,109 @@
+package geo
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+)
+
+// Cached fronts a resolver with a fixed size LRU cache. Failed lookups are
+// cached as unknown locations too, for a tenth of the TTL, so an unhealthy
+// provider is not queried on every request.
+type Cached struct {
+	next GeoResolver
+	size int
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+type cacheEntry struct {
+	ip      string
+	loc     model.Location
+	expires time.Time
+}
+
+func NewCached(next GeoResolver, size int, ttl time.Duration) *Cached {
+	if size <= 0 {
+		size = 1
+	}
+
+	return &Cached{
+		next:    next,
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *Cached) Lookup(ctx context.Context, ip string) (model.Location, error) {
+	if loc, ok := c.get(ip); ok {
+		return loc, nil
+	}
+
+	loc, err := c.next.Lookup(ctx, ip)
+	ttl := c.ttl
+	if err != nil {
+		ttl /= 10
+	}
+	c.put(ip, loc, ttl)
+
+	return loc, err
+}
+
+// Ping checks the wrapped resolver, bypassing the cache
+func (c *Cached) Ping(ctx context.Context) error {
+	return Ping(ctx, c.next)
+}
+
+// Close closes the wrapped resolver
+func (c *Cached) Close() error {
+	return Close(c.next)
+}
+
+func (c *Cached) get(ip string) (model.Location, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[ip]
+	if !ok {
+		return model.Location{}, false
+	}
+
+	entry := el.Value.(*cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.order.Remove(el)
+		delete(c.entries, ip)
+		return model.Location{}, false
+	}
+
+	c.order.MoveToFront(el)
+	return entry.loc, true
+}
+
+func (c *Cached) put(ip string, loc model.Location, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{ip: ip, loc: loc, expires: time.Now().Add(ttl)}
+
+	if el, ok := c.entries[ip]; ok {
+		el.Value = entry
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.entries[ip] = c.order.PushFront(entry)
+
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).ip)
+	}
+}
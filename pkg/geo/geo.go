@@ -0,0 +1,60 @@
+package geo
+
+import (
+	"context"
+	"io"
+	"net/netip"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+)
+
+// GeoResolver finds where an IP address is located
+type GeoResolver interface {
+	Lookup(ctx context.Context, ip string) (model.Location, error)
+}
+
+// Pinger is implemented by resolvers that can tell whether their provider
+// is usable
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// Ping checks the provider behind r, resolvers without a check are assumed
+// healthy
+func Ping(ctx context.Context, r GeoResolver) error {
+	if p, ok := r.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// Close releases what the provider behind r holds open, such as a MaxMind
+// database file
+func Close(r GeoResolver) error {
+	if c, ok := r.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// probeIP is a well known public address used to check providers
+const probeIP = "1.1.1.1"
+
+// Noop resolves every address to an unknown location
+type Noop struct{}
+
+func (Noop) Lookup(context.Context, string) (model.Location, error) {
+	return model.Location{}, nil
+}
+
+// public reports whether ip is a routable address worth looking up
+func public(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	return !(addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsMulticast() || addr.IsUnspecified())
+}
@@ -0,0 +1,82 @@
+package geo
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+)
+
+// HTTPResolver looks addresses up with the ip-api.com JSON API or a service
+// answering in the same format
+type HTTPResolver struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPResolver returns a resolver querying baseURL followed by the IP
+// address, e.g. http://ip-api.com/json/. Each lookup is bounded by timeout.
+func NewHTTPResolver(baseURL string, timeout time.Duration) *HTTPResolver {
+	if baseURL == "" {
+		baseURL = "http://ip-api.com/json/"
+	}
+
+	return &HTTPResolver{
+		baseURL: strings.TrimSuffix(baseURL, "/") + "/",
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+func (h *HTTPResolver) Lookup(ctx context.Context, ip string) (model.Location, error) {
+	if !public(ip) {
+		return model.Location{}, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, h.baseURL+ip, nil)
+	if err != nil {
+		return model.Location{}, err
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return model.Location{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return model.Location{}, fmt.Errorf("geo lookup: unexpected status %s", resp.Status)
+	}
+
+	var result struct {
+		Status      string `json:"status"`
+		Message     string `json:"message"`
+		Country     string `json:"country"`
+		CountryCode string `json:"countryCode"`
+		RegionName  string `json:"regionName"`
+		City        string `json:"city"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return model.Location{}, fmt.Errorf("geo lookup: %w", err)
+	}
+
+	if result.Status != "success" {
+		return model.Location{}, fmt.Errorf("geo lookup: %s", result.Message)
+	}
+
+	return model.Location{
+		Country:     result.Country,
+		CountryCode: result.CountryCode,
+		Region:      result.RegionName,
+		City:        result.City,
+	}, nil
+}
+
+// Ping looks up a public address to check the service answers
+func (h *HTTPResolver) Ping(ctx context.Context) error {
+	_, err := h.Lookup(ctx, probeIP)
+	return err
+}
@@ -0,0 +1,89 @@
+package geo
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+)
+
+// MaxMindResolver looks addresses up in a local GeoIP2 or GeoLite2 City (or
+// Country) database, without any network call
+type MaxMindResolver struct {
+	db       *maxminddb.Reader
+	language string
+}
+
+// NewMaxMindResolver opens the .mmdb file at path. Names are returned in
+// language, falling back to English.
+func NewMaxMindResolver(path, language string) (*MaxMindResolver, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open maxmind database: %w", err)
+	}
+
+	if language == "" {
+		language = "en"
+	}
+
+	return &MaxMindResolver{db: db, language: language}, nil
+}
+
+type mmdbNames map[string]string
+
+type mmdbRecord struct {
+	Country struct {
+		ISOCode string    `maxminddb:"iso_code"`
+		Names   mmdbNames `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		Names mmdbNames `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		Names mmdbNames `maxminddb:"names"`
+	} `maxminddb:"city"`
+}
+
+func (m *MaxMindResolver) Lookup(_ context.Context, ip string) (model.Location, error) {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return model.Location{}, fmt.Errorf("invalid ip %q", ip)
+	}
+
+	var rec mmdbRecord
+	if err := m.db.Lookup(parsed, &rec); err != nil {
+		return model.Location{}, err
+	}
+
+	loc := model.Location{
+		Country:     m.name(rec.Country.Names),
+		CountryCode: rec.Country.ISOCode,
+		City:        m.name(rec.City.Names),
+	}
+	if len(rec.Subdivisions) > 0 {
+		loc.Region = m.name(rec.Subdivisions[0].Names)
+	}
+
+	return loc, nil
+}
+
+// Ping looks up a public address to check the database is readable
+func (m *MaxMindResolver) Ping(ctx context.Context) error {
+	_, err := m.Lookup(ctx, probeIP)
+	return err
+}
+
+func (m *MaxMindResolver) name(names mmdbNames) string {
+	if name, ok := names[m.language]; ok {
+		return name
+	}
+	return names["en"]
+}
+
+// Close releases the database file
+func (m *MaxMindResolver) Close() error {
+	return m.db.Close()
+}
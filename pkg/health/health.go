@@ -0,0 +1,200 @@
+package health
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Status of a single check or of the whole report
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded"
+	StatusFailing  = "failing"
+)
+
+// DefaultTimeout bounds how long a check may run before it counts as failed
+const DefaultTimeout = 2 * time.Second
+
+// Check is a dependency the service needs. A failing critical check makes
+// the service not ready, any other failure only degrades it. Checks with an
+// Interval reuse their last result until it is that old, so slow or rate
+// limited dependencies are not hit by every probe.
+type Check struct {
+	Name     string
+	Critical bool
+	Interval time.Duration
+	Fn       func(ctx context.Context) error
+}
+
+// Result is the outcome of a check
+type Result struct {
+	Status    string    `json:"status"`
+	Critical  bool      `json:"critical"`
+	LatencyMS float64   `json:"latency_ms"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Report is the outcome of every check
+type Report struct {
+	Status   string            `json:"status"`
+	Draining bool              `json:"draining,omitempty"`
+	Checks   map[string]Result `json:"checks"`
+}
+
+// Ready reports whether the service should receive traffic
+func (r Report) Ready() bool {
+	return r.Status != StatusFailing && !r.Draining
+}
+
+// Checker runs the dependency checks of the readiness probe
+type Checker struct {
+	timeout  time.Duration
+	draining atomic.Bool
+
+	mu     sync.Mutex
+	checks []Check
+	cache  map[string]Result
+}
+
+// New creates a checker whose checks time out after timeout, DefaultTimeout
+// when zero
+func New(timeout time.Duration) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{timeout: timeout, cache: make(map[string]Result)}
+}
+
+// Add registers a check, replacing the one with the same name
+func (c *Checker) Add(check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.cache, check.Name)
+	for i := range c.checks {
+		if c.checks[i].Name == check.Name {
+			c.checks[i] = check
+			return
+		}
+	}
+	c.checks = append(c.checks, check)
+}
+
+// Remove unregisters the check with the given name
+func (c *Checker) Remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.cache, name)
+	for i := range c.checks {
+		if c.checks[i].Name == name {
+			c.checks = append(c.checks[:i], c.checks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Drain marks the service as shutting down, every readiness probe fails
+// from now on so load balancers stop sending new requests
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Draining reports whether Drain was called
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Ready runs every check concurrently and reports the result of each
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.Lock()
+	checks := append([]Check(nil), c.checks...)
+	c.mu.Unlock()
+
+	report := Report{
+		Status:   StatusOK,
+		Draining: c.Draining(),
+		Checks:   make(map[string]Result, len(checks)),
+	}
+
+	results := make([]Result, len(checks))
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = c.run(ctx, check)
+		}()
+	}
+	wg.Wait()
+
+	for i, check := range checks {
+		res := results[i]
+		report.Checks[check.Name] = res
+
+		if res.Status == StatusOK {
+			continue
+		}
+		if check.Critical {
+			report.Status = StatusFailing
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+
+	return report
+}
+
+// run returns the cached result of check while it is fresh, otherwise it
+// runs the check under the timeout
+func (c *Checker) run(ctx context.Context, check Check) Result {
+	if check.Interval > 0 {
+		c.mu.Lock()
+		res, ok := c.cache[check.Name]
+		c.mu.Unlock()
+		if ok && time.Since(res.CheckedAt) < check.Interval {
+			return res
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	begin := time.Now()
+	err := call(ctx, check.Fn)
+
+	res := Result{
+		Status:    StatusOK,
+		Critical:  check.Critical,
+		LatencyMS: float64(time.Since(begin).Microseconds()) / 1000,
+		CheckedAt: begin.UTC(),
+	}
+	if err != nil {
+		res.Status = StatusFailing
+		res.Error = err.Error()
+	}
+
+	if check.Interval > 0 {
+		c.mu.Lock()
+		c.cache[check.Name] = res
+		c.mu.Unlock()
+	}
+
+	return res
+}
+
+// call runs fn but gives up when ctx is done, for checks that ignore it
+func call(ctx context.Context, fn func(context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,236 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// jwk is a single JSON Web Key as found in a JWKS document
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// Symmetric
+	K string `json:"k"`
+}
+
+// Key is a verification key parsed from a JWKS. Public is an *rsa.PublicKey,
+// an *ecdsa.PublicKey or a []byte HMAC secret.
+type Key struct {
+	ID     string
+	Alg    string
+	Public crypto.PublicKey
+}
+
+// ParseJWKS parses a JWKS document. Keys meant for encryption and keys of
+// unsupported types are skipped.
+func ParseJWKS(data []byte) ([]Key, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid jwks: %w", err)
+	}
+
+	keys := make([]Key, 0, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		pub, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("jwk %q: %w", k.Kid, err)
+		}
+		if pub == nil {
+			continue
+		}
+
+		keys = append(keys, Key{ID: k.Kid, Alg: k.Alg, Public: pub})
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() < 3 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, nil
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve P-256")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, err
+		}
+		return secret, nil
+	default:
+		return nil, nil
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// KeySource provides the keys tokens are verified with
+type KeySource interface {
+	// Keys returns the current keys. When refresh is set the source should
+	// bypass its cache, e.g. because a token names an unknown key id.
+	Keys(ctx context.Context, refresh bool) ([]Key, error)
+}
+
+// StaticKeys is a KeySource that never changes
+type StaticKeys []Key
+
+func (s StaticKeys) Keys(context.Context, bool) ([]Key, error) {
+	return s, nil
+}
+
+// MultiSource merges the keys of several sources
+type MultiSource []KeySource
+
+func (m MultiSource) Keys(ctx context.Context, refresh bool) ([]Key, error) {
+	var all []Key
+	for _, source := range m {
+		keys, err := source.Keys(ctx, refresh)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, keys...)
+	}
+	return all, nil
+}
+
+// CachedJWKS loads a JWKS from a file or URL and keeps it for a TTL.
+// Forced refreshes, used when keys rotate, are throttled to one per
+// minRefresh so unknown key ids cannot be used to flood the origin.
+type CachedJWKS struct {
+	load       func(ctx context.Context) ([]byte, error)
+	ttl        time.Duration
+	minRefresh time.Duration
+
+	mu      sync.Mutex
+	keys    []Key
+	fetched time.Time
+	tried   time.Time
+}
+
+// NewFileJWKS returns a source reading the JWKS at path
+func NewFileJWKS(path string, ttl time.Duration) *CachedJWKS {
+	return &CachedJWKS{
+		load: func(context.Context) ([]byte, error) {
+			return os.ReadFile(path)
+		},
+		ttl:        ttl,
+		minRefresh: time.Second,
+	}
+}
+
+// NewURLJWKS returns a source fetching the JWKS from url with client
+func NewURLJWKS(url string, client *http.Client, ttl time.Duration) *CachedJWKS {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &CachedJWKS{
+		load: func(ctx context.Context) ([]byte, error) {
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Accept", "application/json")
+
+			resp, err := client.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				return nil, fmt.Errorf("fetch jwks: unexpected status %s", resp.Status)
+			}
+
+			return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+		},
+		ttl:        ttl,
+		minRefresh: time.Minute,
+	}
+}
+
+func (c *CachedJWKS) Keys(ctx context.Context, refresh bool) ([]Key, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	age := time.Since(c.fetched)
+	due := c.keys == nil || age > c.ttl || (refresh && age > c.minRefresh)
+	if !due || (c.keys != nil && time.Since(c.tried) < c.minRefresh) {
+		return c.keys, nil
+	}
+	c.tried = time.Now()
+
+	data, err := c.load(ctx)
+	if err == nil {
+		var keys []Key
+		if keys, err = ParseJWKS(data); err == nil {
+			c.keys, c.fetched = keys, time.Now()
+			return c.keys, nil
+		}
+	}
+
+	// Keep serving the last good keys while the origin is unavailable
+	if c.keys != nil {
+		return c.keys, nil
+	}
+
+	return nil, err
+}
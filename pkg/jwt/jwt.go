@@ -0,0 +1,242 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Supported signing algorithms
+const (
+	RS256 = "RS256"
+	ES256 = "ES256"
+	HS256 = "HS256"
+)
+
+var (
+	ErrMalformed        = errors.New("malformed token")
+	ErrUnsupportedAlg   = errors.New("unsupported algorithm")
+	ErrUnknownKey       = errors.New("no key found for token")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrExpired          = errors.New("token expired")
+	ErrNotYetValid      = errors.New("token not valid yet")
+	ErrInvalidIssuer    = errors.New("invalid issuer")
+	ErrInvalidAudience  = errors.New("invalid audience")
+)
+
+// Claims holds the decoded payload of a token
+type Claims map[string]any
+
+// String returns the claim name as a string, or "" when missing or not a
+// string
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim holding either a space separated string (as the
+// OAuth "scope" claim does) or an array of strings
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Time returns a NumericDate claim and whether it was present
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	}
+	return time.Time{}, false
+}
+
+// Verifier checks the signature and registered claims of tokens
+type Verifier struct {
+	params *VerifierParams
+}
+
+func NewVerifier(opts ...Options) (*Verifier, error) {
+	params, err := newVerifierParams(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Source() == nil {
+		return nil, fmt.Errorf("key source is required")
+	}
+
+	return &Verifier{params: params}, nil
+}
+
+// Verify parses token, checks its signature against the key source and
+// validates exp, nbf, iss and aud
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformed
+	}
+
+	if !slices.Contains(v.params.Algorithms(), header.Alg) {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlg, header.Alg)
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	if err := v.verifySignature(ctx, header.Alg, header.Kid, signed, sig); err != nil {
+		return nil, err
+	}
+
+	claims := Claims{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformed
+	}
+
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// verifySignature tries every candidate key, refreshing the key source once
+// when none matches so rotated keys are picked up
+func (v *Verifier) verifySignature(ctx context.Context, alg, kid string, signed, sig []byte) error {
+	for _, refresh := range []bool{false, true} {
+		keys, err := v.params.Source().Keys(ctx, refresh)
+		if err != nil {
+			return fmt.Errorf("load keys: %w", err)
+		}
+
+		found := false
+		for _, key := range keys {
+			if (kid != "" && key.ID != kid) || (key.Alg != "" && key.Alg != alg) {
+				continue
+			}
+			if !keyMatchesAlg(key.Public, alg) {
+				continue
+			}
+
+			found = true
+			if verifyWith(alg, key.Public, signed, sig) {
+				return nil
+			}
+		}
+
+		if found {
+			return ErrInvalidSignature
+		}
+	}
+
+	return ErrUnknownKey
+}
+
+func keyMatchesAlg(key crypto.PublicKey, alg string) bool {
+	switch alg {
+	case RS256:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case ES256:
+		_, ok := key.(*ecdsa.PublicKey)
+		return ok
+	case HS256:
+		_, ok := key.([]byte)
+		return ok
+	}
+	return false
+}
+
+func verifyWith(alg string, key crypto.PublicKey, signed, sig []byte) bool {
+	switch alg {
+	case RS256:
+		digest := sha256.Sum256(signed)
+		return rsa.VerifyPKCS1v15(key.(*rsa.PublicKey), crypto.SHA256, digest[:], sig) == nil
+	case ES256:
+		if len(sig) != 64 {
+			return false
+		}
+		digest := sha256.Sum256(signed)
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		return ecdsa.Verify(key.(*ecdsa.PublicKey), digest[:], r, s)
+	case HS256:
+		mac := hmac.New(sha256.New, key.([]byte))
+		mac.Write(signed)
+		return hmac.Equal(mac.Sum(nil), sig)
+	}
+	return false
+}
+
+func (v *Verifier) validate(claims Claims) error {
+	now := v.params.Now()()
+	leeway := v.params.Leeway()
+
+	exp, ok := claims.Time("exp")
+	if !ok {
+		return fmt.Errorf("%w: missing exp", ErrMalformed)
+	}
+	if now.After(exp.Add(leeway)) {
+		return ErrExpired
+	}
+
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return ErrNotYetValid
+	}
+
+	if iss := v.params.Issuer(); iss != "" && claims.String("iss") != iss {
+		return ErrInvalidIssuer
+	}
+
+	if aud := v.params.Audience(); aud != "" {
+		// aud may be a single string or an array
+		if claims.String("aud") != aud && !slices.Contains(claims.Strings("aud"), aud) {
+			return ErrInvalidAudience
+		}
+	}
+
+	return nil
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,411 @@
+package jwt
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var b64 = base64.RawURLEncoding
+
+// sign builds a compact JWT with header alg and kid, signed with key: an
+// *rsa.PrivateKey, an *ecdsa.PrivateKey or a []byte HMAC secret. Unsigned
+// tokens are made with alg "none" and a nil key.
+func sign(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+
+	header := map[string]string{"alg": alg, "typ": "JWT"}
+	if kid != "" {
+		header["kid"] = kid
+	}
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	signed := b64.EncodeToString(h) + "." + b64.EncodeToString(c)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	switch k := key.(type) {
+	case nil:
+	case *rsa.PrivateKey:
+		var err error
+		if sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+			t.Fatal(err)
+		}
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	default:
+		t.Fatalf("unsupported key %T", key)
+	}
+
+	return signed + "." + b64.EncodeToString(sig)
+}
+
+// jwkJSON encodes the public part of key as a JWK
+func jwkJSON(kid string, key any) map[string]string {
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return map[string]string{"kty": "RSA", "kid": kid, "use": "sig",
+			"n": b64.EncodeToString(k.N.Bytes()),
+			"e": b64.EncodeToString(big.NewInt(int64(k.E)).Bytes())}
+	case *ecdsa.PrivateKey:
+		x, y := make([]byte, 32), make([]byte, 32)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256",
+			"x": b64.EncodeToString(x), "y": b64.EncodeToString(y)}
+	case []byte:
+		return map[string]string{"kty": "oct", "kid": kid, "k": b64.EncodeToString(k)}
+	}
+	return nil
+}
+
+func jwks(t *testing.T, keys map[string]any) []byte {
+	t.Helper()
+	doc := struct {
+		Keys []map[string]string `json:"keys"`
+	}{}
+	for kid, key := range keys {
+		doc.Keys = append(doc.Keys, jwkJSON(kid, key))
+	}
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func staticKeys(t *testing.T, keys map[string]any) StaticKeys {
+	t.Helper()
+	parsed, err := ParseJWKS(jwks(t, keys))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed
+}
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func ecKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func hmacKey(t *testing.T) []byte {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+var now = time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+// validClaims are accepted by newVerifier
+func validClaims() map[string]any {
+	return map[string]any{
+		"sub": "user-1",
+		"iss": "https://issuer.test",
+		"aud": "shorturl",
+		"exp": now.Add(time.Hour).Unix(),
+		"iat": now.Unix(),
+	}
+}
+
+func newVerifier(t *testing.T, source KeySource, opts ...Options) *Verifier {
+	t.Helper()
+	v, err := NewVerifier(append([]Options{
+		WithKeySource(source),
+		WithIssuer("https://issuer.test"),
+		WithAudience("shorturl"),
+		WithLeeway(0),
+		WithClock(func() time.Time { return now }),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestVerifyAlgorithms(t *testing.T) {
+	rsaPriv, ecPriv, secret := rsaKey(t), ecKey(t), hmacKey(t)
+	v := newVerifier(t, staticKeys(t, map[string]any{"rsa": rsaPriv, "ec": ecPriv, "hmac": secret}))
+
+	tests := []struct {
+		alg string
+		kid string
+		key any
+	}{
+		{RS256, "rsa", rsaPriv},
+		{ES256, "ec", ecPriv},
+		{HS256, "hmac", secret},
+		// Without a kid every key of the algorithm is tried
+		{RS256, "", rsaPriv},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg+"/"+tt.kid, func(t *testing.T) {
+			claims, err := v.Verify(context.Background(), sign(t, tt.alg, tt.kid, tt.key, validClaims()))
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if got := claims.String("sub"); got != "user-1" {
+				t.Fatalf("sub = %q, want user-1", got)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsBadSignatures(t *testing.T) {
+	rsaPriv := rsaKey(t)
+	v := newVerifier(t, staticKeys(t, map[string]any{"rsa": rsaPriv}))
+
+	t.Run("other key", func(t *testing.T) {
+		token := sign(t, RS256, "rsa", rsaKey(t), validClaims())
+		if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("Verify = %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("tampered claims", func(t *testing.T) {
+		token := sign(t, RS256, "rsa", rsaPriv, validClaims())
+		other := sign(t, RS256, "rsa", rsaPriv, map[string]any{"sub": "admin", "exp": now.Add(time.Hour).Unix()})
+		parts := strings.Split(token, ".")
+		parts[1] = strings.Split(other, ".")[1]
+		if _, err := v.Verify(context.Background(), strings.Join(parts, ".")); !errors.Is(err, ErrInvalidSignature) {
+			t.Fatalf("Verify = %v, want ErrInvalidSignature", err)
+		}
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		for _, token := range []string{"", "a.b", "a.b.c.d", "!!.e30.", b64.EncodeToString([]byte(`{"alg":"RS256"}`)) + ".e30.!!"} {
+			if _, err := v.Verify(context.Background(), token); err == nil {
+				t.Fatalf("Verify(%q) succeeded", token)
+			}
+		}
+	})
+}
+
+func TestVerifyPinsAlgorithms(t *testing.T) {
+	rsaPriv := rsaKey(t)
+	source := staticKeys(t, map[string]any{"rsa": rsaPriv})
+
+	t.Run("none", func(t *testing.T) {
+		v := newVerifier(t, source)
+		token := sign(t, "none", "rsa", nil, validClaims())
+		if _, err := v.Verify(context.Background(), token); !errors.Is(err, ErrUnsupportedAlg) {
+			t.Fatalf("Verify = %v, want ErrUnsupportedAlg", err)
+		}
+	})
+
+	// The classic confusion attack: HMAC with the RSA public key, which
+	// anyone can fetch, as the secret
+	der, err := x509.MarshalPKIXPublicKey(&rsaPriv.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pemKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+
+	for name, secret := range map[string][]byte{"pem": pemKey, "der": der, "modulus": rsaPriv.N.Bytes()} {
+		t.Run("HS256 with RSA public key/"+name, func(t *testing.T) {
+			token := sign(t, HS256, "rsa", secret, validClaims())
+
+			// HS256 is allowed, but the only key is an RSA one
+			if _, err := newVerifier(t, source).Verify(context.Background(), token); !errors.Is(err, ErrUnknownKey) {
+				t.Fatalf("Verify = %v, want ErrUnknownKey", err)
+			}
+
+			pinned := newVerifier(t, source, WithAlgorithms(RS256))
+			if _, err := pinned.Verify(context.Background(), token); !errors.Is(err, ErrUnsupportedAlg) {
+				t.Fatalf("Verify pinned to RS256 = %v, want ErrUnsupportedAlg", err)
+			}
+		})
+	}
+
+	t.Run("key alg", func(t *testing.T) {
+		// A key published for ES256 is not used for another algorithm
+		ecPriv := ecKey(t)
+		keys := staticKeys(t, map[string]any{"ec": ecPriv})
+		keys[0].Alg = ES256
+		token := sign(t, RS256, "ec", rsaPriv, validClaims())
+		if _, err := newVerifier(t, keys).Verify(context.Background(), token); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("Verify = %v, want ErrUnknownKey", err)
+		}
+	})
+}
+
+func TestVerifyClaims(t *testing.T) {
+	secret := hmacKey(t)
+	v := newVerifier(t, staticKeys(t, map[string]any{"hmac": secret}))
+
+	with := func(name string, value any) map[string]any {
+		claims := validClaims()
+		if value == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = value
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]any
+		want   error
+	}{
+		{"expired", with("exp", now.Add(-time.Second).Unix()), ErrExpired},
+		{"missing exp", with("exp", nil), ErrMalformed},
+		{"not yet valid", with("nbf", now.Add(time.Minute).Unix()), ErrNotYetValid},
+		{"wrong iss", with("iss", "https://evil.test"), ErrInvalidIssuer},
+		{"missing iss", with("iss", nil), ErrInvalidIssuer},
+		{"wrong aud", with("aud", "other"), ErrInvalidAudience},
+		{"wrong aud list", with("aud", []string{"a", "b"}), ErrInvalidAudience},
+		{"aud list", with("aud", []string{"other", "shorturl"}), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), sign(t, HS256, "hmac", secret, tt.claims))
+			if tt.want == nil && err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("leeway", func(t *testing.T) {
+		lenient := newVerifier(t, staticKeys(t, map[string]any{"hmac": secret}), WithLeeway(time.Minute))
+		token := sign(t, HS256, "hmac", secret, with("exp", now.Add(-30*time.Second).Unix()))
+		if _, err := lenient.Verify(context.Background(), token); err != nil {
+			t.Fatalf("Verify within leeway: %v", err)
+		}
+	})
+}
+
+// jwksServer serves the JWKS of the keys it currently holds and counts the
+// fetches
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	keys    map[string]any
+	fetches atomic.Int32
+}
+
+func newJWKSServer(t *testing.T, keys map[string]any) *jwksServer {
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(jwks(t, s.keys))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) rotate(keys map[string]any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func TestUnknownKidRefreshesJWKS(t *testing.T) {
+	oldKey, newKey := rsaKey(t), rsaKey(t)
+	srv := newJWKSServer(t, map[string]any{"old": oldKey})
+
+	source := NewURLJWKS(srv.URL, srv.Client(), time.Hour)
+	source.minRefresh = 0
+	v := newVerifier(t, source)
+	ctx := context.Background()
+
+	if _, err := v.Verify(ctx, sign(t, RS256, "old", oldKey, validClaims())); err != nil {
+		t.Fatalf("Verify with the old key: %v", err)
+	}
+	if got := srv.fetches.Load(); got != 1 {
+		t.Fatalf("fetches = %d, want 1", got)
+	}
+
+	// Cached keys serve known kids without fetching again
+	if _, err := v.Verify(ctx, sign(t, RS256, "old", oldKey, validClaims())); err != nil {
+		t.Fatalf("Verify with the old key again: %v", err)
+	}
+	if got := srv.fetches.Load(); got != 1 {
+		t.Fatalf("fetches = %d, want 1", got)
+	}
+
+	srv.rotate(map[string]any{"old": oldKey, "new": newKey})
+
+	if _, err := v.Verify(ctx, sign(t, RS256, "new", newKey, validClaims())); err != nil {
+		t.Fatalf("Verify with the rotated key: %v", err)
+	}
+	if got := srv.fetches.Load(); got != 2 {
+		t.Fatalf("fetches = %d, want 2 after the unknown kid", got)
+	}
+
+	// A kid the origin does not have either is reported, after one refresh
+	if _, err := v.Verify(ctx, sign(t, RS256, "missing", newKey, validClaims())); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("Verify with an unknown kid = %v, want ErrUnknownKey", err)
+	}
+	if got := srv.fetches.Load(); got != 3 {
+		t.Fatalf("fetches = %d, want 3", got)
+	}
+}
+
+func TestUnknownKidRefreshIsThrottled(t *testing.T) {
+	key := rsaKey(t)
+	srv := newJWKSServer(t, map[string]any{"known": key})
+
+	v := newVerifier(t, NewURLJWKS(srv.URL, srv.Client(), time.Hour))
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		if _, err := v.Verify(ctx, sign(t, RS256, "unknown", key, validClaims())); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("Verify = %v, want ErrUnknownKey", err)
+		}
+	}
+	if got := srv.fetches.Load(); got != 1 {
+		t.Fatalf("fetches = %d, want 1, unknown kids must not flood the origin", got)
+	}
+}
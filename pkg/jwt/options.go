@@ -0,0 +1,109 @@
+package jwt
+
+import (
+	"fmt"
+	"time"
+)
+
+type Options func(*VerifierParams) error
+
+type VerifierParams struct {
+	source     KeySource
+	issuer     string
+	audience   string
+	algorithms []string
+	leeway     time.Duration
+	now        func() time.Time
+}
+
+func newVerifierParams(opts ...Options) (*VerifierParams, error) {
+	params := &VerifierParams{
+		algorithms: []string{RS256, ES256, HS256},
+		leeway:     time.Minute,
+		now:        time.Now,
+	}
+	for _, opt := range opts {
+		if err := opt(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+func WithKeySource(source KeySource) Options {
+	return func(p *VerifierParams) error {
+		p.source = source
+		return nil
+	}
+}
+
+// WithIssuer requires the iss claim to equal issuer
+func WithIssuer(issuer string) Options {
+	return func(p *VerifierParams) error {
+		p.issuer = issuer
+		return nil
+	}
+}
+
+// WithAudience requires the aud claim to contain audience
+func WithAudience(audience string) Options {
+	return func(p *VerifierParams) error {
+		p.audience = audience
+		return nil
+	}
+}
+
+// WithAlgorithms restricts the accepted signing algorithms
+func WithAlgorithms(algs ...string) Options {
+	return func(p *VerifierParams) error {
+		for _, alg := range algs {
+			if alg != RS256 && alg != ES256 && alg != HS256 {
+				return fmt.Errorf("%w: %q", ErrUnsupportedAlg, alg)
+			}
+		}
+		p.algorithms = algs
+		return nil
+	}
+}
+
+// WithLeeway sets the clock skew tolerated when checking exp and nbf
+func WithLeeway(leeway time.Duration) Options {
+	return func(p *VerifierParams) error {
+		p.leeway = leeway
+		return nil
+	}
+}
+
+// WithClock replaces time.Now, mostly useful to verify fixed tokens
+func WithClock(now func() time.Time) Options {
+	return func(p *VerifierParams) error {
+		p.now = now
+		return nil
+	}
+}
+
+// getters -----
+
+func (p *VerifierParams) Source() KeySource {
+	return p.source
+}
+
+func (p *VerifierParams) Issuer() string {
+	return p.issuer
+}
+
+func (p *VerifierParams) Audience() string {
+	return p.audience
+}
+
+func (p *VerifierParams) Algorithms() []string {
+	return p.algorithms
+}
+
+func (p *VerifierParams) Leeway() time.Duration {
+	return p.leeway
+}
+
+func (p *VerifierParams) Now() func() time.Time {
+	return p.now
+}
@@ -0,0 +1,148 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// DefaultDrainTimeout is how long stopping may take unless configured
+const DefaultDrainTimeout = 30 * time.Second
+
+// Component is a part of the service with a lifetime, such as a listener,
+// a background worker or a store. Start and Stop are optional. A component
+// that keeps running after Start, like a server, reports a failure on Err,
+// which shuts the whole service down.
+type Component struct {
+	Name  string
+	Start func(ctx context.Context) error
+	Stop  func(ctx context.Context) error
+	Err   <-chan error
+}
+
+// Manager starts components in the order they were added and stops them in
+// reverse, so stores outlive the servers using them
+type Manager struct {
+	params     *LifecycleParams
+	components []Component
+}
+
+func New(opts ...Options) (*Manager, error) {
+	params, err := newLifecycleParams(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Manager{params: params}, nil
+}
+
+// Add appends components to the start order
+func (m *Manager) Add(components ...Component) {
+	m.components = append(m.components, components...)
+}
+
+// Run starts every component and blocks until ctx is done or a component
+// fails, then stops the started ones. A component failing to start stops
+// the ones before it and its error is returned.
+func (m *Manager) Run(ctx context.Context) error {
+	logger := m.params.Logger()
+
+	started := 0
+	for _, c := range m.components {
+		if c.Start != nil {
+			logger.Info("Starting component", slog.String("component", c.Name))
+			if err := c.Start(ctx); err != nil {
+				startErr := fmt.Errorf("start %s: %w", c.Name, err)
+				return errors.Join(startErr, m.stop(started))
+			}
+		}
+		started++
+	}
+
+	logger.Info("All components started")
+
+	var runErr error
+	select {
+	case <-ctx.Done():
+		logger.Info("Shutdown requested")
+	case err := <-m.failed():
+		runErr = err
+		logger.Error("Component failed, shutting down", slog.String("error", err.Error()))
+	}
+
+	return errors.Join(runErr, m.stop(started))
+}
+
+// stop stops the first n components in reverse order under the drain
+// timeout. A component that does not return in time is left behind, the
+// remaining ones still get the rest of the deadline.
+func (m *Manager) stop(n int) error {
+	logger := m.params.Logger()
+	timeout := m.params.DrainTimeout()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger.Info("Stopping components", slog.Int("count", n), slog.Duration("timeout", timeout))
+	begin := time.Now()
+
+	var errs []error
+	for i := n - 1; i >= 0; i-- {
+		c := m.components[i]
+		if c.Stop == nil {
+			continue
+		}
+
+		logger.Info("Stopping component", slog.String("component", c.Name))
+		start := time.Now()
+
+		if err := call(ctx, c.Stop); err != nil {
+			logger.Error("Failed to stop component", slog.String("component", c.Name),
+				slog.Duration("duration", time.Since(start)), slog.String("error", err.Error()))
+			errs = append(errs, fmt.Errorf("stop %s: %w", c.Name, err))
+			continue
+		}
+
+		logger.Info("Stopped component", slog.String("component", c.Name),
+			slog.Duration("duration", time.Since(start)))
+	}
+
+	logger.Info("Shutdown complete", slog.Duration("duration", time.Since(begin)),
+		slog.Int("errors", len(errs)))
+
+	return errors.Join(errs...)
+}
+
+// failed merges the Err channels of the components into one. A closed
+// channel counts as a failure, the component stopped on its own.
+func (m *Manager) failed() <-chan error {
+	out := make(chan error, len(m.components))
+	for _, c := range m.components {
+		if c.Err == nil {
+			continue
+		}
+
+		go func() {
+			err, ok := <-c.Err
+			if !ok || err == nil {
+				err = errors.New("stopped unexpectedly")
+			}
+			out <- fmt.Errorf("%s: %w", c.Name, err)
+		}()
+	}
+	return out
+}
+
+// call runs fn but stops waiting for it when ctx is done
+func call(ctx context.Context, fn func(context.Context) error) error {
+	done := make(chan error, 1)
+	go func() { done <- fn(ctx) }()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
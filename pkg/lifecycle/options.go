@@ -0,0 +1,69 @@
+package lifecycle
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+type Options func(*LifecycleParams) error
+
+type LifecycleParams struct {
+	logger       *slog.Logger
+	drainTimeout time.Duration
+}
+
+func newLifecycleParams(opts ...Options) (*LifecycleParams, error) {
+	params := &LifecycleParams{
+		logger:       slog.Default(),
+		drainTimeout: DefaultDrainTimeout,
+	}
+	for _, opt := range opts {
+		if err := opt(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+func WithLogger(logger *slog.Logger) Options {
+	return func(p *LifecycleParams) error {
+		if logger == nil {
+			return fmt.Errorf("logger cannot be nil")
+		}
+		p.logger = logger
+		return nil
+	}
+}
+
+// WithDrainTimeout bounds how long stopping every component may take,
+// components still running when it expires are abandoned
+func WithDrainTimeout(timeout time.Duration) Options {
+	return func(p *LifecycleParams) error {
+		if timeout <= 0 {
+			return fmt.Errorf("drain timeout must be positive, got %s", timeout)
+		}
+		p.drainTimeout = timeout
+		return nil
+	}
+}
+
+// getters -----
+
+func (p *LifecycleParams) Logger() *slog.Logger {
+	return p.logger
+}
+
+func (p *LifecycleParams) DrainTimeout() time.Duration {
+	return p.drainTimeout
+}
+
+// setters -----
+
+func (p *LifecycleParams) SetLogger(logger *slog.Logger) {
+	p.logger = logger
+}
+
+func (p *LifecycleParams) SetDrainTimeout(timeout time.Duration) {
+	p.drainTimeout = timeout
+}
@@ -0,0 +1,197 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+	"github.com/thiagozs/go-shorturl/pkg/geo"
+)
+
+const namespace = "shorturl"
+
+// Redirect outcomes
+const (
+	RedirectHit     = "hit"
+	RedirectMiss    = "miss"
+	RedirectBlocked = "blocked"
+	RedirectPreview = "preview"
+)
+
+// Metrics holds the collectors of the service in their own registry. Every
+// method is safe to call on a nil *Metrics, so instrumentation can stay in
+// place when metrics are disabled.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	requests       *prometheus.CounterVec
+	requestLatency *prometheus.HistogramVec
+	redirects      *prometheus.CounterVec
+	storageLatency *prometheus.HistogramVec
+	storageErrors  *prometheus.CounterVec
+	geoLatency     *prometheus.HistogramVec
+}
+
+// New registers the collectors, including the Go runtime and process ones
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route, method and status code.",
+		}, []string{"route", "method", "code"}),
+		requestLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "redirects_total",
+			Help:      "Short URL lookups by outcome (hit, miss or blocked).",
+		}, []string{"result"}),
+		storageLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "storage_operation_duration_seconds",
+			Help:      "Storage operation latency by engine and operation.",
+			Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5, 1},
+		}, []string{"engine", "operation"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "storage_errors_total",
+			Help:      "Failed storage operations by engine and operation.",
+		}, []string{"engine", "operation"}),
+		geoLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "geo_lookup_duration_seconds",
+			Help:      "Geolocation lookup latency by provider and result, cache hits excluded.",
+			Buckets:   []float64{.001, .005, .01, .05, .1, .25, .5, 1, 2.5},
+		}, []string{"provider", "result"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests, m.requestLatency, m.redirects,
+		m.storageLatency, m.storageErrors, m.geoLatency,
+	)
+
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// ObserveRequest records a served HTTP request
+func (m *Metrics) ObserveRequest(route, method string, code int, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.requests.WithLabelValues(route, method, strconv.Itoa(code)).Inc()
+	m.requestLatency.WithLabelValues(route, method).Observe(d.Seconds())
+}
+
+// Redirect counts a short URL lookup with one of the Redirect outcomes
+func (m *Metrics) Redirect(result string) {
+	if m == nil {
+		return
+	}
+	m.redirects.WithLabelValues(result).Inc()
+}
+
+// ObserveStorage records a storage operation, it implements
+// database.Observer
+func (m *Metrics) ObserveStorage(engine, op string, d time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.storageLatency.WithLabelValues(engine, op).Observe(d.Seconds())
+	if err != nil {
+		m.storageErrors.WithLabelValues(engine, op).Inc()
+	}
+}
+
+// RegisterStoreSize exposes the number of links, click events and API keys,
+// counted by size on every scrape
+func (m *Metrics) RegisterStoreSize(size func() (model.StoreSize, error)) {
+	if m == nil {
+		return
+	}
+	m.registry.MustRegister(&storeCollector{size: size})
+}
+
+// InstrumentGeo wraps a resolver so its lookups are timed under provider
+func (m *Metrics) InstrumentGeo(provider string, next geo.GeoResolver) geo.GeoResolver {
+	if m == nil {
+		return next
+	}
+	return &geoObserver{next: next, provider: provider, latency: m.geoLatency}
+}
+
+type geoObserver struct {
+	next     geo.GeoResolver
+	provider string
+	latency  *prometheus.HistogramVec
+}
+
+func (g *geoObserver) Lookup(ctx context.Context, ip string) (model.Location, error) {
+	start := time.Now()
+	loc, err := g.next.Lookup(ctx, ip)
+
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	g.latency.WithLabelValues(g.provider, result).Observe(time.Since(start).Seconds())
+
+	return loc, err
+}
+
+func (g *geoObserver) Ping(ctx context.Context) error {
+	return geo.Ping(ctx, g.next)
+}
+
+func (g *geoObserver) Close() error {
+	return geo.Close(g.next)
+}
+
+// storeCollector reads the store size once per scrape
+type storeCollector struct {
+	size func() (model.StoreSize, error)
+}
+
+var (
+	linksDesc   = prometheus.NewDesc(namespace+"_store_links", "Stored short links.", nil, nil)
+	clicksDesc  = prometheus.NewDesc(namespace+"_store_click_events", "Stored click events.", nil, nil)
+	apiKeysDesc = prometheus.NewDesc(namespace+"_store_api_keys", "Stored API keys.", nil, nil)
+)
+
+func (c *storeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- linksDesc
+	ch <- clicksDesc
+	ch <- apiKeysDesc
+}
+
+func (c *storeCollector) Collect(ch chan<- prometheus.Metric) {
+	size, err := c.size()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(linksDesc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(linksDesc, prometheus.GaugeValue, float64(size.Links))
+	ch <- prometheus.MustNewConstMetric(clicksDesc, prometheus.GaugeValue, float64(size.Clicks))
+	ch <- prometheus.MustNewConstMetric(apiKeysDesc, prometheus.GaugeValue, float64(size.APIKeys))
+}
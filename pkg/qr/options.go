@@ -0,0 +1,152 @@
+package qr
+
+import (
+	"fmt"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Bounds of the rendering settings
+const (
+	MinSize   = 64
+	MaxSize   = 2048
+	MaxMargin = 16
+)
+
+type Options func(*CodeParams) error
+
+type CodeParams struct {
+	size       int
+	level      qrcode.RecoveryLevel
+	margin     int
+	foreground color.RGBA
+	background color.RGBA
+}
+
+func newCodeParams(opts ...Options) (*CodeParams, error) {
+	params := &CodeParams{
+		size:       256,
+		level:      qrcode.Medium,
+		margin:     4,
+		foreground: color.RGBA{A: 0xff},
+		background: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	}
+	for _, opt := range opts {
+		if err := opt(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// WithSize sets the width and height of the code in pixels
+func WithSize(size int) Options {
+	return func(p *CodeParams) error {
+		if size < MinSize || size > MaxSize {
+			return fmt.Errorf("size must be between %d and %d", MinSize, MaxSize)
+		}
+		p.size = size
+		return nil
+	}
+}
+
+// WithLevel sets the error correction level: L, M, Q or H, recovering from
+// about 7%, 15%, 25% and 30% of the code being damaged
+func WithLevel(level string) Options {
+	return func(p *CodeParams) error {
+		switch strings.ToUpper(level) {
+		case "L":
+			p.level = qrcode.Low
+		case "M":
+			p.level = qrcode.Medium
+		case "Q":
+			p.level = qrcode.High
+		case "H":
+			p.level = qrcode.Highest
+		default:
+			return fmt.Errorf("unknown error correction level %q, use L, M, Q or H", level)
+		}
+		return nil
+	}
+}
+
+// WithMargin sets the quiet zone around the code in modules. Scanners
+// expect 4, less only works on plain backgrounds.
+func WithMargin(margin int) Options {
+	return func(p *CodeParams) error {
+		if margin < 0 || margin > MaxMargin {
+			return fmt.Errorf("margin must be between 0 and %d", MaxMargin)
+		}
+		p.margin = margin
+		return nil
+	}
+}
+
+// WithForeground sets the color of the dark modules, see ParseColor
+func WithForeground(hex string) Options {
+	return func(p *CodeParams) error {
+		c, err := ParseColor(hex)
+		if err != nil {
+			return err
+		}
+		p.foreground = c
+		return nil
+	}
+}
+
+// WithBackground sets the color of the light modules and the margin, see
+// ParseColor
+func WithBackground(hex string) Options {
+	return func(p *CodeParams) error {
+		c, err := ParseColor(hex)
+		if err != nil {
+			return err
+		}
+		p.background = c
+		return nil
+	}
+}
+
+// ParseColor reads a hex color of 3, 6 or 8 digits, with or without a
+// leading #. The 8 digit form ends with the alpha channel.
+func ParseColor(hex string) (color.RGBA, error) {
+	s := strings.TrimPrefix(hex, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) == 6 {
+		s += "ff"
+	}
+
+	v, err := strconv.ParseUint(s, 16, 32)
+	if len(s) != 8 || err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q, use hex such as 000 or 1a2b3c", hex)
+	}
+
+	return color.RGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
+
+// getters -----
+
+func (p *CodeParams) Size() int {
+	return p.size
+}
+
+func (p *CodeParams) Level() qrcode.RecoveryLevel {
+	return p.level
+}
+
+func (p *CodeParams) Margin() int {
+	return p.margin
+}
+
+func (p *CodeParams) Foreground() color.RGBA {
+	return p.foreground
+}
+
+func (p *CodeParams) Background() color.RGBA {
+	return p.background
+}
@@ -0,0 +1,156 @@
+package qr
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strings"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Formats a code can be rendered in
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+)
+
+// ContentType returns the media type of format
+func ContentType(format string) string {
+	if format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Code is a QR code ready to be rendered
+type Code struct {
+	params *CodeParams
+	// modules are the dark (true) and light modules, without quiet zone
+	modules [][]bool
+}
+
+// New encodes content, usually a URL
+func New(content string, opts ...Options) (*Code, error) {
+	params, err := newCodeParams(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	q, err := qrcode.New(content, params.Level())
+	if err != nil {
+		return nil, err
+	}
+	q.DisableBorder = true
+
+	c := &Code{params: params, modules: q.Bitmap()}
+	if c.scale() < 1 {
+		return nil, fmt.Errorf("size must be at least %d pixels for this code", c.width())
+	}
+
+	return c, nil
+}
+
+// Key identifies the image of content rendered in format with opts. The
+// settings are normalized, so requests drawing the same image share a key.
+func Key(content, format string, opts ...Options) (string, error) {
+	params, err := newCodeParams(opts...)
+	if err != nil {
+		return "", err
+	}
+
+	fg, bg := params.Foreground(), params.Background()
+	return fmt.Sprintf("%s|%s|%d|%d|%d|%02x%02x%02x%02x|%02x%02x%02x%02x", content, format,
+		params.Size(), params.Level(), params.Margin(),
+		fg.R, fg.G, fg.B, fg.A, bg.R, bg.G, bg.B, bg.A), nil
+}
+
+// Render writes the code in format, png or svg
+func (c *Code) Render(w io.Writer, format string) error {
+	switch format {
+	case FormatPNG:
+		return c.PNG(w)
+	case FormatSVG:
+		return c.SVG(w)
+	default:
+		return fmt.Errorf("unknown format %q, use png or svg", format)
+	}
+}
+
+// PNG writes the code as a size by size PNG image. Modules are whole
+// pixels so the code stays sharp, any pixels left over widen the margin.
+func (c *Code) PNG(w io.Writer) error {
+	size, scale := c.params.Size(), c.scale()
+	offset := (size - c.width()*scale) / 2
+	margin := c.params.Margin()
+
+	palette := color.Palette{c.params.Background(), c.params.Foreground()}
+	img := image.NewPaletted(image.Rect(0, 0, size, size), palette)
+
+	for y, row := range c.modules {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			x0 := offset + (x+margin)*scale
+			y0 := offset + (y+margin)*scale
+			for py := y0; py < y0+scale; py++ {
+				for px := x0; px < x0+scale; px++ {
+					img.SetColorIndex(px, py, 1)
+				}
+			}
+		}
+	}
+
+	return png.Encode(w, img)
+}
+
+// SVG writes the code as a scalable image of size by size, one path with a
+// run per horizontal stretch of dark modules
+func (c *Code) SVG(w io.Writer) error {
+	width, margin := c.width(), c.params.Margin()
+
+	var path strings.Builder
+	for y, row := range c.modules {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&path, "M%d %dh%dv1h-%dz", start+margin, y+margin, x-start, x-start)
+		}
+	}
+
+	_, err := fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">
+<rect width="%d" height="%d" %s/>
+<path d="%s" %s/>
+</svg>
+`, c.params.Size(), c.params.Size(), width, width, width, width,
+		fill(c.params.Background()), path.String(), fill(c.params.Foreground()))
+	return err
+}
+
+// width is the width of the code in modules, quiet zone included
+func (c *Code) width() int {
+	return len(c.modules) + 2*c.params.Margin()
+}
+
+// scale is the width of a module in pixels
+func (c *Code) scale() int {
+	return c.params.Size() / c.width()
+}
+
+// fill returns the SVG fill attributes of col
+func fill(col color.RGBA) string {
+	attrs := fmt.Sprintf(`fill="#%02x%02x%02x"`, col.R, col.G, col.B)
+	if col.A != 0xff {
+		attrs += fmt.Sprintf(` fill-opacity="%.3g"`, float64(col.A)/0xff)
+	}
+	return attrs
+}
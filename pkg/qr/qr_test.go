@@ -0,0 +1,176 @@
+package qr
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		opt     Options
+		wantErr bool
+	}{
+		{name: "min size", opt: WithSize(MinSize)},
+		{name: "max size", opt: WithSize(MaxSize)},
+		{name: "size too small", opt: WithSize(MinSize - 1), wantErr: true},
+		{name: "size too large", opt: WithSize(MaxSize + 1), wantErr: true},
+		{name: "level lower case", opt: WithLevel("q")},
+		{name: "unknown level", opt: WithLevel("X"), wantErr: true},
+		{name: "no margin", opt: WithMargin(0)},
+		{name: "negative margin", opt: WithMargin(-1), wantErr: true},
+		{name: "margin too large", opt: WithMargin(MaxMargin + 1), wantErr: true},
+		{name: "foreground", opt: WithForeground("#123")},
+		{name: "bad background", opt: WithBackground("white"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := newCodeParams(tt.opt)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newCodeParams error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{in: "000", want: color.RGBA{A: 0xff}},
+		{in: "#fff", want: color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}},
+		{in: "1a2B3c", want: color.RGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0xff}},
+		{in: "#1a2b3c80", want: color.RGBA{R: 0x1a, G: 0x2b, B: 0x3c, A: 0x80}},
+		{in: "", wantErr: true},
+		{in: "#12", wantErr: true},
+		{in: "12345", wantErr: true},
+		{in: "ggg", wantErr: true},
+		{in: "+1234567", wantErr: true},
+		{in: "1a2b3c4d5", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseColor(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseColor(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ParseColor(%q) = %v, want %v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKey(t *testing.T) {
+	const content = "https://sho.rt/abc"
+
+	key := func(format string, opts ...Options) string {
+		t.Helper()
+		k, err := Key(content, format, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return k
+	}
+
+	base := key(FormatPNG)
+
+	same := map[string][]Options{
+		"explicit defaults": {WithSize(256), WithLevel("M"), WithMargin(4), WithForeground("000"), WithBackground("fff")},
+		"spelling":          {WithLevel("m"), WithForeground("#000000ff"), WithBackground("#FFFFFF")},
+		"repeated options":  {WithSize(512), WithSize(256)},
+	}
+	for name, opts := range same {
+		if got := key(FormatPNG, opts...); got != base {
+			t.Fatalf("%s: Key = %q, want %q", name, got, base)
+		}
+	}
+
+	differ := map[string]string{
+		"format":     key(FormatSVG),
+		"size":       key(FormatPNG, WithSize(257)),
+		"level":      key(FormatPNG, WithLevel("H")),
+		"margin":     key(FormatPNG, WithMargin(2)),
+		"foreground": key(FormatPNG, WithForeground("001")),
+		"alpha":      key(FormatPNG, WithBackground("fffffffe")),
+	}
+	for name, got := range differ {
+		if got == base {
+			t.Fatalf("%s: Key = %q, want it to differ from the defaults", name, got)
+		}
+	}
+
+	if k, _ := Key(content+"x", FormatPNG); k == base {
+		t.Fatal("Key ignores the content")
+	}
+	if _, err := Key(content, FormatPNG, WithSize(1)); err == nil {
+		t.Fatal("Key error = nil for an invalid size")
+	}
+}
+
+func TestPNG(t *testing.T) {
+	fg := color.RGBA{R: 0x12, G: 0x34, B: 0x56, A: 0xff}
+	c, err := New("https://sho.rt/abc", WithSize(300), WithForeground("123456"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Render(&buf, FormatPNG); err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 300 || b.Dy() != 300 {
+		t.Fatalf("PNG is %dx%d, want 300x300", b.Dx(), b.Dy())
+	}
+
+	// The top left module of the finder pattern is dark, the corner is margin
+	offset := (300 - c.width()*c.scale()) / 2
+	corner := offset + 4*c.scale()
+	if got := color.RGBAModel.Convert(img.At(corner, corner)); got != fg {
+		t.Fatalf("finder pattern pixel = %v, want %v", got, fg)
+	}
+	if got := color.RGBAModel.Convert(img.At(0, 0)); got != (color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}) {
+		t.Fatalf("margin pixel = %v, want white", got)
+	}
+}
+
+func TestSVG(t *testing.T) {
+	c, err := New("https://sho.rt/abc", WithSize(128), WithMargin(0), WithBackground("ffffff80"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.Render(&buf, FormatSVG); err != nil {
+		t.Fatal(err)
+	}
+
+	svg := buf.String()
+	for _, want := range []string{`width="128"`, `fill="#ffffff" fill-opacity="0.502"`, `<path d="M0 0h7v1h-7z`} {
+		if !strings.Contains(svg, want) {
+			t.Fatalf("SVG does not contain %q:\n%s", want, svg)
+		}
+	}
+
+	if err := c.Render(&buf, "gif"); err == nil {
+		t.Fatal("Render(gif) error = nil")
+	}
+}
+
+func TestNewTooSmall(t *testing.T) {
+	if _, err := New(strings.Repeat("x", 1000), WithSize(MinSize), WithLevel("H")); err == nil {
+		t.Fatal("New error = nil, want the size rejected for a dense code")
+	}
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is a token bucket: Burst requests may be made at once and the
+// bucket refills at Rate requests per second
+type Policy struct {
+	Rate  float64
+	Burst int
+}
+
+// ParsePolicy parses "<count>/<period>" such as "60/1m" or "10/s". The burst
+// defaults to count when burst is zero.
+func ParsePolicy(s string, burst int) (Policy, error) {
+	countStr, periodStr, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("invalid rate limit %q, expected <count>/<period>", s)
+	}
+
+	count, err := strconv.Atoi(countStr)
+	if err != nil || count <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit count %q", countStr)
+	}
+
+	// Allow "s", "m" and "h" as shorthands for one unit
+	if periodStr != "" && strings.IndexAny(periodStr[:1], "0123456789") < 0 {
+		periodStr = "1" + periodStr
+	}
+
+	period, err := time.ParseDuration(periodStr)
+	if err != nil || period <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit period %q", periodStr)
+	}
+
+	if burst <= 0 {
+		burst = count
+	}
+
+	return Policy{Rate: float64(count) / period.Seconds(), Burst: burst}, nil
+}
+
+// Window is how long an empty bucket takes to refill completely
+func (p Policy) Window() time.Duration {
+	return time.Duration(float64(p.Burst) / p.Rate * float64(time.Second))
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed bool
+	// Remaining is the number of whole tokens left in the bucket
+	Remaining int
+	// RetryAfter is how long until the next token is available, zero when
+	// the request was allowed
+	RetryAfter time.Duration
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// Limiter takes tokens from per key buckets
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (Result, error)
+}
+
+// Pinger is implemented by limiters backed by an external service
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// result builds a Result from the tokens left after taking one (or failing
+// to)
+func result(allowed bool, tokens float64, policy Policy) Result {
+	res := Result{
+		Allowed:   allowed,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(policy.Burst) - tokens) / policy.Rate),
+	}
+
+	if !allowed {
+		res.RetryAfter = seconds((1 - tokens) / policy.Rate)
+	}
+
+	return res
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
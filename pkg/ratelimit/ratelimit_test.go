@@ -0,0 +1,209 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		burst   int
+		want    Policy
+		wantErr bool
+	}{
+		{in: "60/1m", want: Policy{Rate: 1, Burst: 60}},
+		{in: "10/s", want: Policy{Rate: 10, Burst: 10}},
+		{in: " 3600/h ", burst: 5, want: Policy{Rate: 1, Burst: 5}},
+		{in: "5/500ms", want: Policy{Rate: 10, Burst: 5}},
+		{in: "60", wantErr: true},
+		{in: "0/s", wantErr: true},
+		{in: "-1/s", wantErr: true},
+		{in: "x/s", wantErr: true},
+		{in: "10/", wantErr: true},
+		{in: "10/0s", wantErr: true},
+		{in: "10/fortnight", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePolicy(tt.in, tt.burst)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicy(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ParsePolicy(%q) = %+v, want %+v", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewMemoryLimiter()
+	l.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	policy := Policy{Rate: 1, Burst: 3}
+
+	steps := []struct {
+		name      string
+		advance   time.Duration
+		key       string
+		allowed   bool
+		remaining int
+		retry     time.Duration
+	}{
+		{name: "first", key: "a", allowed: true, remaining: 2},
+		{name: "second", key: "a", allowed: true, remaining: 1},
+		{name: "third", key: "a", allowed: true, remaining: 0},
+		{name: "burst spent", key: "a", allowed: false, remaining: 0, retry: time.Second},
+		{name: "other key", key: "b", allowed: true, remaining: 2},
+		{name: "half refilled", advance: 500 * time.Millisecond, key: "a", allowed: false, retry: 500 * time.Millisecond},
+		{name: "refilled", advance: 500 * time.Millisecond, key: "a", allowed: true, remaining: 0},
+		{name: "capped at burst", advance: time.Hour, key: "a", allowed: true, remaining: 2},
+	}
+
+	for _, s := range steps {
+		now = now.Add(s.advance)
+		res, err := l.Allow(ctx, s.key, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Allowed != s.allowed || res.Remaining != s.remaining || res.RetryAfter != s.retry {
+			t.Fatalf("%s: Allow = %+v, want allowed %v remaining %d retry %s",
+				s.name, res, s.allowed, s.remaining, s.retry)
+		}
+	}
+}
+
+func TestMemoryLimiterSweep(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	l := NewMemoryLimiter()
+	l.now = func() time.Time { return now }
+
+	policy := Policy{Rate: 1, Burst: 10}
+	for _, key := range []string{"a", "b", "c"} {
+		l.Allow(context.Background(), key, policy)
+	}
+
+	// b is seen again, a and c have been idle for longer than the window
+	now = now.Add(5 * time.Second)
+	l.Allow(context.Background(), "b", policy)
+	now = now.Add(2 * time.Minute)
+	l.Allow(context.Background(), "d", Policy{Rate: 1, Burst: 200})
+
+	if len(l.buckets) != 1 || l.buckets["d"] == nil {
+		keys := make([]string, 0, len(l.buckets))
+		for key := range l.buckets {
+			keys = append(keys, key)
+		}
+		t.Fatalf("buckets after sweep = %v, want [d]", keys)
+	}
+}
+
+func TestResult(t *testing.T) {
+	policy := Policy{Rate: 2, Burst: 4}
+
+	res := result(true, 1.5, policy)
+	if !res.Allowed || res.Remaining != 1 || res.RetryAfter != 0 || res.Reset != 1250*time.Millisecond {
+		t.Fatalf("result(allowed) = %+v", res)
+	}
+
+	res = result(false, 0.25, policy)
+	if res.Allowed || res.Remaining != 0 || res.RetryAfter != 375*time.Millisecond {
+		t.Fatalf("result(denied) = %+v", res)
+	}
+}
+
+// fakeRedis answers one connection with replies, recording the commands it
+// was sent
+func fakeRedis(t *testing.T, replies ...string) (string, <-chan []string) {
+	t.Helper()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	commands := make(chan []string, len(replies))
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for _, reply := range replies {
+			var n int
+			line, _ := r.ReadString('\n')
+			if _, err := fmt.Sscanf(line, "*%d", &n); err != nil {
+				return
+			}
+			args := make([]string, n)
+			for i := range args {
+				var size int
+				line, _ := r.ReadString('\n')
+				fmt.Sscanf(line, "$%d", &size)
+				arg := make([]byte, size+2)
+				io.ReadFull(r, arg)
+				args[i] = string(arg[:size])
+			}
+			commands <- args
+			conn.Write([]byte(reply))
+		}
+	}()
+
+	return ln.Addr().String(), commands
+}
+
+func TestRedisLimiter(t *testing.T) {
+	addr, commands := fakeRedis(t,
+		"+OK\r\n",
+		"*2\r\n:1\r\n$3\r\n4.5\r\n",
+		"*2\r\n:0\r\n$4\r\n0.25\r\n",
+		"-ERR boom\r\n",
+	)
+
+	l := NewRedisLimiter(addr, "secret", "rl:", 1)
+	defer l.Close()
+
+	ctx := context.Background()
+	policy := Policy{Rate: 0.5, Burst: 10}
+
+	res, err := l.Allow(ctx, "k", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Allowed || res.Remaining != 4 {
+		t.Fatalf("Allow = %+v, want allowed with 4 remaining", res)
+	}
+
+	if auth := <-commands; auth[0] != "AUTH" || auth[1] != "secret" {
+		t.Fatalf("first command = %q, want AUTH secret", auth)
+	}
+	if eval := <-commands; eval[0] != "EVAL" || eval[3] != "rl:k" || eval[4] != "0.5" || eval[5] != "10" {
+		t.Fatalf("EVAL arguments = %q", eval[2:])
+	}
+
+	// The connection went back to the pool and is reused without AUTH
+	res, err = l.Allow(ctx, "k", policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Allowed || res.RetryAfter != 1500*time.Millisecond {
+		t.Fatalf("Allow = %+v, want denied retrying after 1.5s", res)
+	}
+
+	if _, err := l.Allow(ctx, "k", policy); err == nil || !strings.Contains(err.Error(), "boom") {
+		t.Fatalf("Allow error = %v, want the redis error", err)
+	}
+}
@@ -0,0 +1,226 @@
+package ratelimit
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenBucketScript refills and takes from a bucket atomically. The Redis
+// clock is used so replicas with skewed clocks share the same view.
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('EXPIRE', KEYS[1], math.ceil(burst / rate) + 1)
+return {allowed, tostring(tokens)}
+`
+
+// RedisLimiter keeps buckets in Redis so every replica enforces the same
+// limits. It speaks just enough of the Redis protocol to run one script.
+type RedisLimiter struct {
+	addr     string
+	password string
+	prefix   string
+	timeout  time.Duration
+	conns    chan *redisConn
+}
+
+// NewRedisLimiter returns a limiter storing buckets under prefix in the Redis
+// server at addr. Up to poolSize connections are kept open.
+func NewRedisLimiter(addr, password, prefix string, poolSize int) *RedisLimiter {
+	if poolSize <= 0 {
+		poolSize = 8
+	}
+
+	return &RedisLimiter{
+		addr:     addr,
+		password: password,
+		prefix:   prefix,
+		timeout:  time.Second,
+		conns:    make(chan *redisConn, poolSize),
+	}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, policy Policy) (Result, error) {
+	conn, err := l.get(ctx)
+	if err != nil {
+		return Result{}, err
+	}
+
+	reply, err := conn.do(ctx, l.timeout, "EVAL", tokenBucketScript, "1", l.prefix+key,
+		strconv.FormatFloat(policy.Rate, 'f', -1, 64), strconv.Itoa(policy.Burst))
+	if err != nil {
+		conn.Close()
+		return Result{}, err
+	}
+	l.put(conn)
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return Result{}, fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+
+	allowed, _ := values[0].(int64)
+	tokenStr, _ := values[1].(string)
+	tokens, err := strconv.ParseFloat(tokenStr, 64)
+	if err != nil {
+		return Result{}, fmt.Errorf("redis: unexpected tokens %q", tokenStr)
+	}
+
+	return result(allowed == 1, tokens, policy), nil
+}
+
+// Ping checks that Redis answers
+func (l *RedisLimiter) Ping(ctx context.Context) error {
+	conn, err := l.get(ctx)
+	if err != nil {
+		return err
+	}
+
+	reply, err := conn.do(ctx, l.timeout, "PING")
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	l.put(conn)
+
+	if reply != "PONG" {
+		return fmt.Errorf("redis: unexpected reply %v", reply)
+	}
+	return nil
+}
+
+// Close closes every pooled connection
+func (l *RedisLimiter) Close() error {
+	for {
+		select {
+		case conn := <-l.conns:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+func (l *RedisLimiter) get(ctx context.Context) (*redisConn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	default:
+	}
+
+	d := net.Dialer{Timeout: l.timeout}
+	nc, err := d.DialContext(ctx, "tcp", l.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{Conn: nc, r: bufio.NewReader(nc)}
+	if l.password != "" {
+		if _, err := conn.do(ctx, l.timeout, "AUTH", l.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (l *RedisLimiter) put(conn *redisConn) {
+	select {
+	case l.conns <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// do sends a command and reads its reply
+func (c *redisConn) do(ctx context.Context, timeout time.Duration, args ...string) (any, error) {
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	c.SetDeadline(deadline)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+
+	if _, err := c.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+
+	return c.read()
+}
+
+// read parses one RESP2 reply. Bulk strings become strings, integers int64
+// and arrays []any.
+func (c *redisConn) read() (any, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, errors.New("redis: " + line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		values := make([]any, n)
+		for i := range values {
+			if values[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
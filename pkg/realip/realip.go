@@ -0,0 +1,302 @@
+package realip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+type ctxKey struct{}
+
+type originKey struct{}
+
+// Origin is the scheme and host a client sent its request to, which behind
+// a proxy differ from what the server sees
+type Origin struct {
+	Scheme string
+	Host   string
+}
+
+// Resolver finds the address of the client behind a chain of trusted
+// proxies. Forwarding headers are only believed when the peer they come
+// from is trusted.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// New returns a resolver trusting the given CIDRs or single addresses
+func New(proxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, p := range proxies {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if !strings.Contains(p, "/") {
+			addr, err := netip.ParseAddr(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+			}
+			r.trusted = append(r.trusted, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", p, err)
+		}
+		r.trusted = append(r.trusted, prefix.Masked())
+	}
+
+	return r, nil
+}
+
+// ClientIP returns the client address of req. The Forwarded header is
+// preferred, then X-Forwarded-For and finally X-Real-IP. The chain is walked
+// from the nearest hop and the first untrusted address wins.
+func (r *Resolver) ClientIP(req *http.Request) string {
+	remote := RemoteIP(req)
+	if r == nil || len(r.trusted) == 0 || !r.isTrusted(remote) {
+		return remote
+	}
+
+	chain := forwarded(req.Header.Values("Forwarded"))
+	if len(chain) == 0 {
+		chain = forwardedFor(req.Header.Values("X-Forwarded-For"))
+	}
+	if len(chain) == 0 {
+		if ip := parseIP(req.Header.Get("X-Real-IP")); ip != "" {
+			return ip
+		}
+		return remote
+	}
+
+	// an unknown or obfuscated hop hides everything before it
+	if ip := chain[r.clientHop(chain)]; ip != "" {
+		return ip
+	}
+	return remote
+}
+
+// Origin returns the scheme and host req was addressed to. The proto= and
+// host= parameters of the Forwarded header, then X-Forwarded-Proto and
+// X-Forwarded-Host, are only believed when the peer is a trusted proxy.
+// Proxies append to these headers, so anything the client sent comes first:
+// the chain is walked from the nearest hop like in ClientIP and the value
+// added by the proxy the client talked to wins.
+func (r *Resolver) Origin(req *http.Request) Origin {
+	origin := directOrigin(req)
+	if r == nil || len(r.trusted) == 0 || !r.isTrusted(RemoteIP(req)) {
+		return origin
+	}
+
+	var proto, host string
+	if elems := forwardedElements(req.Header.Values("Forwarded")); len(elems) > 0 {
+		chain := make([]string, len(elems))
+		for i, elem := range elems {
+			chain[i] = parseIP(elem["for"])
+		}
+		elem := elems[r.clientHop(chain)]
+		proto, host = elem["proto"], elem["host"]
+	}
+
+	// Each trusted proxy appended one hop to X-Forwarded-For and one value
+	// to the other headers, the client's proxy is that many from the end
+	hops := 1
+	if chain := forwardedFor(req.Header.Values("X-Forwarded-For")); len(chain) > 0 {
+		hops = len(chain) - r.clientHop(chain)
+	}
+	if proto == "" {
+		proto = fromEnd(splitList(req.Header.Values("X-Forwarded-Proto")), hops)
+	}
+	if host == "" {
+		host = fromEnd(splitList(req.Header.Values("X-Forwarded-Host")), hops)
+	}
+
+	if proto = strings.ToLower(proto); proto == "http" || proto == "https" {
+		origin.Scheme = proto
+	}
+	if host != "" {
+		origin.Host = host
+	}
+
+	return origin
+}
+
+// clientHop walks chain from the nearest hop and returns the index of the
+// first untrusted or unknown one, 0 when every hop is trusted
+func (r *Resolver) clientHop(chain []string) int {
+	for i := len(chain) - 1; i >= 0; i-- {
+		if chain[i] == "" || !r.isTrusted(chain[i]) {
+			return i
+		}
+	}
+	return 0
+}
+
+// directOrigin is the origin of req as seen by the server
+func directOrigin(req *http.Request) Origin {
+	origin := Origin{Scheme: "http", Host: req.Host}
+	if req.TLS != nil {
+		origin.Scheme = "https"
+	}
+	return origin
+}
+
+func (r *Resolver) isTrusted(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+
+	addr = addr.Unmap()
+	for _, p := range r.trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forwarded extracts the for= parameters of RFC 7239 Forwarded headers
+func forwarded(values []string) []string {
+	var chain []string
+	for _, value := range values {
+		for _, elem := range strings.Split(value, ",") {
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok || !strings.EqualFold(k, "for") {
+					continue
+				}
+				chain = append(chain, parseIP(v))
+			}
+		}
+	}
+
+	return chain
+}
+
+// forwardedElements splits RFC 7239 Forwarded headers into one element per
+// hop, each mapping lower case parameter names to unquoted values
+func forwardedElements(values []string) []map[string]string {
+	var elems []map[string]string
+	for _, value := range values {
+		for _, elem := range strings.Split(value, ",") {
+			params := map[string]string{}
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if !ok {
+					continue
+				}
+				params[strings.ToLower(k)] = strings.Trim(strings.TrimSpace(v), `"`)
+			}
+			elems = append(elems, params)
+		}
+	}
+
+	return elems
+}
+
+// splitList splits comma separated header values into their entries
+func splitList(values []string) []string {
+	var list []string
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			list = append(list, strings.TrimSpace(entry))
+		}
+	}
+	return list
+}
+
+// fromEnd returns the n-th entry of list counting from the end, or "" when
+// the list is shorter
+func fromEnd(list []string, n int) string {
+	if n < 1 || n > len(list) {
+		return ""
+	}
+	return list[len(list)-n]
+}
+
+// forwardedFor splits X-Forwarded-For headers into their hops
+func forwardedFor(values []string) []string {
+	var chain []string
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				chain = append(chain, parseIP(hop))
+			}
+		}
+	}
+
+	return chain
+}
+
+// parseIP accepts a bare address, host:port, [v6]:port or a quoted
+// Forwarded node and returns the address, or "" when there is none
+func parseIP(s string) string {
+	s = strings.Trim(strings.TrimSpace(s), `"`)
+	if s == "" {
+		return ""
+	}
+
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return addr.Unmap().String()
+	}
+
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return ""
+	}
+
+	return addr.Unmap().String()
+}
+
+// RemoteIP returns the address of the peer that connected to us
+func RemoteIP(req *http.Request) string {
+	ip, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+
+	return ip
+}
+
+// WithClientIP returns a copy of ctx carrying the client address
+func WithClientIP(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, ip)
+}
+
+// FromRequest returns the client address stored in the request context,
+// falling back to the connected peer
+func FromRequest(req *http.Request) string {
+	if ip, ok := req.Context().Value(ctxKey{}).(string); ok && ip != "" {
+		return ip
+	}
+
+	return RemoteIP(req)
+}
+
+// WithOrigin returns a copy of ctx carrying the origin of the request
+func WithOrigin(ctx context.Context, origin Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, origin)
+}
+
+// OriginFromRequest returns the origin stored in the request context,
+// falling back to the scheme and host the server saw
+func OriginFromRequest(req *http.Request) Origin {
+	if origin, ok := req.Context().Value(originKey{}).(Origin); ok {
+		return origin
+	}
+
+	return directOrigin(req)
+}
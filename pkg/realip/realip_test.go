@@ -0,0 +1,194 @@
+package realip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// request builds a plain http request for short.example arriving from
+// remote with the given headers
+func request(remote string, headers map[string]string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "http://short.example/abc", nil)
+	req.RemoteAddr = remote
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return req
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "cidrs", proxies: []string{"10.0.0.0/8", "fd00::/8"}},
+		{name: "single addresses", proxies: []string{"127.0.0.1", " ::1 ", ""}},
+		{name: "bad address", proxies: []string{"10.0.0.300"}, wantErr: true},
+		{name: "bad cidr", proxies: []string{"10.0.0.0/33"}, wantErr: true},
+		{name: "hostname", proxies: []string{"proxy.lan"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.proxies)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("New(%q) error = %v, wantErr %v", tt.proxies, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r, err := New([]string{"10.0.0.0/8", "::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    string
+	}{
+		{
+			name:   "direct",
+			remote: "203.0.113.7:1234",
+			want:   "203.0.113.7",
+		},
+		{
+			name:    "untrusted peer ignores headers",
+			remote:  "203.0.113.7:1234",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.9", "X-Real-IP": "198.51.100.9"},
+			want:    "203.0.113.7",
+		},
+		{
+			name:    "trusted proxy",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.9"},
+			want:    "198.51.100.9",
+		},
+		{
+			name:    "spoofed hops before the client",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "6.6.6.6, 198.51.100.9, 10.0.0.2"},
+			want:    "198.51.100.9",
+		},
+		{
+			name:    "every hop trusted",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-For": "10.0.0.3, 10.0.0.2"},
+			want:    "10.0.0.3",
+		},
+		{
+			name:    "unknown hop",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"Forwarded": `for=198.51.100.9, for=unknown`},
+			want:    "10.0.0.1",
+		},
+		{
+			name:   "forwarded preferred",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded":       `for="[2001:db8::1]:4711";proto=https`,
+				"X-Forwarded-For": "198.51.100.9",
+			},
+			want: "2001:db8::1",
+		},
+		{
+			name:    "real ip fallback",
+			remote:  "[::1]:1234",
+			headers: map[string]string{"X-Real-IP": "198.51.100.9"},
+			want:    "198.51.100.9",
+		},
+		{
+			name:    "mapped v4 proxy",
+			remote:  "[::ffff:10.0.0.1]:1234",
+			headers: map[string]string{"X-Forwarded-For": "198.51.100.9:5555"},
+			want:    "198.51.100.9",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.ClientIP(request(tt.remote, tt.headers)); got != tt.want {
+				t.Fatalf("ClientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	r, err := New([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		remote  string
+		headers map[string]string
+		want    Origin
+	}{
+		{
+			name:   "direct",
+			remote: "10.0.0.1:1234",
+			want:   Origin{Scheme: "http", Host: "short.example"},
+		},
+		{
+			name:    "untrusted peer",
+			remote:  "203.0.113.7:1234",
+			headers: map[string]string{"X-Forwarded-Host": "evil.example", "X-Forwarded-Proto": "https"},
+			want:    Origin{Scheme: "http", Host: "short.example"},
+		},
+		{
+			name:    "trusted proxy",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-Host": "sho.rt", "X-Forwarded-Proto": "https"},
+			want:    Origin{Scheme: "https", Host: "sho.rt"},
+		},
+		{
+			name:   "spoofed host before the proxy's",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For":   "198.51.100.9",
+				"X-Forwarded-Host":  "evil.example, sho.rt",
+				"X-Forwarded-Proto": "http, https",
+			},
+			want: Origin{Scheme: "https", Host: "sho.rt"},
+		},
+		{
+			name:   "two trusted proxies",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"X-Forwarded-For":  "6.6.6.6, 198.51.100.9, 10.0.0.2",
+				"X-Forwarded-Host": "evil.example, sho.rt, internal.lan",
+			},
+			want: Origin{Scheme: "http", Host: "sho.rt"},
+		},
+		{
+			name:   "spoofed forwarded element",
+			remote: "10.0.0.1:1234",
+			headers: map[string]string{
+				"Forwarded": `for=6.6.6.6;host=evil.example;proto=http, for=198.51.100.9;host=sho.rt;proto=https`,
+			},
+			want: Origin{Scheme: "https", Host: "sho.rt"},
+		},
+		{
+			name:    "unknown scheme ignored",
+			remote:  "10.0.0.1:1234",
+			headers: map[string]string{"X-Forwarded-Proto": "gopher"},
+			want:    Origin{Scheme: "http", Host: "short.example"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := r.Origin(request(tt.remote, tt.headers)); got != tt.want {
+				t.Fatalf("Origin = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
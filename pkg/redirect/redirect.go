@@ -0,0 +1,178 @@
+package redirect
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Query policies say what happens to the query string of the request
+const (
+	// PolicyDrop ignores it
+	PolicyDrop = "drop"
+	// PolicyAppend adds its parameters after those of the destination
+	PolicyAppend = "append"
+	// PolicyOverride replaces the destination parameters of the same name
+	PolicyOverride = "override"
+)
+
+// Codes are the statuses a link or a domain may redirect with
+var Codes = []int{
+	http.StatusMovedPermanently,
+	http.StatusFound,
+	http.StatusTemporaryRedirect,
+	http.StatusPermanentRedirect,
+}
+
+// Parameters of a short link the service reads itself
+const (
+	// ScanParam marks the clicks of tracked QR codes
+	ScanParam = "qr"
+	// PreviewParam asks for the preview page instead of the redirect
+	PreviewParam = "preview"
+)
+
+// serviceParams are never passed on to destinations
+var serviceParams = []string{ScanParam, PreviewParam}
+
+// UTMParams are the parameters a link can inject into its destination
+var UTMParams = []string{"utm_source", "utm_medium", "utm_campaign", "utm_term", "utm_content"}
+
+// Placeholders expanded in UTM templates
+var placeholders = []string{"{code}", "{domain}", "{source}"}
+
+// MaxUTMLength bounds a UTM template
+const MaxUTMLength = 200
+
+// Vars are the values of the placeholders of a redirect
+type Vars struct {
+	Code   string
+	Domain string
+	Source string
+}
+
+// ParsePolicy checks a query policy, empty stays empty
+func ParsePolicy(policy string) (string, error) {
+	policy = strings.ToLower(policy)
+	switch policy {
+	case "", PolicyDrop, PolicyAppend, PolicyOverride:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown query policy %q, use drop, append or override", policy)
+	}
+}
+
+// ValidCode reports whether code is one of Codes
+func ValidCode(code int) bool {
+	return slices.Contains(Codes, code)
+}
+
+// Permanent reports whether browsers may cache a redirect with code
+func Permanent(code int) bool {
+	return code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect
+}
+
+// ParseUTM reads the UTM templates among q. Templates may use {code},
+// {domain} and {source}, the link or qr the click came from.
+func ParseUTM(q url.Values) (url.Values, error) {
+	utm := url.Values{}
+	for _, name := range UTMParams {
+		tpl := strings.TrimSpace(q.Get(name))
+		if tpl == "" {
+			continue
+		}
+		if len(tpl) > MaxUTMLength {
+			return nil, fmt.Errorf("%s is longer than %d characters", name, MaxUTMLength)
+		}
+
+		rest := tpl
+		for _, p := range placeholders {
+			rest = strings.ReplaceAll(rest, p, "")
+		}
+		if strings.ContainsAny(rest, "{}") {
+			return nil, fmt.Errorf("%s has an unknown placeholder, use {code}, {domain} or {source}", name)
+		}
+
+		utm.Set(name, tpl)
+	}
+	return utm, nil
+}
+
+// Destination returns target with the UTM parameters it does not carry
+// yet and, following policy, the incoming parameters but the service's own
+func Destination(target string, incoming url.Values, policy string, utm url.Values, vars Vars) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+
+	if slices.ContainsFunc(serviceParams, incoming.Has) {
+		incoming = maps.Clone(incoming)
+		for _, name := range serviceParams {
+			incoming.Del(name)
+		}
+	}
+
+	existing := u.Query()
+	extra := url.Values{}
+
+	replacer := strings.NewReplacer("{code}", vars.Code, "{domain}", vars.Domain, "{source}", vars.Source)
+	for _, name := range UTMParams {
+		if tpl := utm.Get(name); tpl != "" && !existing.Has(name) {
+			extra.Set(name, replacer.Replace(tpl))
+		}
+	}
+
+	// The pairs of the destination keep their order and encoding, only
+	// overridden ones are removed
+	pairs := []string{}
+	if u.RawQuery != "" {
+		pairs = strings.Split(u.RawQuery, "&")
+	}
+
+	switch policy {
+	case PolicyAppend:
+		appendValues(extra, incoming)
+	case PolicyOverride:
+		pairs = slices.DeleteFunc(pairs, func(pair string) bool {
+			key, _, _ := strings.Cut(pair, "=")
+			key, err := url.QueryUnescape(key)
+			return err == nil && incoming.Has(key)
+		})
+		for key := range incoming {
+			extra.Del(key)
+		}
+		appendValues(extra, incoming)
+	}
+
+	// Nothing is added, and so nothing was overridden either
+	if len(extra) == 0 {
+		return target, nil
+	}
+
+	u.RawQuery = strings.Join(append(pairs, extra.Encode()), "&")
+	return u.String(), nil
+}
+
+// CacheControl returns the Cache-Control header of a redirect with code.
+// Permanent redirects are cached for maxAge, after which browsers ask again
+// and the click is counted. Temporary ones are never cached so every click
+// is.
+func CacheControl(code int, maxAge time.Duration) string {
+	if Permanent(code) && maxAge > 0 {
+		return fmt.Sprintf("public, max-age=%d", int(maxAge.Seconds()))
+	}
+	return "private, no-cache"
+}
+
+func appendValues(dst, src url.Values) {
+	for key, values := range src {
+		for _, v := range values {
+			dst.Add(key, v)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+package redirect
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{in: "", want: ""},
+		{in: "drop", want: PolicyDrop},
+		{in: "Append", want: PolicyAppend},
+		{in: "OVERRIDE", want: PolicyOverride},
+		{in: "merge", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePolicy(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePolicy(%q) error = %v, wantErr %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("ParsePolicy(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidCode(t *testing.T) {
+	for code, want := range map[int]bool{
+		200: false, 300: false, 301: true, 302: true, 303: false,
+		304: false, 307: true, 308: true, 400: false,
+	} {
+		if got := ValidCode(code); got != want {
+			t.Fatalf("ValidCode(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
+
+func TestParseUTM(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   url.Values
+		want    url.Values
+		wantErr bool
+	}{
+		{
+			name:  "none",
+			query: url.Values{"title": {"x"}},
+			want:  url.Values{},
+		},
+		{
+			name:  "placeholders",
+			query: url.Values{"utm_source": {" {source} "}, "utm_campaign": {"{domain}-{code}"}, "other": {"x"}},
+			want:  url.Values{"utm_source": {"{source}"}, "utm_campaign": {"{domain}-{code}"}},
+		},
+		{
+			name:    "unknown placeholder",
+			query:   url.Values{"utm_medium": {"{user}"}},
+			wantErr: true,
+		},
+		{
+			name:    "stray brace",
+			query:   url.Values{"utm_term": {"{code"}},
+			wantErr: true,
+		},
+		{
+			name:    "too long",
+			query:   url.Values{"utm_content": {strings.Repeat("x", MaxUTMLength+1)}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseUTM(tt.query)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseUTM error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Encode() != tt.want.Encode() {
+				t.Fatalf("ParseUTM = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDestination(t *testing.T) {
+	vars := Vars{Code: "abc", Domain: "sho.rt", Source: "link"}
+
+	tests := []struct {
+		name     string
+		target   string
+		incoming url.Values
+		policy   string
+		utm      url.Values
+		want     string
+	}{
+		{
+			name:     "drop",
+			target:   "https://example.com/p?a=1",
+			incoming: url.Values{"b": {"2"}},
+			policy:   PolicyDrop,
+			want:     "https://example.com/p?a=1",
+		},
+		{
+			name:     "no policy drops",
+			target:   "https://example.com/p?a=1",
+			incoming: url.Values{"b": {"2"}},
+			want:     "https://example.com/p?a=1",
+		},
+		{
+			name:     "append keeps both",
+			target:   "https://example.com/p?a=1",
+			incoming: url.Values{"a": {"2"}, "b": {"3"}},
+			policy:   PolicyAppend,
+			want:     "https://example.com/p?a=1&a=2&b=3",
+		},
+		{
+			name:     "override replaces",
+			target:   "https://example.com/p?a=1&keep=%2F",
+			incoming: url.Values{"a": {"2"}},
+			policy:   PolicyOverride,
+			want:     "https://example.com/p?keep=%2F&a=2",
+		},
+		{
+			name:     "service params stripped",
+			target:   "https://example.com/p",
+			incoming: url.Values{ScanParam: {"sig"}, PreviewParam: {"1"}, "b": {"2"}},
+			policy:   PolicyAppend,
+			want:     "https://example.com/p?b=2",
+		},
+		{
+			name:   "utm expanded",
+			target: "https://example.com/p",
+			utm:    url.Values{"utm_source": {"{source}"}, "utm_campaign": {"{domain}-{code}"}},
+			want:   "https://example.com/p?utm_campaign=sho.rt-abc&utm_source=link",
+		},
+		{
+			name:   "destination utm wins",
+			target: "https://example.com/p?utm_source=newsletter",
+			utm:    url.Values{"utm_source": {"{source}"}},
+			want:   "https://example.com/p?utm_source=newsletter",
+		},
+		{
+			name:     "override beats utm",
+			target:   "https://example.com/p",
+			incoming: url.Values{"utm_source": {"ad"}},
+			policy:   PolicyOverride,
+			utm:      url.Values{"utm_source": {"{source}"}},
+			want:     "https://example.com/p?utm_source=ad",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Destination(tt.target, tt.incoming, tt.policy, tt.utm, vars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Fatalf("Destination = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDestinationKeepsIncoming(t *testing.T) {
+	incoming := url.Values{ScanParam: {"sig"}, "b": {"2"}}
+	if _, err := Destination("https://example.com", incoming, PolicyAppend, nil, Vars{}); err != nil {
+		t.Fatal(err)
+	}
+	if !incoming.Has(ScanParam) {
+		t.Fatalf("Destination modified the incoming values: %v", incoming)
+	}
+}
+
+func TestCacheControl(t *testing.T) {
+	tests := []struct {
+		code   int
+		maxAge time.Duration
+		want   string
+	}{
+		{code: 301, maxAge: time.Hour, want: "public, max-age=3600"},
+		{code: 308, maxAge: 90 * time.Second, want: "public, max-age=90"},
+		{code: 301, want: "private, no-cache"},
+		{code: 302, maxAge: time.Hour, want: "private, no-cache"},
+		{code: 307, maxAge: time.Hour, want: "private, no-cache"},
+	}
+
+	for _, tt := range tests {
+		if got := CacheControl(tt.code, tt.maxAge); got != tt.want {
+			t.Fatalf("CacheControl(%d, %s) = %q, want %q", tt.code, tt.maxAge, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package rules
+
+import (
+	"log/slog"
+	"time"
+)
+
+type Options func(*EngineParams) error
+
+type EngineParams struct {
+	logger         *slog.Logger
+	blocklists     []string
+	allowlists     []string
+	allowlistOnly  bool
+	reloadInterval time.Duration
+}
+
+func newEngineParams(opts ...Options) (*EngineParams, error) {
+	params := &EngineParams{
+		reloadInterval: 30 * time.Second,
+	}
+	for _, opt := range opts {
+		if err := opt(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+func WithLogger(logger *slog.Logger) Options {
+	return func(p *EngineParams) error {
+		p.logger = logger
+		return nil
+	}
+}
+
+// WithBlocklists sets the files listing blocked destinations
+func WithBlocklists(paths ...string) Options {
+	return func(p *EngineParams) error {
+		p.blocklists = paths
+		return nil
+	}
+}
+
+// WithAllowlists sets the files listing destinations that are never blocked
+func WithAllowlists(paths ...string) Options {
+	return func(p *EngineParams) error {
+		p.allowlists = paths
+		return nil
+	}
+}
+
+// WithAllowlistOnly blocks every destination missing from the allowlists
+func WithAllowlistOnly(only bool) Options {
+	return func(p *EngineParams) error {
+		p.allowlistOnly = only
+		return nil
+	}
+}
+
+// WithReloadInterval sets how often the files are checked for changes
+func WithReloadInterval(interval time.Duration) Options {
+	return func(p *EngineParams) error {
+		p.reloadInterval = interval
+		return nil
+	}
+}
+
+// getters -----
+
+func (p *EngineParams) Logger() *slog.Logger {
+	return p.logger
+}
+
+func (p *EngineParams) Blocklists() []string {
+	return p.blocklists
+}
+
+func (p *EngineParams) Allowlists() []string {
+	return p.allowlists
+}
+
+func (p *EngineParams) AllowlistOnly() bool {
+	return p.allowlistOnly
+}
+
+func (p *EngineParams) ReloadInterval() time.Duration {
+	return p.reloadInterval
+}
@@ -0,0 +1,180 @@
+package rules
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Verdict is the outcome of checking a destination against the rules
+type Verdict struct {
+	Blocked bool
+	// Rule is the file and line of the matching rule, empty when blocked
+	// only because the destination is missing from the allowlist
+	Rule   string
+	Reason string
+}
+
+type lists struct {
+	block *ruleset
+	allow *ruleset
+	// mtimes of the files the lists were read from
+	mtimes map[string]time.Time
+}
+
+// Engine checks destinations against blocklist and allowlist files. The
+// files are re-read when they change on disk, checked at most once per
+// reload interval, so rules can be updated without a restart.
+type Engine struct {
+	params *EngineParams
+
+	current   atomic.Pointer[lists]
+	reloading sync.Mutex
+	checked   atomic.Int64 // unix nanoseconds of the last change check
+	// reloadErr holds the error of the last failed hot reload, cleared by
+	// the next successful one
+	reloadErr atomic.Pointer[error]
+}
+
+func NewEngine(opts ...Options) (*Engine, error) {
+	params, err := newEngineParams(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if params.Logger() == nil {
+		return nil, fmt.Errorf("logger is required")
+	}
+
+	e := &Engine{params: params}
+	if err := e.Reload(); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// Check returns whether u may be shortened or redirected to. Allowlist
+// matches win over blocklist matches.
+func (e *Engine) Check(u *url.URL) Verdict {
+	e.maybeReload()
+	l := e.current.Load()
+
+	if rule, ok := l.allow.match(u); ok {
+		return Verdict{Rule: rule}
+	}
+
+	if rule, ok := l.block.match(u); ok {
+		return Verdict{Blocked: true, Rule: rule, Reason: "destination is blocklisted"}
+	}
+
+	if e.params.AllowlistOnly() {
+		return Verdict{Blocked: true, Reason: "destination is not allowlisted"}
+	}
+
+	return Verdict{}
+}
+
+// CheckString parses rawURL and checks it. Unparseable URLs are blocked.
+func (e *Engine) CheckString(rawURL string) Verdict {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Verdict{Blocked: true, Reason: "malformed destination"}
+	}
+	return e.Check(u)
+}
+
+// Reload reads every rule file. On error the previous rules stay active.
+func (e *Engine) Reload() error {
+	e.reloading.Lock()
+	defer e.reloading.Unlock()
+
+	l := &lists{block: newRuleset(), allow: newRuleset(), mtimes: map[string]time.Time{}}
+
+	for _, f := range []struct {
+		paths []string
+		into  *ruleset
+	}{
+		{e.params.Blocklists(), l.block},
+		{e.params.Allowlists(), l.allow},
+	} {
+		for _, path := range f.paths {
+			file, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+
+			info, err := file.Stat()
+			if err == nil {
+				l.mtimes[path] = info.ModTime()
+				err = f.into.parse(file, path)
+			}
+			file.Close()
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	if e.params.AllowlistOnly() && l.allow.empty() {
+		e.params.Logger().Warn("Allowlist only mode with an empty allowlist blocks every destination")
+	}
+
+	e.current.Store(l)
+	e.checked.Store(time.Now().UnixNano())
+	e.reloadErr.Store(nil)
+	return nil
+}
+
+// Health returns why the last hot reload failed, or nil when the rules on
+// disk are the ones in use
+func (e *Engine) Health() error {
+	if err := e.reloadErr.Load(); err != nil {
+		return *err
+	}
+	return nil
+}
+
+// maybeReload reloads the rules when a file changed, checking at most once
+// per reload interval and never blocking a request on another reload
+func (e *Engine) maybeReload() {
+	last := time.Unix(0, e.checked.Load())
+	if time.Since(last) < e.params.ReloadInterval() {
+		return
+	}
+
+	if !e.reloading.TryLock() {
+		return
+	}
+	changed := e.changed()
+	e.checked.Store(time.Now().UnixNano())
+	e.reloading.Unlock()
+
+	if !changed {
+		return
+	}
+
+	if err := e.Reload(); err != nil {
+		e.reloadErr.Store(&err)
+		e.params.Logger().Error("Failed to reload rule files, keeping previous rules",
+			slog.String("error", err.Error()))
+		return
+	}
+
+	e.params.Logger().Info("Reloaded rule files")
+}
+
+func (e *Engine) changed() bool {
+	for path, mtime := range e.current.Load().mtimes {
+		info, err := os.Stat(path)
+		if err != nil || !info.ModTime().Equal(mtime) {
+			return true
+		}
+	}
+	return false
+}
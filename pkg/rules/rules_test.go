@@ -0,0 +1,161 @@
+package rules
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// writeList writes lines to name in dir and returns its path
+func writeList(t *testing.T, dir, name string, lines ...string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func hashPrefix(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+func TestCheck(t *testing.T) {
+	dir := t.TempDir()
+	block := writeList(t, dir, "block.txt",
+		"# phishing",
+		"",
+		"Evil.Example.",
+		"*.malware.test",
+		`regex:^https?://[^/]+/wp-admin/`,
+		"sha256:"+hashPrefix("hidden.test/secret"),
+		"sha256:"+hashPrefix("whole.test/"),
+	)
+	allow := writeList(t, dir, "allow.txt", "good.malware.test")
+
+	e, err := NewEngine(WithLogger(logger), WithBlocklists(block), WithAllowlists(allow))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		url     string
+		blocked bool
+		rule    string
+	}{
+		{url: "https://example.com/"},
+		{url: "https://evil.example/login", blocked: true, rule: block + ":3"},
+		{url: "https://EVIL.EXAMPLE./", blocked: true, rule: block + ":3"},
+		{url: "https://sub.evil.example/", blocked: false},
+		{url: "https://malware.test/", blocked: false},
+		{url: "https://a.b.malware.test/x", blocked: true, rule: block + ":4"},
+		{url: "https://good.malware.test/", blocked: false, rule: allow + ":1"},
+		{url: "https://blog.example/wp-admin/index.php", blocked: true, rule: block + ":5"},
+		{url: "https://hidden.test/secret", blocked: true, rule: block + ":6"},
+		{url: "https://hidden.test/other", blocked: false},
+		{url: "https://whole.test/anything", blocked: true, rule: block + ":7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			v := e.CheckString(tt.url)
+			if v.Blocked != tt.blocked || v.Rule != tt.rule {
+				t.Fatalf("CheckString(%q) = %+v, want blocked %v by %q", tt.url, v, tt.blocked, tt.rule)
+			}
+		})
+	}
+
+	if v := e.CheckString("https://%zz"); !v.Blocked {
+		t.Fatalf("CheckString(malformed) = %+v, want blocked", v)
+	}
+}
+
+func TestAllowlistOnly(t *testing.T) {
+	allow := writeList(t, t.TempDir(), "allow.txt", "*.example.com")
+
+	e, err := NewEngine(WithLogger(logger), WithAllowlists(allow), WithAllowlistOnly(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if v := e.CheckString("https://www.example.com/"); v.Blocked {
+		t.Fatalf("allowlisted destination blocked: %+v", v)
+	}
+	if v := e.CheckString("https://example.org/"); !v.Blocked || v.Rule != "" {
+		t.Fatalf("unlisted destination = %+v, want blocked without a rule", v)
+	}
+}
+
+func TestNewEngineErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name string
+		opts []Options
+	}{
+		{name: "no logger"},
+		{name: "missing file", opts: []Options{WithLogger(logger), WithBlocklists(filepath.Join(dir, "none.txt"))}},
+		{name: "bad regex", opts: []Options{WithLogger(logger), WithBlocklists(writeList(t, dir, "re.txt", "regex:(["))}},
+		{name: "short hash", opts: []Options{WithLogger(logger), WithBlocklists(writeList(t, dir, "short.txt", "sha256:abcd"))}},
+		{name: "bad hash", opts: []Options{WithLogger(logger), WithAllowlists(writeList(t, dir, "hex.txt", "sha256:zzzzzzzzzz"))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewEngine(tt.opts...); err == nil {
+				t.Fatal("NewEngine error = nil, want an error")
+			}
+		})
+	}
+}
+
+func TestHotReload(t *testing.T) {
+	dir := t.TempDir()
+	block := writeList(t, dir, "block.txt", "one.test")
+
+	e, err := NewEngine(WithLogger(logger), WithBlocklists(block), WithReloadInterval(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// touch sets a modification time the previous load cannot have seen
+	mtime := time.Now()
+	touch := func() {
+		mtime = mtime.Add(time.Minute)
+		if err := os.Chtimes(block, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeList(t, dir, "block.txt", "two.test")
+	touch()
+	if e.CheckString("https://one.test/").Blocked || !e.CheckString("https://two.test/").Blocked {
+		t.Fatal("rules were not reloaded after the file changed")
+	}
+
+	// A broken file keeps the previous rules and is reported
+	writeList(t, dir, "block.txt", "regex:([")
+	touch()
+	if !e.CheckString("https://two.test/").Blocked {
+		t.Fatal("previous rules dropped by a failed reload")
+	}
+	if e.Health() == nil {
+		t.Fatal("Health = nil after a failed reload")
+	}
+
+	writeList(t, dir, "block.txt", "three.test")
+	touch()
+	if !e.CheckString("https://three.test/").Blocked || e.Health() != nil {
+		t.Fatalf("recovered reload: health %v", e.Health())
+	}
+}
@@ -0,0 +1,124 @@
+package rules
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ruleset is the parsed content of one kind of list (block or allow)
+type ruleset struct {
+	hosts     map[string]string // host -> source
+	wildcards map[string]string // domain suffix -> source
+	regexes   []sourced[*regexp.Regexp]
+	prefixes  []sourced[string]
+}
+
+type sourced[T any] struct {
+	value  T
+	source string
+}
+
+func newRuleset() *ruleset {
+	return &ruleset{
+		hosts:     make(map[string]string),
+		wildcards: make(map[string]string),
+	}
+}
+
+// parse adds the rules of r, one per line:
+//
+//	example.com          the exact host
+//	*.example.com        any subdomain of example.com
+//	regex:<expression>   a regular expression matched against the full URL
+//	sha256:<hex prefix>  a prefix of the SHA-256 of "host/" or "host/path"
+//
+// Empty lines and lines starting with # are ignored.
+func (rs *ruleset) parse(r io.Reader, name string) error {
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		source := fmt.Sprintf("%s:%d", name, n)
+
+		switch {
+		case strings.HasPrefix(line, "regex:"):
+			re, err := regexp.Compile(strings.TrimPrefix(line, "regex:"))
+			if err != nil {
+				return fmt.Errorf("%s: %w", source, err)
+			}
+			rs.regexes = append(rs.regexes, sourced[*regexp.Regexp]{re, source})
+		case strings.HasPrefix(line, "sha256:"):
+			prefix := strings.ToLower(strings.TrimPrefix(line, "sha256:"))
+			if _, err := hex.DecodeString(prefix); err != nil || len(prefix) < 8 {
+				return fmt.Errorf("%s: hash prefix must be at least 8 hex characters", source)
+			}
+			rs.prefixes = append(rs.prefixes, sourced[string]{prefix, source})
+		case strings.HasPrefix(line, "*."):
+			rs.wildcards[normalizeHost(line[2:])] = source
+		default:
+			rs.hosts[normalizeHost(line)] = source
+		}
+	}
+
+	return scanner.Err()
+}
+
+// match returns the source of the first rule matching u
+func (rs *ruleset) match(u *url.URL) (string, bool) {
+	host := normalizeHost(u.Hostname())
+
+	if source, ok := rs.hosts[host]; ok {
+		return source, true
+	}
+
+	// Walk up the parent domains: a.b.example.com, b.example.com, example.com
+	for parent := host; ; {
+		_, rest, ok := strings.Cut(parent, ".")
+		if !ok {
+			break
+		}
+		if source, ok := rs.wildcards[rest]; ok {
+			return source, true
+		}
+		parent = rest
+	}
+
+	if len(rs.prefixes) > 0 {
+		for _, expr := range []string{host + "/", host + u.EscapedPath()} {
+			sum := sha256.Sum256([]byte(expr))
+			digest := hex.EncodeToString(sum[:])
+			for _, p := range rs.prefixes {
+				if strings.HasPrefix(digest, p.value) {
+					return p.source, true
+				}
+			}
+		}
+	}
+
+	full := u.String()
+	for _, re := range rs.regexes {
+		if re.value.MatchString(full) {
+			return re.source, true
+		}
+	}
+
+	return "", false
+}
+
+func (rs *ruleset) empty() bool {
+	return len(rs.hosts) == 0 && len(rs.wildcards) == 0 &&
+		len(rs.regexes) == 0 && len(rs.prefixes) == 0
+}
+
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
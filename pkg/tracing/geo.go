@@ -0,0 +1,41 @@
+package tracing
+
+import (
+	"context"
+
+	"github.com/thiagozs/go-shorturl/infra/database/model"
+	"github.com/thiagozs/go-shorturl/pkg/geo"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// geoTracer wraps a geolocation resolver in spans
+type geoTracer struct {
+	next     geo.GeoResolver
+	provider string
+}
+
+// Geo returns a resolver tracing every lookup made through next
+func Geo(provider string, next geo.GeoResolver) geo.GeoResolver {
+	return &geoTracer{next: next, provider: provider}
+}
+
+func (g *geoTracer) Lookup(ctx context.Context, ip string) (model.Location, error) {
+	ctx, span := Tracer().Start(ctx, "geo.Lookup")
+	span.SetAttributes(attribute.String("geo.provider", g.provider))
+
+	loc, err := g.next.Lookup(ctx, ip)
+	if err == nil {
+		span.SetAttributes(attribute.String("geo.country_code", loc.CountryCode))
+	}
+	End(span, err)
+
+	return loc, err
+}
+
+func (g *geoTracer) Ping(ctx context.Context) error {
+	return geo.Ping(ctx, g.next)
+}
+
+func (g *geoTracer) Close() error {
+	return geo.Close(g.next)
+}
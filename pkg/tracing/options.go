@@ -0,0 +1,94 @@
+package tracing
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+type Options func(*TracingParams) error
+
+type TracingParams struct {
+	exporter    string
+	serviceName string
+	sampleRatio float64
+	writer      io.Writer
+}
+
+func newTracingParams(opts ...Options) (*TracingParams, error) {
+	params := &TracingParams{
+		exporter:    ExporterNone,
+		serviceName: "go-shorturl",
+		sampleRatio: 1,
+		writer:      os.Stdout,
+	}
+	for _, opt := range opts {
+		if err := opt(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// WithExporter selects where spans go: none, stdout or otlp. The OTLP
+// exporter reads its endpoint and headers from the standard
+// OTEL_EXPORTER_OTLP_* variables.
+func WithExporter(exporter string) Options {
+	return func(p *TracingParams) error {
+		switch exporter {
+		case ExporterNone, ExporterStdout, ExporterOTLP:
+			p.exporter = exporter
+			return nil
+		default:
+			return fmt.Errorf("unknown tracing exporter %q", exporter)
+		}
+	}
+}
+
+func WithServiceName(name string) Options {
+	return func(p *TracingParams) error {
+		if name == "" {
+			return fmt.Errorf("service name cannot be empty")
+		}
+		p.serviceName = name
+		return nil
+	}
+}
+
+// WithSampleRatio sets the share of new traces that are recorded, traces
+// started upstream keep their sampling decision
+func WithSampleRatio(ratio float64) Options {
+	return func(p *TracingParams) error {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("sample ratio must be between 0 and 1")
+		}
+		p.sampleRatio = ratio
+		return nil
+	}
+}
+
+// WithWriter sets where the stdout exporter writes
+func WithWriter(w io.Writer) Options {
+	return func(p *TracingParams) error {
+		p.writer = w
+		return nil
+	}
+}
+
+// getters -----
+
+func (p *TracingParams) Exporter() string {
+	return p.exporter
+}
+
+func (p *TracingParams) ServiceName() string {
+	return p.serviceName
+}
+
+func (p *TracingParams) SampleRatio() float64 {
+	return p.sampleRatio
+}
+
+func (p *TracingParams) Writer() io.Writer {
+	return p.writer
+}
@@ -0,0 +1,98 @@
+package useragent
+
+import "strings"
+
+// Device classes
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceOther   = "other"
+)
+
+// Unknown is reported for any part of a user agent that is not recognised
+const Unknown = "Unknown"
+
+// Agent is what a User-Agent header tells about the client
+type Agent struct {
+	Browser string `json:"browser"`
+	OS      string `json:"os"`
+	Device  string `json:"device"`
+}
+
+// rule maps a token found in the user agent to a name. Order matters: many
+// browsers also claim to be the ones they are built on.
+type rule struct {
+	token string
+	name  string
+}
+
+var browsers = []rule{
+	{"edg/", "Edge"},
+	{"edge/", "Edge"},
+	{"opr/", "Opera"},
+	{"opera", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"yabrowser/", "Yandex"},
+	{"vivaldi/", "Vivaldi"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chromium/", "Chromium"},
+	{"chrome/", "Chrome"},
+	{"safari/", "Safari"},
+	{"msie ", "Internet Explorer"},
+	{"trident/", "Internet Explorer"},
+	{"curl/", "curl"},
+	{"wget/", "Wget"},
+	{"go-http-client/", "Go"},
+	{"python-requests/", "Python"},
+}
+
+var systems = []rule{
+	{"windows", "Windows"},
+	{"iphone", "iOS"},
+	{"ipad", "iOS"},
+	{"ipod", "iOS"},
+	{"android", "Android"},
+	{"cros", "ChromeOS"},
+	{"mac os x", "macOS"},
+	{"macintosh", "macOS"},
+	{"linux", "Linux"},
+	{"freebsd", "FreeBSD"},
+}
+
+// Parse extracts the browser, operating system and device class from a
+// User-Agent header
+func Parse(ua string) Agent {
+	s := strings.ToLower(ua)
+	agent := Agent{
+		Browser: match(s, browsers),
+		OS:      match(s, systems),
+	}
+
+	switch {
+	case strings.Contains(s, "ipad") || strings.Contains(s, "tablet") ||
+		(strings.Contains(s, "android") && !strings.Contains(s, "mobile")):
+		agent.Device = DeviceTablet
+	case strings.Contains(s, "mobile") || strings.Contains(s, "iphone") ||
+		strings.Contains(s, "ipod"):
+		agent.Device = DeviceMobile
+	case agent.OS == "Windows" || agent.OS == "macOS" || agent.OS == "Linux" ||
+		agent.OS == "ChromeOS" || agent.OS == "FreeBSD":
+		agent.Device = DeviceDesktop
+	default:
+		agent.Device = DeviceOther
+	}
+
+	return agent
+}
+
+func match(s string, rules []rule) string {
+	for _, r := range rules {
+		if strings.Contains(s, r.token) {
+			return r.name
+		}
+	}
+	return Unknown
+}
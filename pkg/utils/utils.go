@@ -3,12 +3,31 @@ package utils
 import (
 	"crypto/rand"
 	"encoding/base64"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
+	"net"
+	"slices"
+	"strings"
+	"unicode/utf8"
 )
 
+// Limits of the tags a link can carry
+const (
+	MaxTags      = 10
+	MaxTagLength = 32
+)
+
+// MaxTitleLength bounds the title of a link, in characters
+const MaxTitleLength = 200
+
+// ParseTitle trims a link title and checks its length
+func ParseTitle(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if utf8.RuneCountInString(s) > MaxTitleLength {
+		return "", fmt.Errorf("title is longer than %d characters", MaxTitleLength)
+	}
+	return s, nil
+}
+
 // generateShortURL creates a random string to use as a short URL
 func GenerateShortURL() (string, error) {
 	b := make([]byte, 4)
@@ -20,32 +39,57 @@ func GenerateShortURL() (string, error) {
 	return base64.URLEncoding.EncodeToString(b)[:6], nil // Return a 6-character string
 }
 
-// getGeoLocation fetches the geolocation of an IP address using ip-api.com
-func GetGeoLocation(ip string) string {
-	value := "Unknown"
-	resp, err := http.Get(fmt.Sprintf("http://ip-api.com/json/%s", ip))
-	if err != nil {
-		return value
+// ParseTags splits a comma separated list of tags, lowercasing them and
+// dropping duplicates. Tags may hold letters, digits, '-', '_', ':' and '.'.
+func ParseTags(s string) ([]string, error) {
+	tags := []string{}
+	for _, tag := range strings.Split(s, ",") {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || slices.Contains(tags, tag) {
+			continue
+		}
+
+		if len(tag) > MaxTagLength {
+			return nil, fmt.Errorf("tag %q is longer than %d characters", tag, MaxTagLength)
+		}
+		for _, r := range tag {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune("-_:.", r)) {
+				return nil, fmt.Errorf("tag %q has an invalid character %q", tag, r)
+			}
+		}
+
+		tags = append(tags, tag)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return value
+	if len(tags) > MaxTags {
+		return nil, fmt.Errorf("at most %d tags are allowed", MaxTags)
 	}
 
-	// Parse the response
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		return value
+	return tags, nil
+}
+
+// ParseDomain lowercases a host name, dropping a port and a trailing dot,
+// and rejects anything that is not a valid DNS name
+func ParseDomain(s string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if host, _, err := net.SplitHostPort(name); err == nil {
+		name = host
 	}
+	name = strings.TrimSuffix(name, ".")
 
-	// Extract city and country
-	if result["status"] == "success" {
-		city := result["city"].(string)
-		country := result["country"].(string)
-		return fmt.Sprintf("%s, %s", city, country)
+	if name == "" || len(name) > 253 {
+		return "", fmt.Errorf("invalid domain %q", s)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return "", fmt.Errorf("invalid domain %q", s)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-') {
+				return "", fmt.Errorf("invalid domain %q", s)
+			}
+		}
 	}
 
-	return value
+	return name, nil
 }
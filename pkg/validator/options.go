@@ -0,0 +1,136 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+type Options func(*ValidatorParams) error
+
+// Resolver looks up the addresses of a host, net.DefaultResolver satisfies it
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type ValidatorParams struct {
+	schemes      []string
+	maxLength    int
+	blockPrivate bool
+	resolve      bool
+	resolver     Resolver
+	timeout      time.Duration
+	selfDomains  []string
+}
+
+func newValidatorParams(opts ...Options) (*ValidatorParams, error) {
+	params := &ValidatorParams{
+		schemes:      []string{"http", "https"},
+		maxLength:    2048,
+		blockPrivate: true,
+		resolver:     net.DefaultResolver,
+		timeout:      2 * time.Second,
+	}
+	for _, opt := range opts {
+		if err := opt(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+// WithSchemes sets the URL schemes destinations may use
+func WithSchemes(schemes ...string) Options {
+	return func(p *ValidatorParams) error {
+		if len(schemes) == 0 {
+			return fmt.Errorf("at least one scheme is required")
+		}
+		p.schemes = make([]string, 0, len(schemes))
+		for _, scheme := range schemes {
+			p.schemes = append(p.schemes, strings.ToLower(strings.TrimSpace(scheme)))
+		}
+		return nil
+	}
+}
+
+// WithMaxLength sets the longest destination accepted, in bytes
+func WithMaxLength(n int) Options {
+	return func(p *ValidatorParams) error {
+		if n <= 0 {
+			return fmt.Errorf("max length must be positive")
+		}
+		p.maxLength = n
+		return nil
+	}
+}
+
+// WithBlockPrivate rejects destinations on loopback, private, link-local and
+// other non-public addresses
+func WithBlockPrivate(block bool) Options {
+	return func(p *ValidatorParams) error {
+		p.blockPrivate = block
+		return nil
+	}
+}
+
+// WithResolveHosts also resolves host names so names pointing at non-public
+// addresses are rejected. Only applies when private addresses are blocked.
+func WithResolveHosts(resolve bool) Options {
+	return func(p *ValidatorParams) error {
+		p.resolve = resolve
+		return nil
+	}
+}
+
+func WithResolver(resolver Resolver, timeout time.Duration) Options {
+	return func(p *ValidatorParams) error {
+		p.resolver = resolver
+		p.timeout = timeout
+		return nil
+	}
+}
+
+// WithSelfDomains lists the hosts serving short links, destinations on them
+// would redirect back to us
+func WithSelfDomains(domains ...string) Options {
+	return func(p *ValidatorParams) error {
+		for _, domain := range domains {
+			if domain = strings.ToLower(strings.TrimSpace(domain)); domain != "" {
+				p.selfDomains = append(p.selfDomains, domain)
+			}
+		}
+		return nil
+	}
+}
+
+// getters -----
+
+func (p *ValidatorParams) Schemes() []string {
+	return p.schemes
+}
+
+func (p *ValidatorParams) MaxLength() int {
+	return p.maxLength
+}
+
+func (p *ValidatorParams) BlockPrivate() bool {
+	return p.blockPrivate
+}
+
+func (p *ValidatorParams) ResolveHosts() bool {
+	return p.resolve
+}
+
+func (p *ValidatorParams) Resolver() Resolver {
+	return p.resolver
+}
+
+func (p *ValidatorParams) Timeout() time.Duration {
+	return p.timeout
+}
+
+func (p *ValidatorParams) SelfDomains() []string {
+	return p.selfDomains
+}
@@ -0,0 +1,143 @@
+package validator
+
+import (
+	"context"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Error explains why a destination was rejected
+type Error struct {
+	URL    string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	return "invalid url: " + e.Reason
+}
+
+// Validator checks destination URLs before they are stored
+type Validator struct {
+	params *ValidatorParams
+}
+
+func NewValidator(opts ...Options) (*Validator, error) {
+	params, err := newValidatorParams(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Validator{params: params}, nil
+}
+
+// cgnat is the shared address space of RFC 6598, not covered by IsPrivate
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// Validate returns the parsed destination or an *Error describing the first
+// rule it breaks
+func (v *Validator) Validate(ctx context.Context, raw string) (*url.URL, error) {
+	reject := func(format string, args ...any) error {
+		return &Error{URL: raw, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	if len(raw) > v.params.MaxLength() {
+		return nil, reject("longer than %d characters", v.params.MaxLength())
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, reject("malformed")
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "" && !slices.Contains(v.params.Schemes(), scheme) {
+		return nil, reject("scheme %q is not allowed", scheme)
+	}
+
+	if scheme == "" || u.Host == "" {
+		return nil, reject("must be an absolute URL with a scheme and host")
+	}
+
+	// user:pass@host URLs are a common way to disguise the real host
+	if u.User != nil {
+		return nil, reject("credentials in the URL are not allowed")
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return nil, reject("missing host")
+	}
+
+	for _, self := range v.params.SelfDomains() {
+		if host == self {
+			return nil, reject("points back at the short link domain %s", self)
+		}
+	}
+
+	if v.params.BlockPrivate() {
+		if err := v.checkAddress(ctx, host); err != nil {
+			return nil, reject("%s", err.Error())
+		}
+	}
+
+	return u, nil
+}
+
+// checkAddress rejects literal non-public addresses, localhost names and,
+// when resolving is enabled, names resolving to non-public addresses
+func (v *Validator) checkAddress(ctx context.Context, host string) error {
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return fmt.Errorf("host %s is not public", host)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !public(addr) {
+			return fmt.Errorf("address %s is not public", host)
+		}
+		return nil
+	}
+
+	// Browsers read hosts such as 2130706433 or 0x7f.1 as IPv4 addresses;
+	// no real domain ends in a numeric label, so refuse them outright
+	labels := strings.Split(host, ".")
+	if last := labels[len(labels)-1]; strings.Trim(last, "0123456789") == "" ||
+		strings.HasPrefix(last, "0x") {
+		return fmt.Errorf("host %s looks like an IP address in a non-standard form", host)
+	}
+
+	if !v.params.ResolveHosts() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, v.params.Timeout())
+	defer cancel()
+
+	addrs, err := v.params.Resolver().LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("host %s cannot be resolved", host)
+	}
+
+	for _, ip := range addrs {
+		addr, ok := netip.AddrFromSlice(ip.IP)
+		if addr = addr.Unmap(); ok && !public(addr) {
+			return fmt.Errorf("host %s resolves to non-public address %s", host, addr)
+		}
+	}
+
+	return nil
+}
+
+func public(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return !(addr.IsLoopback() ||
+		addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() ||
+		addr.IsUnspecified() ||
+		cgnat.Contains(addr))
+}